@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OCIArtifact is an Artifact implementation for when an image is written
+// to an OCI image layout, a directory or a tar archive.
+type OCIArtifact struct {
+	BuilderIdValue string
+	Path           string
+	RefName        string
+}
+
+func (a *OCIArtifact) BuilderId() string {
+	return a.BuilderIdValue
+}
+
+func (a *OCIArtifact) Files() []string {
+	if IsOCIArchive(a.Path) {
+		return []string{a.Path}
+	}
+
+	var files []string
+	filepath.Walk(a.Path, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+func (a *OCIArtifact) Id() string {
+	return a.RefName
+}
+
+func (a *OCIArtifact) String() string {
+	return fmt.Sprintf("OCI image layout: %s", a.Path)
+}
+
+func (*OCIArtifact) State(name string) interface{} {
+	return nil
+}
+
+func (a *OCIArtifact) Destroy() error {
+	return os.RemoveAll(a.Path)
+}
@@ -13,6 +13,10 @@ import (
 const (
 	BuilderId       = "packer.docker"
 	BuilderIdImport = "packer.post-processor.docker-import"
+
+	// BuilderIdOCI identifies the OCI image layouts, which docker-import
+	// mustn't take for exported tarballs.
+	BuilderIdOCI = "packer.docker.oci"
 )
 
 type Builder struct {
@@ -69,6 +73,9 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	} else if b.config.ExportPath != "" {
 		log.Printf("[DEBUG] Container will be exported to %s", b.config.ExportPath)
 		steps = append(steps, new(StepExport))
+	} else if b.config.OCIPath != "" {
+		log.Printf("[DEBUG] Container will be exported to the OCI image layout %s", b.config.OCIPath)
+		steps = append(steps, new(StepExportOCI))
 	} else {
 		return nil, errArtifactNotUsed
 	}
@@ -104,6 +111,12 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 			BuilderIdValue: BuilderIdImport,
 			Driver:         driver,
 		}
+	} else if b.config.OCIPath != "" {
+		artifact = &OCIArtifact{
+			BuilderIdValue: BuilderIdOCI,
+			Path:           b.config.OCIPath,
+			RefName:        b.config.OCIRefName,
+		}
 	} else {
 		artifact = &ExportArtifact{path: b.config.ExportPath}
 	}
@@ -3,6 +3,7 @@ package docker
 import (
 	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -32,6 +33,10 @@ type Communicator struct {
 var _ packer.Communicator = new(Communicator)
 
 func (c *Communicator) Start(ctx context.Context, remote *packer.RemoteCmd) error {
+	if remote.Pty != nil {
+		return errors.New("pseudo terminals are not supported by the docker communicator")
+	}
+
 	dockerArgs := []string{
 		"exec",
 		"-i",
@@ -13,10 +13,11 @@ import (
 )
 
 var (
-	errArtifactNotUsed     = fmt.Errorf("No instructions given for handling the artifact; expected commit, discard, or export_path")
-	errArtifactUseConflict = fmt.Errorf("Cannot specify more than one of commit, discard, and export_path")
+	errArtifactNotUsed     = fmt.Errorf("No instructions given for handling the artifact; expected commit, discard, export_path or oci_path")
+	errArtifactUseConflict = fmt.Errorf("Cannot specify more than one of commit, discard, export_path and oci_path")
 	errExportPathNotFile   = fmt.Errorf("export_path must be a file, not a directory")
 	errImageNotSpecified   = fmt.Errorf("Image must be specified")
+	errOCIPathKind         = fmt.Errorf("oci_path must be a directory, or a file when it ends with .tar")
 )
 
 type Config struct {
@@ -32,7 +33,9 @@ type Config struct {
 	ExportPath       string `mapstructure:"export_path"`
 	Image            string
 	Message          string
-	Privileged       bool `mapstructure:"privileged"`
+	OCIPath          string `mapstructure:"oci_path"`
+	OCIRefName       string `mapstructure:"oci_ref_name"`
+	Privileged       bool   `mapstructure:"privileged"`
 	Pty              bool
 	Pull             bool
 	RunCommand       []string `mapstructure:"run_command"`
@@ -109,11 +112,17 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 		errs = packer.MultiErrorAppend(errs, errImageNotSpecified)
 	}
 
-	if (c.ExportPath != "" && c.Commit) || (c.ExportPath != "" && c.Discard) || (c.Commit && c.Discard) {
+	artifactUses := 0
+	for _, use := range []bool{c.Commit, c.Discard, c.ExportPath != "", c.OCIPath != ""} {
+		if use {
+			artifactUses++
+		}
+	}
+	if artifactUses > 1 {
 		errs = packer.MultiErrorAppend(errs, errArtifactUseConflict)
 	}
 
-	if c.ExportPath == "" && !c.Commit && !c.Discard {
+	if artifactUses == 0 {
 		errs = packer.MultiErrorAppend(errs, errArtifactNotUsed)
 	}
 
@@ -123,6 +132,22 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 		}
 	}
 
+	if c.OCIPath != "" {
+		if fi, err := os.Stat(c.OCIPath); err == nil && fi.IsDir() == IsOCIArchive(c.OCIPath) {
+			errs = packer.MultiErrorAppend(errs, errOCIPathKind)
+		}
+		if c.WindowsContainer {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("oci_path is not supported with Windows containers"))
+		}
+		if err := new(ImageConfig).ApplyChanges(c.Changes); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+
+	if c.OCIRefName == "" {
+		c.OCIRefName = "latest"
+	}
+
 	if c.ContainerDir == "" {
 		c.ContainerDir = "/packer-files"
 	}
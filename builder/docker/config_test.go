@@ -3,6 +3,7 @@ package docker
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -141,3 +142,47 @@ func TestConfigPrepare_pull(t *testing.T) {
 		t.Fatal("should not pull")
 	}
 }
+
+func TestConfigPrepare_ociPath(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	raw := testConfig()
+	delete(raw, "export_path")
+
+	// Good OCI paths
+	raw["oci_path"] = td
+	c, warns, errs := NewConfig(raw)
+	testConfigOk(t, warns, errs)
+	if c.OCIRefName != "latest" {
+		t.Fatalf("bad ref name: %s", c.OCIRefName)
+	}
+
+	raw["oci_path"] = "image.tar"
+	_, warns, errs = NewConfig(raw)
+	testConfigOk(t, warns, errs)
+
+	// Bad OCI path (directory named as an archive)
+	archiveDir := filepath.Join(td, "image.tar")
+	if err := os.Mkdir(archiveDir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw["oci_path"] = archiveDir
+	_, warns, errs = NewConfig(raw)
+	testConfigErr(t, warns, errs)
+
+	// OCI path AND export (invalid)
+	raw["oci_path"] = "image"
+	raw["export_path"] = "good"
+	_, warns, errs = NewConfig(raw)
+	testConfigErr(t, warns, errs)
+
+	// Unsupported change
+	delete(raw, "export_path")
+	raw["changes"] = []string{"RUN make"}
+	_, warns, errs = NewConfig(raw)
+	testConfigErr(t, warns, errs)
+}
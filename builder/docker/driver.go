@@ -22,6 +22,9 @@ type Driver interface {
 	// Import imports a container from a tar file
 	Import(path string, changes []string, repo string) (string, error)
 
+	// InspectImage reads the platform and the configuration of an image.
+	InspectImage(id string) (*ImageInspect, error)
+
 	// IPAddress returns the address of the container that can be used
 	// for external access.
 	IPAddress(id string) (string, error)
@@ -33,6 +36,14 @@ type Driver interface {
 	// Logout. This can only be called if Login succeeded.
 	Logout(repo string) error
 
+	// CreateManifest creates a manifest list from images pushed to a
+	// registry, replacing the local one of the same name if any.
+	CreateManifest(name string, images []string, insecure bool) error
+
+	// PushManifest pushes a manifest list created with CreateManifest,
+	// then removes it locally.
+	PushManifest(name string, insecure bool) error
+
 	// Pull should pull down the given image.
 	Pull(image string) error
 
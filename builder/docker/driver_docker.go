@@ -2,6 +2,7 @@ package docker
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -142,6 +143,24 @@ func (d *DockerDriver) Import(path string, changes []string, repo string) (strin
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+func (d *DockerDriver) InspectImage(id string) (*ImageInspect, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", "image", "inspect", "--format", "{{json .}}", id)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error inspecting image: %s\nStderr: %s",
+			err, stderr.String())
+	}
+
+	var inspect ImageInspect
+	if err := json.Unmarshal(stdout.Bytes(), &inspect); err != nil {
+		return nil, fmt.Errorf("Error reading the image configuration: %s", err)
+	}
+	return &inspect, nil
+}
+
 func (d *DockerDriver) IPAddress(id string) (string, error) {
 	var stderr, stdout bytes.Buffer
 	cmd := exec.Command(
@@ -226,6 +245,35 @@ func (d *DockerDriver) Logout(repo string) error {
 	return err
 }
 
+func (d *DockerDriver) CreateManifest(name string, images []string, insecure bool) error {
+	args := []string{"manifest", "create", "--amend"}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	args = append(args, name)
+	args = append(args, images...)
+
+	return runAndStream(manifestCommand(args...), d.Ui)
+}
+
+func (d *DockerDriver) PushManifest(name string, insecure bool) error {
+	args := []string{"manifest", "push", "--purge"}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	args = append(args, name)
+
+	return runAndStream(manifestCommand(args...), d.Ui)
+}
+
+// manifestCommand returns a docker command enabling the experimental CLI
+// features, which the manifest commands are part of before Docker 20.10.
+func manifestCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("docker", args...)
+	cmd.Env = append(os.Environ(), "DOCKER_CLI_EXPERIMENTAL=enabled")
+	return cmd
+}
+
 func (d *DockerDriver) Pull(image string) error {
 	cmd := exec.Command("docker", "pull", image)
 	return runAndStream(cmd, d.Ui)
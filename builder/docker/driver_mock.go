@@ -23,6 +23,11 @@ type MockDriver struct {
 	ImportId     string
 	ImportErr    error
 
+	InspectImageCalled bool
+	InspectImageId     string
+	InspectImageResult *ImageInspect
+	InspectImageErr    error
+
 	IPAddressCalled bool
 	IPAddressID     string
 	IPAddressResult string
@@ -42,6 +47,16 @@ type MockDriver struct {
 	LogoutRepo   string
 	LogoutErr    error
 
+	CreateManifestCalled   bool
+	CreateManifestName     string
+	CreateManifestImages   []string
+	CreateManifestInsecure bool
+	CreateManifestErr      error
+
+	PushManifestCalled bool
+	PushManifestName   string
+	PushManifestErr    error
+
 	PushCalled bool
 	PushName   string
 	PushErr    error
@@ -112,6 +127,15 @@ func (d *MockDriver) Import(path string, changes []string, repo string) (string,
 	return d.ImportId, d.ImportErr
 }
 
+func (d *MockDriver) InspectImage(id string) (*ImageInspect, error) {
+	d.InspectImageCalled = true
+	d.InspectImageId = id
+	if d.InspectImageResult == nil && d.InspectImageErr == nil {
+		return &ImageInspect{Architecture: "amd64", Os: "linux"}, nil
+	}
+	return d.InspectImageResult, d.InspectImageErr
+}
+
 func (d *MockDriver) IPAddress(id string) (string, error) {
 	d.IPAddressCalled = true
 	d.IPAddressID = id
@@ -132,6 +156,20 @@ func (d *MockDriver) Logout(r string) error {
 	return d.LogoutErr
 }
 
+func (d *MockDriver) CreateManifest(name string, images []string, insecure bool) error {
+	d.CreateManifestCalled = true
+	d.CreateManifestName = name
+	d.CreateManifestImages = images
+	d.CreateManifestInsecure = insecure
+	return d.CreateManifestErr
+}
+
+func (d *MockDriver) PushManifest(name string, insecure bool) error {
+	d.PushManifestCalled = true
+	d.PushManifestName = name
+	return d.PushManifestErr
+}
+
 func (d *MockDriver) Pull(image string) error {
 	d.PullCalled = true
 	d.PullImage = image
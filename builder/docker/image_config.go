@@ -0,0 +1,229 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ImageInspect is the part of `docker image inspect` describing the
+// platform and the configuration of an image.
+type ImageInspect struct {
+	Architecture string
+	Os           string
+	Config       ImageConfig
+}
+
+// ImageConfig is the configuration of the containers run from an image. The
+// fields are named as in both Docker and OCI image configs.
+type ImageConfig struct {
+	User         string              `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	Env          []string            `json:",omitempty"`
+	Entrypoint   []string            `json:",omitempty"`
+	Cmd          []string            `json:",omitempty"`
+	Volumes      map[string]struct{} `json:",omitempty"`
+	WorkingDir   string              `json:",omitempty"`
+	Labels       map[string]string   `json:",omitempty"`
+	StopSignal   string              `json:",omitempty"`
+}
+
+// ApplyChanges applies Dockerfile instructions to the configuration, as
+// `docker commit --change` does. Only the instructions changing the
+// configuration are supported: CMD, ENTRYPOINT, ENV, EXPOSE, LABEL,
+// STOPSIGNAL, USER, VOLUME and WORKDIR.
+func (c *ImageConfig) ApplyChanges(changes []string) error {
+	cmdSet := false
+	entrypointSet := false
+
+	for _, change := range changes {
+		parts := strings.SplitN(strings.TrimSpace(change), " ", 2)
+		instruction := strings.ToUpper(parts[0])
+		args := ""
+		if len(parts) == 2 {
+			args = strings.TrimSpace(parts[1])
+		}
+		if args == "" {
+			return fmt.Errorf("%s requires an argument: %q", instruction, change)
+		}
+
+		switch instruction {
+		case "CMD":
+			cmd, err := parseCommand(args)
+			if err != nil {
+				return fmt.Errorf("Error parsing %q: %s", change, err)
+			}
+			c.Cmd = cmd
+			cmdSet = true
+		case "ENTRYPOINT":
+			entrypoint, err := parseCommand(args)
+			if err != nil {
+				return fmt.Errorf("Error parsing %q: %s", change, err)
+			}
+			c.Entrypoint = entrypoint
+			entrypointSet = true
+		case "ENV":
+			env, err := parseKeyValues(args, true)
+			if err != nil {
+				return fmt.Errorf("Error parsing %q: %s", change, err)
+			}
+			for _, kv := range env {
+				c.setEnv(kv[0], kv[1])
+			}
+		case "LABEL":
+			labels, err := parseKeyValues(args, false)
+			if err != nil {
+				return fmt.Errorf("Error parsing %q: %s", change, err)
+			}
+			if c.Labels == nil {
+				c.Labels = make(map[string]string)
+			}
+			for _, kv := range labels {
+				c.Labels[kv[0]] = kv[1]
+			}
+		case "EXPOSE":
+			if c.ExposedPorts == nil {
+				c.ExposedPorts = make(map[string]struct{})
+			}
+			for _, port := range strings.Fields(args) {
+				if !strings.Contains(port, "/") {
+					port += "/tcp"
+				}
+				c.ExposedPorts[port] = struct{}{}
+			}
+		case "VOLUME":
+			volumes := strings.Fields(args)
+			if strings.HasPrefix(args, "[") {
+				volumes = nil
+				if err := json.Unmarshal([]byte(args), &volumes); err != nil {
+					return fmt.Errorf("Error parsing %q: %s", change, err)
+				}
+			}
+			if c.Volumes == nil {
+				c.Volumes = make(map[string]struct{})
+			}
+			for _, volume := range volumes {
+				c.Volumes[volume] = struct{}{}
+			}
+		case "WORKDIR":
+			if path.IsAbs(args) || c.WorkingDir == "" {
+				c.WorkingDir = path.Clean(args)
+			} else {
+				c.WorkingDir = path.Join(c.WorkingDir, args)
+			}
+		case "USER":
+			c.User = args
+		case "STOPSIGNAL":
+			c.StopSignal = args
+		default:
+			return fmt.Errorf("Unsupported change: %q", change)
+		}
+	}
+
+	// As in Dockerfiles, a new entrypoint resets the command of the base
+	// image.
+	if entrypointSet && !cmdSet {
+		c.Cmd = nil
+	}
+
+	return nil
+}
+
+func (c *ImageConfig) setEnv(key, value string) {
+	for i, kv := range c.Env {
+		if strings.SplitN(kv, "=", 2)[0] == key {
+			c.Env[i] = key + "=" + value
+			return
+		}
+	}
+	c.Env = append(c.Env, key+"="+value)
+}
+
+// parseCommand reads the exec form of CMD and ENTRYPOINT, a JSON array, or
+// their shell form, run with /bin/sh -c.
+func parseCommand(args string) ([]string, error) {
+	if strings.HasPrefix(args, "[") {
+		var cmd []string
+		if err := json.Unmarshal([]byte(args), &cmd); err == nil {
+			return cmd, nil
+		}
+	}
+	return []string{"/bin/sh", "-c", args}, nil
+}
+
+// parseKeyValues reads key=value pairs, whose values may be quoted. The
+// legacy "key value" form, where the value is the rest of the line, is
+// accepted when legacy is true.
+func parseKeyValues(args string, legacy bool) ([][2]string, error) {
+	words, err := splitWords(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if legacy && !strings.Contains(words[0], "=") {
+		parts := strings.SplitN(args, " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s has no value", parts[0])
+		}
+		return [][2]string{{parts[0], strings.TrimSpace(parts[1])}}, nil
+	}
+
+	var kvs [][2]string
+	for _, word := range words {
+		parts := strings.SplitN(word, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", word)
+		}
+		kvs = append(kvs, [2]string{parts[0], parts[1]})
+	}
+	return kvs, nil
+}
+
+// splitWords splits a line on spaces, removing the quotes and the escapes
+// as a shell would.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '\'':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("unterminated escape")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
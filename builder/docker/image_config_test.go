@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImageConfigApplyChanges(t *testing.T) {
+	c := ImageConfig{
+		Env:        []string{"PATH=/usr/bin", "HOME=/root"},
+		Cmd:        []string{"bash"},
+		WorkingDir: "/srv",
+	}
+	err := c.ApplyChanges([]string{
+		"ENV PATH=/opt/bin:/usr/bin LANG=\"C.UTF-8\"",
+		"ENV GREETING hello world",
+		"LABEL version=1.0 description=\"An \\\"app\\\"\"",
+		"EXPOSE 80 53/udp",
+		"VOLUME [\"/data\"]",
+		"WORKDIR app",
+		"USER nobody",
+		"ENTRYPOINT [\"/app\", \"--serve\"]",
+		"STOPSIGNAL SIGTERM",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := ImageConfig{
+		User:         "nobody",
+		ExposedPorts: map[string]struct{}{"80/tcp": {}, "53/udp": {}},
+		Env:          []string{"PATH=/opt/bin:/usr/bin", "HOME=/root", "LANG=C.UTF-8", "GREETING=hello world"},
+		Entrypoint:   []string{"/app", "--serve"},
+		Volumes:      map[string]struct{}{"/data": {}},
+		WorkingDir:   "/srv/app",
+		Labels:       map[string]string{"version": "1.0", "description": "An \"app\""},
+		StopSignal:   "SIGTERM",
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("bad config:\n%#v\nexpected:\n%#v", c, expected)
+	}
+}
+
+func TestImageConfigApplyChanges_cmd(t *testing.T) {
+	c := ImageConfig{Cmd: []string{"bash"}}
+	err := c.ApplyChanges([]string{
+		"ENTRYPOINT /docker-entrypoint.sh",
+		"CMD nginx -g 'daemon off;'",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(c.Entrypoint, []string{"/bin/sh", "-c", "/docker-entrypoint.sh"}) {
+		t.Fatalf("bad entrypoint: %#v", c.Entrypoint)
+	}
+	if !reflect.DeepEqual(c.Cmd, []string{"/bin/sh", "-c", "nginx -g 'daemon off;'"}) {
+		t.Fatalf("bad cmd: %#v", c.Cmd)
+	}
+}
+
+func TestImageConfigApplyChanges_bad(t *testing.T) {
+	bad := []string{
+		"RUN apt-get update",
+		"ONBUILD RUN make",
+		"ENV",
+		"LABEL version",
+		"LABEL description=\"unterminated",
+	}
+	for _, change := range bad {
+		var c ImageConfig
+		if err := c.ApplyChanges([]string{change}); err == nil {
+			t.Fatalf("expected an error with %q", change)
+		}
+	}
+}
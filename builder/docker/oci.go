@@ -0,0 +1,322 @@
+package docker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The media types of the OCI image specification.
+const (
+	MediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	ociLayoutVersion     = "1.0.0"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// OCIImage describes an image written to an OCI image layout.
+type OCIImage struct {
+	Architecture string
+	OS           string
+	Author       string
+
+	// Comment is recorded in the history of the image.
+	Comment string
+
+	Config ImageConfig
+
+	// RefName names the image in the index of the layout, such as a tag.
+	RefName string
+}
+
+// OCIDescriptor references a blob of an OCI image layout.
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *OCIPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type OCIPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// OCIIndex is the index.json of an OCI image layout.
+type OCIIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []OCIDescriptor `json:"manifests"`
+}
+
+// OCIManifest is the manifest of an image.
+type OCIManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        OCIDescriptor   `json:"config"`
+	Layers        []OCIDescriptor `json:"layers"`
+}
+
+// OCIImageConfig is the configuration blob of an image.
+type OCIImageConfig struct {
+	Created      string       `json:"created,omitempty"`
+	Author       string       `json:"author,omitempty"`
+	Architecture string       `json:"architecture"`
+	OS           string       `json:"os"`
+	Config       ImageConfig  `json:"config"`
+	RootFS       OCIRootFS    `json:"rootfs"`
+	History      []OCIHistory `json:"history,omitempty"`
+}
+
+type OCIRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type OCIHistory struct {
+	Created   string `json:"created,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// IsOCIArchive tells whether an OCI image layout is written to a tar
+// archive rather than a directory.
+func IsOCIArchive(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".tar")
+}
+
+// WriteOCILayout writes an image made of a single layer, read from the tar
+// stream of a container filesystem, to an OCI image layout. The layout is
+// a directory, which must not exist or be empty, or a tar archive when the
+// path ends with .tar.
+func WriteOCILayout(path string, layer io.Reader, image *OCIImage) error {
+	if !IsOCIArchive(path) {
+		return writeOCIDir(path, layer, image)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".oci")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := writeOCIDir(dir, layer, image); err != nil {
+		return err
+	}
+	return archiveOCIDir(dir, path)
+}
+
+func writeOCIDir(dir string, layer io.Reader, image *OCIImage) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return err
+	}
+
+	layerDesc, diffID, err := writeOCILayer(dir, layer)
+	if err != nil {
+		return fmt.Errorf("Error writing the layer: %s", err)
+	}
+
+	created := time.Now().UTC().Format(time.RFC3339)
+	config := &OCIImageConfig{
+		Created:      created,
+		Author:       image.Author,
+		Architecture: image.Architecture,
+		OS:           image.OS,
+		Config:       image.Config,
+		RootFS: OCIRootFS{
+			Type:    "layers",
+			DiffIDs: []string{diffID},
+		},
+		History: []OCIHistory{{
+			Created:   created,
+			CreatedBy: "packer",
+			Author:    image.Author,
+			Comment:   image.Comment,
+		}},
+	}
+	configDesc, err := writeOCIBlob(dir, MediaTypeOCIConfig, config)
+	if err != nil {
+		return err
+	}
+
+	manifestDesc, err := writeOCIBlob(dir, MediaTypeOCIManifest, &OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        configDesc,
+		Layers:        []OCIDescriptor{layerDesc},
+	})
+	if err != nil {
+		return err
+	}
+	manifestDesc.Platform = &OCIPlatform{
+		Architecture: image.Architecture,
+		OS:           image.OS,
+	}
+	if image.RefName != "" {
+		manifestDesc.Annotations = map[string]string{
+			ociRefNameAnnotation: image.RefName,
+		}
+	}
+
+	if err := writeJSON(filepath.Join(dir, "index.json"), &OCIIndex{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIIndex,
+		Manifests:     []OCIDescriptor{manifestDesc},
+	}); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "oci-layout"), map[string]string{
+		"imageLayoutVersion": ociLayoutVersion,
+	})
+}
+
+// writeOCILayer compresses the layer into the blobs of the layout, and
+// returns its descriptor and the digest of its uncompressed content.
+func writeOCILayer(dir string, layer io.Reader) (OCIDescriptor, string, error) {
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	f, err := ioutil.TempFile(blobs, ".layer")
+	if err != nil {
+		return OCIDescriptor{}, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	digest := sha256.New()
+	size := &countWriter{}
+	gz := gzip.NewWriter(io.MultiWriter(f, digest, size))
+	diffID := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(gz, diffID), layer); err != nil {
+		return OCIDescriptor{}, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return OCIDescriptor{}, "", err
+	}
+	if err := f.Close(); err != nil {
+		return OCIDescriptor{}, "", err
+	}
+
+	sum := hex.EncodeToString(digest.Sum(nil))
+	if err := os.Rename(f.Name(), filepath.Join(blobs, sum)); err != nil {
+		return OCIDescriptor{}, "", err
+	}
+	return OCIDescriptor{
+		MediaType: MediaTypeOCILayer,
+		Digest:    "sha256:" + sum,
+		Size:      size.n,
+	}, digestString(diffID), nil
+}
+
+func writeOCIBlob(dir, mediaType string, v interface{}) (OCIDescriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return OCIDescriptor{}, err
+	}
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+	if err := ioutil.WriteFile(filepath.Join(dir, "blobs", "sha256", name), data, 0644); err != nil {
+		return OCIDescriptor{}, err
+	}
+	return OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + name,
+		Size:      int64(len(data)),
+	}, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// archiveOCIDir writes the layout in dir to a tar archive.
+func archiveOCIDir(dir, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil || file == dir {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func digestString(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,217 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testLayer(t *testing.T) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	content := []byte("hello")
+	if err := tw.WriteHeader(&tar.Header{Name: "etc/motd", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tw.Write(content)
+	tw.Close()
+	return b.Bytes()
+}
+
+func testOCIImage() *OCIImage {
+	return &OCIImage{
+		Architecture: "arm64",
+		OS:           "linux",
+		Author:       "packer",
+		Config: ImageConfig{
+			Env: []string{"PATH=/usr/bin"},
+			Cmd: []string{"/bin/sh"},
+		},
+		RefName: "1.0",
+	}
+}
+
+// readOCIBlob reads a blob of a layout and verifies its digest.
+func readOCIBlob(t *testing.T, read func(string) []byte, desc OCIDescriptor) []byte {
+	data := read("blobs/" + strings.Replace(desc.Digest, ":", "/", 1))
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != desc.Digest {
+		t.Fatalf("bad digest of %s", desc.Digest)
+	}
+	if int64(len(data)) != desc.Size {
+		t.Fatalf("bad size of %s: %d", desc.Digest, len(data))
+	}
+	return data
+}
+
+// testVerifyOCILayout checks the layout written from testLayer and
+// testOCIImage.
+func testVerifyOCILayout(t *testing.T, read func(string) []byte, layer []byte) {
+	var layout map[string]string
+	if err := json.Unmarshal(read("oci-layout"), &layout); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if layout["imageLayoutVersion"] != "1.0.0" {
+		t.Fatalf("bad layout: %v", layout)
+	}
+
+	var index OCIIndex
+	if err := json.Unmarshal(read("index.json"), &index); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("bad index: %#v", index)
+	}
+	desc := index.Manifests[0]
+	if desc.Annotations[ociRefNameAnnotation] != "1.0" || desc.Platform.Architecture != "arm64" {
+		t.Fatalf("bad manifest descriptor: %#v", desc)
+	}
+
+	var manifest OCIManifest
+	if err := json.Unmarshal(readOCIBlob(t, read, desc), &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != MediaTypeOCILayer {
+		t.Fatalf("bad manifest: %#v", manifest)
+	}
+
+	var config OCIImageConfig
+	if err := json.Unmarshal(readOCIBlob(t, read, manifest.Config), &config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(config.Config, testOCIImage().Config) || config.OS != "linux" {
+		t.Fatalf("bad config: %#v", config)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(readOCIBlob(t, read, manifest.Layers[0])))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	uncompressed, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(uncompressed, layer) {
+		t.Fatal("bad layer")
+	}
+	sum := sha256.Sum256(layer)
+	if config.RootFS.DiffIDs[0] != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad diff ID: %s", config.RootFS.DiffIDs[0])
+	}
+}
+
+// readOCIConfig reads the image config of the layout in dir.
+func readOCIConfig(t *testing.T, dir string) *OCIImageConfig {
+	read := func(name string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return data
+	}
+
+	var index OCIIndex
+	if err := json.Unmarshal(read("index.json"), &index); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var manifest OCIManifest
+	if err := json.Unmarshal(readOCIBlob(t, read, index.Manifests[0]), &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var config OCIImageConfig
+	if err := json.Unmarshal(readOCIBlob(t, read, manifest.Config), &config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &config
+}
+
+func TestWriteOCILayout(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-oci")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	layer := testLayer(t)
+	dir := filepath.Join(td, "image")
+	if err := WriteOCILayout(dir, bytes.NewReader(layer), testOCIImage()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testVerifyOCILayout(t, func(name string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return data
+	}, layer)
+
+	// The layout isn't written over an existing one
+	if err := WriteOCILayout(dir, bytes.NewReader(layer), testOCIImage()); err == nil {
+		t.Fatal("expected an error with an existing layout")
+	}
+}
+
+func TestWriteOCILayout_archive(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-oci")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	layer := testLayer(t)
+	archive := filepath.Join(td, "image.tar")
+	if err := WriteOCILayout(archive, bytes.NewReader(layer), testOCIImage()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		files[h.Name] = data
+	}
+
+	testVerifyOCILayout(t, func(name string) []byte {
+		data, ok := files[name]
+		if !ok {
+			t.Fatalf("%s is missing from the archive", name)
+		}
+		return data
+	}, layer)
+
+	// Only the archive is left
+	entries, err := ioutil.ReadDir(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("the temporary layout should be removed: %v", entries)
+	}
+}
@@ -0,0 +1,73 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/packer/helper/multistep"
+	"github.com/hashicorp/packer/packer"
+)
+
+// StepExportOCI exports the container to an OCI image layout, whose image
+// config is the config of the base image with the changes applied.
+type StepExportOCI struct{}
+
+func (s *StepExportOCI) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	driver := state.Get("driver").(Driver)
+	containerId := state.Get("container_id").(string)
+	ui := state.Get("ui").(packer.Ui)
+
+	inspect, err := driver.InspectImage(config.Image)
+	if err != nil {
+		err := fmt.Errorf("Error reading the configuration of the base image: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	imageConfig := inspect.Config
+	if err := imageConfig.ApplyChanges(config.Changes); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if _, err := os.Stat(config.OCIPath); err == nil && config.PackerForce {
+		ui.Message(fmt.Sprintf("Removing the existing OCI image layout %s", config.OCIPath))
+		if err := os.RemoveAll(config.OCIPath); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Exporting the container to the OCI image layout %s", config.OCIPath))
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(driver.Export(containerId, w))
+	}()
+
+	err = WriteOCILayout(config.OCIPath, r, &OCIImage{
+		Architecture: inspect.Architecture,
+		OS:           inspect.Os,
+		Author:       config.Author,
+		Comment:      config.Message,
+		Config:       imageConfig,
+		RefName:      config.OCIRefName,
+	})
+	r.Close()
+	if err != nil {
+		err := fmt.Errorf("Error exporting the container: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepExportOCI) Cleanup(state multistep.StateBag) {}
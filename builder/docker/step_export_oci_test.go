@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer/helper/multistep"
+)
+
+func TestStepExportOCI_impl(t *testing.T) {
+	var _ multistep.Step = new(StepExportOCI)
+}
+
+func TestStepExportOCI(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	state := testStepExportState(t)
+	step := new(StepExportOCI)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ExportPath = ""
+	config.OCIPath = filepath.Join(td, "image")
+	config.OCIRefName = "latest"
+	config.Changes = []string{"CMD [\"/app\"]"}
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = bytes.NewReader(testLayer(t))
+	driver.InspectImageResult = &ImageInspect{
+		Architecture: "arm64",
+		Os:           "linux",
+		Config:       ImageConfig{Env: []string{"PATH=/usr/bin"}, Cmd: []string{"sh"}},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	if !driver.InspectImageCalled || driver.InspectImageId != config.Image {
+		t.Fatal("should inspect the base image")
+	}
+	if !driver.ExportCalled || driver.ExportID != "foo" {
+		t.Fatal("should've exported")
+	}
+
+	configBlob := readOCIConfig(t, config.OCIPath)
+	if configBlob.Architecture != "arm64" || configBlob.Config.Cmd[0] != "/app" || configBlob.Config.Env[0] != "PATH=/usr/bin" {
+		t.Fatalf("bad config: %#v", configBlob)
+	}
+}
+
+func TestStepExportOCI_error(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	state := testStepExportState(t)
+	step := new(StepExportOCI)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.OCIPath = filepath.Join(td, "image.tar")
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportError = errors.New("foo")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if _, err := os.Stat(config.OCIPath); err == nil {
+		t.Fatal("oci path shouldn't exist")
+	}
+}
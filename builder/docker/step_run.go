@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/helper/multistep"
 	"github.com/hashicorp/packer/packer"
 )
@@ -42,6 +43,8 @@ func (s *StepRun) Run(ctx context.Context, state multistep.StateBag) multistep.S
 	// Save the container ID
 	s.containerId = containerId
 	state.Put("container_id", s.containerId)
+	// Let the provisioners connect to the container on their own
+	commonhelper.SetSharedState("container_id", s.containerId, config.PackerBuildName)
 	ui.Message(fmt.Sprintf("Container ID: %s", s.containerId))
 	return multistep.ActionContinue
 }
@@ -51,9 +54,12 @@ func (s *StepRun) Cleanup(state multistep.StateBag) {
 		return
 	}
 
+	config := state.Get("config").(*Config)
 	driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packer.Ui)
 
+	commonhelper.RemoveSharedStateFile("container_id", config.PackerBuildName)
+
 	// Kill the container. We don't handle errors because errors usually
 	// just mean that the container doesn't exist anymore, which isn't a
 	// big deal.
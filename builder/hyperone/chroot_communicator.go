@@ -2,6 +2,7 @@ package hyperone
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -22,6 +23,10 @@ type ChrootCommunicator struct {
 }
 
 func (c *ChrootCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	if cmd.Pty != nil {
+		return errors.New("pseudo terminals are not supported in a chroot")
+	}
+
 	command := strconv.Quote(cmd.Command)
 	chrootCommand, err := c.CmdWrapper(
 		fmt.Sprintf("sudo chroot %s /bin/sh -c %s", c.Chroot, command))
@@ -2,6 +2,7 @@ package lxc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,6 +25,10 @@ type LxcAttachCommunicator struct {
 }
 
 func (c *LxcAttachCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	if cmd.Pty != nil {
+		return errors.New("pseudo terminals are not supported by lxc-attach")
+	}
+
 	localCmd, err := c.Execute(cmd.Command)
 
 	if err != nil {
@@ -2,6 +2,7 @@ package lxd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,6 +20,10 @@ type Communicator struct {
 }
 
 func (c *Communicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	if cmd.Pty != nil {
+		return errors.New("pseudo terminals are not supported by the lxd communicator")
+	}
+
 	localCmd, err := c.Execute(cmd.Command)
 
 	if err != nil {
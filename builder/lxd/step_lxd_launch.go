@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/helper/multistep"
 	"github.com/hashicorp/packer/packer"
 )
@@ -50,6 +51,9 @@ func (s *stepLxdLaunch) Run(ctx context.Context, state multistep.StateBag) multi
 
 	time.Sleep(time.Duration(sleep_seconds) * time.Second)
 	log.Printf("Sleeping for %d seconds...", sleep_seconds)
+
+	// Let the provisioners connect to the container on their own
+	commonhelper.SetSharedState("container_name", name, config.PackerBuildName)
 	return multistep.ActionContinue
 }
 
@@ -57,6 +61,8 @@ func (s *stepLxdLaunch) Cleanup(state multistep.StateBag) {
 	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packer.Ui)
 
+	commonhelper.RemoveSharedStateFile("container_name", config.PackerBuildName)
+
 	cleanup_args := []string{
 		"delete", "--force", config.ContainerName,
 	}
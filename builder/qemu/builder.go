@@ -96,34 +96,35 @@ type Config struct {
 	Comm                  communicator.Config `mapstructure:",squash"`
 	common.FloppyConfig   `mapstructure:",squash"`
 
-	ISOSkipCache      bool       `mapstructure:"iso_skip_cache"`
-	Accelerator       string     `mapstructure:"accelerator"`
-	CpuCount          int        `mapstructure:"cpus"`
-	DiskInterface     string     `mapstructure:"disk_interface"`
-	DiskSize          uint       `mapstructure:"disk_size"`
-	DiskCache         string     `mapstructure:"disk_cache"`
-	DiskDiscard       string     `mapstructure:"disk_discard"`
-	DetectZeroes      string     `mapstructure:"disk_detect_zeroes"`
-	SkipCompaction    bool       `mapstructure:"skip_compaction"`
-	DiskCompression   bool       `mapstructure:"disk_compression"`
-	Format            string     `mapstructure:"format"`
-	Headless          bool       `mapstructure:"headless"`
-	DiskImage         bool       `mapstructure:"disk_image"`
-	UseBackingFile    bool       `mapstructure:"use_backing_file"`
-	MachineType       string     `mapstructure:"machine_type"`
-	MemorySize        int        `mapstructure:"memory"`
-	NetDevice         string     `mapstructure:"net_device"`
-	OutputDir         string     `mapstructure:"output_directory"`
-	QemuArgs          [][]string `mapstructure:"qemuargs"`
-	QemuBinary        string     `mapstructure:"qemu_binary"`
-	ShutdownCommand   string     `mapstructure:"shutdown_command"`
-	SSHHostPortMin    int        `mapstructure:"ssh_host_port_min"`
-	SSHHostPortMax    int        `mapstructure:"ssh_host_port_max"`
-	UseDefaultDisplay bool       `mapstructure:"use_default_display"`
-	VNCBindAddress    string     `mapstructure:"vnc_bind_address"`
-	VNCPortMin        int        `mapstructure:"vnc_port_min"`
-	VNCPortMax        int        `mapstructure:"vnc_port_max"`
-	VMName            string     `mapstructure:"vm_name"`
+	ISOSkipCache      bool          `mapstructure:"iso_skip_cache"`
+	Accelerator       string        `mapstructure:"accelerator"`
+	CpuCount          int           `mapstructure:"cpus"`
+	DiskInterface     string        `mapstructure:"disk_interface"`
+	DiskSize          uint          `mapstructure:"disk_size"`
+	DiskCache         string        `mapstructure:"disk_cache"`
+	DiskDiscard       string        `mapstructure:"disk_discard"`
+	DetectZeroes      string        `mapstructure:"disk_detect_zeroes"`
+	SkipCompaction    bool          `mapstructure:"skip_compaction"`
+	DiskCompression   bool          `mapstructure:"disk_compression"`
+	Format            string        `mapstructure:"format"`
+	Headless          bool          `mapstructure:"headless"`
+	DiskImage         bool          `mapstructure:"disk_image"`
+	UseBackingFile    bool          `mapstructure:"use_backing_file"`
+	MachineType       string        `mapstructure:"machine_type"`
+	MemorySize        int           `mapstructure:"memory"`
+	NetDevice         string        `mapstructure:"net_device"`
+	OutputDir         string        `mapstructure:"output_directory"`
+	QemuArgs          [][]string    `mapstructure:"qemuargs"`
+	QemuBinary        string        `mapstructure:"qemu_binary"`
+	QGATimeout        time.Duration `mapstructure:"qga_timeout"`
+	ShutdownCommand   string        `mapstructure:"shutdown_command"`
+	SSHHostPortMin    int           `mapstructure:"ssh_host_port_min"`
+	SSHHostPortMax    int           `mapstructure:"ssh_host_port_max"`
+	UseDefaultDisplay bool          `mapstructure:"use_default_display"`
+	VNCBindAddress    string        `mapstructure:"vnc_bind_address"`
+	VNCPortMin        int           `mapstructure:"vnc_port_min"`
+	VNCPortMax        int           `mapstructure:"vnc_port_max"`
+	VMName            string        `mapstructure:"vm_name"`
 
 	// These are deprecated, but we keep them around for BC
 	// TODO(@mitchellh): remove
@@ -242,6 +243,10 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		b.config.Format = "qcow2"
 	}
 
+	if b.config.QGATimeout == 0 {
+		b.config.QGATimeout = 5 * time.Minute
+	}
+
 	errs = packer.MultiErrorAppend(errs, b.config.FloppyConfig.Prepare(&b.config.ctx)...)
 	errs = packer.MultiErrorAppend(errs, b.config.VNCConfig.Prepare(&b.config.ctx)...)
 
@@ -410,7 +415,13 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 		},
 	)
 
-	if b.config.Comm.Type != "none" {
+	switch b.config.Comm.Type {
+	case "none":
+	case "qga":
+		steps = append(steps,
+			new(stepConfigureQGA),
+		)
+	default:
 		steps = append(steps,
 			new(stepForwardSSH),
 		)
@@ -430,6 +441,9 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 				SSHConfig: b.config.Comm.SSHConfigFunc(),
 				SSHPort:   commPort,
 				WinRMPort: commPort,
+				CustomConnect: map[string]multistep.Step{
+					"qga": new(stepConnectQGA),
+				},
 			},
 		)
 	}
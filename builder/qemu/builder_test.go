@@ -6,6 +6,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/packer/packer"
 )
@@ -568,3 +569,36 @@ func TestBuilderPrepare_QemuArgs(t *testing.T) {
 		t.Fatalf("bad: %#v", b.config.QemuArgs)
 	}
 }
+
+func TestBuilderPrepare_QGACommunicator(t *testing.T) {
+	var b Builder
+	config := testConfig()
+	config["communicator"] = "qga"
+	delete(config, "ssh_username")
+
+	warns, err := b.Prepare(config)
+	if len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if b.config.QGATimeout != 5*time.Minute {
+		t.Fatalf("bad qga timeout: %s", b.config.QGATimeout)
+	}
+
+	config["qga_timeout"] = "20m"
+	b = Builder{}
+	warns, err = b.Prepare(config)
+	if len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if b.config.QGATimeout != 20*time.Minute {
+		t.Fatalf("bad qga timeout: %s", b.config.QGATimeout)
+	}
+}
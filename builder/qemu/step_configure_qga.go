@@ -0,0 +1,55 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer/helper/multistep"
+	"github.com/hashicorp/packer/packer"
+)
+
+// This step reserves a location for the host side of the virtio-serial
+// channel that the QEMU guest agent communicator connects to. The socket
+// lives in a temporary directory rather than the output directory so it
+// never ends up in the artifact and stays well below the unix socket path
+// length limit.
+//
+// Uses:
+//   ui packer.Ui
+//
+// Produces:
+//   qga_socket string - The path of the guest agent socket.
+type stepConfigureQGA struct {
+	dir string
+}
+
+func (s *stepConfigureQGA) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+
+	dir, err := ioutil.TempDir("", "packer-qga")
+	if err != nil {
+		err := fmt.Errorf("Error creating guest agent socket directory: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	s.dir = dir
+
+	socket := filepath.Join(dir, "qga.sock")
+	log.Printf("Guest agent socket: %s", socket)
+	state.Put("qga_socket", socket)
+
+	return multistep.ActionContinue
+}
+
+func (s *stepConfigureQGA) Cleanup(state multistep.StateBag) {
+	if s.dir != "" {
+		if err := os.RemoveAll(s.dir); err != nil {
+			log.Printf("failed to remove guest agent socket directory: %v", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/packer/communicator/qga"
+	"github.com/hashicorp/packer/helper/multistep"
+	"github.com/hashicorp/packer/packer"
+)
+
+// stepConnectQGA waits for the QEMU guest agent in the VM to respond and
+// stores a communicator that talks to it.
+//
+// Uses:
+//   config     *Config
+//   qga_socket string
+//   ui         packer.Ui
+//
+// Produces:
+//   communicator packer.Communicator
+type stepConnectQGA struct {
+	comm *qga.Communicator
+}
+
+func (s *stepConnectQGA) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	socket := state.Get("qga_socket").(string)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Waiting for the QEMU guest agent to become available...")
+	log.Printf("Waiting for the guest agent, up to timeout: %s", config.QGATimeout)
+
+	ctx, cancel := context.WithTimeout(ctx, config.QGATimeout)
+	defer cancel()
+
+	comm, err := waitForQGA(ctx, socket)
+	if err != nil {
+		if err == context.DeadlineExceeded {
+			err = errors.New("Timeout waiting for the QEMU guest agent.")
+		}
+		err := fmt.Errorf("Error waiting for the QEMU guest agent: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Connected to the QEMU guest agent!")
+	s.comm = comm
+	state.Put("communicator", comm)
+
+	return multistep.ActionContinue
+}
+
+func (s *stepConnectQGA) Cleanup(state multistep.StateBag) {
+	if s.comm != nil {
+		s.comm.Close()
+	}
+}
+
+func waitForQGA(ctx context.Context, socket string) (*qga.Communicator, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+
+		log.Println("[INFO] Attempting guest agent connection...")
+		comm, err := qga.New(&qga.Config{
+			SocketPath: socket,
+			Timeout:    10 * time.Second,
+		})
+		if err != nil {
+			log.Printf("[DEBUG] Guest agent connection error: %s", err)
+			continue
+		}
+
+		return comm, nil
+	}
+}
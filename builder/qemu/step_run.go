@@ -78,8 +78,8 @@ func getCommandArgs(bootDrive string, state multistep.StateBag) ([]string, error
 
 	defaultArgs["-name"] = vmName
 	defaultArgs["-machine"] = fmt.Sprintf("type=%s", config.MachineType)
-	if config.Comm.Type != "none" {
-		sshHostPort = state.Get("sshHostPort").(int)
+	if sshHostPortRaw, ok := state.GetOk("sshHostPort"); ok {
+		sshHostPort = sshHostPortRaw.(int)
 		defaultArgs["-netdev"] = fmt.Sprintf("user,id=user.0,hostfwd=tcp::%v-:%d", sshHostPort, config.Comm.Port())
 	} else {
 		defaultArgs["-netdev"] = fmt.Sprintf("user,id=user.0")
@@ -177,7 +177,7 @@ func getCommandArgs(bootDrive string, state multistep.StateBag) ([]string, error
 
 		httpPort := state.Get("http_port").(int)
 		ictx := config.ctx
-		if config.Comm.Type != "none" {
+		if sshHostPort != 0 {
 			ictx.Data = qemuArgsTemplateData{
 				"10.0.2.2",
 				httpPort,
@@ -236,6 +236,15 @@ func getCommandArgs(bootDrive string, state multistep.StateBag) ([]string, error
 		}
 	}
 
+	// Attach a virtio-serial channel for the guest agent if we talk to it.
+	// It is added to the -chardev and -device of the QemuArgs, if any.
+	if qgaSocketRaw, ok := state.GetOk("qga_socket"); ok {
+		inArgs["-chardev"] = append(inArgs["-chardev"],
+			fmt.Sprintf("socket,path=%s,server,nowait,id=qga0", qgaSocketRaw.(string)))
+		inArgs["-device"] = append(inArgs["-device"],
+			"virtio-serial", "virtserialport,chardev=qga0,name=org.qemu.guest_agent.0")
+	}
+
 	// Flatten to array of strings
 	outArgs := make([]string, 0)
 	for key, values := range inArgs {
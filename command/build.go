@@ -12,6 +12,7 @@ import (
 	"sync"
 	"syscall"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/helper/enumflag"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/template"
@@ -214,6 +215,9 @@ func (c *BuildCommand) Run(args []string) int {
 	log.Printf("Builds completed. Waiting on interrupt barrier...")
 	interruptWg.Wait()
 
+	// The builds are done with the state they share
+	commonhelper.RemoveRunSharedState()
+
 	if interrupted {
 		c.Ui.Say("Cleanly cancelled builds after being interrupted.")
 		return 1
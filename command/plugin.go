@@ -58,15 +58,23 @@ import (
 	checksumpostprocessor "github.com/hashicorp/packer/post-processor/checksum"
 	compresspostprocessor "github.com/hashicorp/packer/post-processor/compress"
 	digitaloceanimportpostprocessor "github.com/hashicorp/packer/post-processor/digitalocean-import"
+	diskconvertpostprocessor "github.com/hashicorp/packer/post-processor/disk-convert"
 	dockerimportpostprocessor "github.com/hashicorp/packer/post-processor/docker-import"
+	dockermanifestpostprocessor "github.com/hashicorp/packer/post-processor/docker-manifest"
+	dockerocipostprocessor "github.com/hashicorp/packer/post-processor/docker-oci"
 	dockerpushpostprocessor "github.com/hashicorp/packer/post-processor/docker-push"
 	dockersavepostprocessor "github.com/hashicorp/packer/post-processor/docker-save"
 	dockertagpostprocessor "github.com/hashicorp/packer/post-processor/docker-tag"
 	googlecomputeexportpostprocessor "github.com/hashicorp/packer/post-processor/googlecompute-export"
 	googlecomputeimportpostprocessor "github.com/hashicorp/packer/post-processor/googlecompute-import"
 	manifestpostprocessor "github.com/hashicorp/packer/post-processor/manifest"
+	ovfpostprocessor "github.com/hashicorp/packer/post-processor/ovf"
+	s3uploadpostprocessor "github.com/hashicorp/packer/post-processor/s3-upload"
+	sbompostprocessor "github.com/hashicorp/packer/post-processor/sbom"
 	shelllocalpostprocessor "github.com/hashicorp/packer/post-processor/shell-local"
+	signaturepostprocessor "github.com/hashicorp/packer/post-processor/signature"
 	vagrantpostprocessor "github.com/hashicorp/packer/post-processor/vagrant"
+	vagrantcatalogpostprocessor "github.com/hashicorp/packer/post-processor/vagrant-catalog"
 	vagrantcloudpostprocessor "github.com/hashicorp/packer/post-processor/vagrant-cloud"
 	vspherepostprocessor "github.com/hashicorp/packer/post-processor/vsphere"
 	vspheretemplatepostprocessor "github.com/hashicorp/packer/post-processor/vsphere-template"
@@ -75,18 +83,23 @@ import (
 	breakpointprovisioner "github.com/hashicorp/packer/provisioner/breakpoint"
 	chefclientprovisioner "github.com/hashicorp/packer/provisioner/chef-client"
 	chefsoloprovisioner "github.com/hashicorp/packer/provisioner/chef-solo"
+	cloudinitprovisioner "github.com/hashicorp/packer/provisioner/cloud-init"
 	convergeprovisioner "github.com/hashicorp/packer/provisioner/converge"
 	fileprovisioner "github.com/hashicorp/packer/provisioner/file"
+	imagetestprovisioner "github.com/hashicorp/packer/provisioner/image-test"
 	inspecprovisioner "github.com/hashicorp/packer/provisioner/inspec"
+	linuxrestartprovisioner "github.com/hashicorp/packer/provisioner/linux-restart"
 	powershellprovisioner "github.com/hashicorp/packer/provisioner/powershell"
 	puppetmasterlessprovisioner "github.com/hashicorp/packer/provisioner/puppet-masterless"
 	puppetserverprovisioner "github.com/hashicorp/packer/provisioner/puppet-server"
 	saltmasterlessprovisioner "github.com/hashicorp/packer/provisioner/salt-masterless"
+	sbomprovisioner "github.com/hashicorp/packer/provisioner/sbom"
 	shellprovisioner "github.com/hashicorp/packer/provisioner/shell"
 	shelllocalprovisioner "github.com/hashicorp/packer/provisioner/shell-local"
 	sleepprovisioner "github.com/hashicorp/packer/provisioner/sleep"
 	windowsrestartprovisioner "github.com/hashicorp/packer/provisioner/windows-restart"
 	windowsshellprovisioner "github.com/hashicorp/packer/provisioner/windows-shell"
+	windowsupdateprovisioner "github.com/hashicorp/packer/provisioner/windows-update"
 )
 
 type PluginCommand struct {
@@ -141,18 +154,23 @@ var Provisioners = map[string]packer.Provisioner{
 	"breakpoint":        new(breakpointprovisioner.Provisioner),
 	"chef-client":       new(chefclientprovisioner.Provisioner),
 	"chef-solo":         new(chefsoloprovisioner.Provisioner),
+	"cloud-init":        new(cloudinitprovisioner.Provisioner),
 	"converge":          new(convergeprovisioner.Provisioner),
 	"file":              new(fileprovisioner.Provisioner),
+	"image-test":        new(imagetestprovisioner.Provisioner),
 	"inspec":            new(inspecprovisioner.Provisioner),
+	"linux-restart":     new(linuxrestartprovisioner.Provisioner),
 	"powershell":        new(powershellprovisioner.Provisioner),
 	"puppet-masterless": new(puppetmasterlessprovisioner.Provisioner),
 	"puppet-server":     new(puppetserverprovisioner.Provisioner),
 	"salt-masterless":   new(saltmasterlessprovisioner.Provisioner),
+	"sbom":              new(sbomprovisioner.Provisioner),
 	"shell":             new(shellprovisioner.Provisioner),
 	"shell-local":       new(shelllocalprovisioner.Provisioner),
 	"sleep":             new(sleepprovisioner.Provisioner),
 	"windows-restart":   new(windowsrestartprovisioner.Provisioner),
 	"windows-shell":     new(windowsshellprovisioner.Provisioner),
+	"windows-update":    new(windowsupdateprovisioner.Provisioner),
 }
 
 var PostProcessors = map[string]packer.PostProcessor{
@@ -162,15 +180,23 @@ var PostProcessors = map[string]packer.PostProcessor{
 	"checksum":             new(checksumpostprocessor.PostProcessor),
 	"compress":             new(compresspostprocessor.PostProcessor),
 	"digitalocean-import":  new(digitaloceanimportpostprocessor.PostProcessor),
+	"disk-convert":         new(diskconvertpostprocessor.PostProcessor),
 	"docker-import":        new(dockerimportpostprocessor.PostProcessor),
+	"docker-manifest":      new(dockermanifestpostprocessor.PostProcessor),
+	"docker-oci":           new(dockerocipostprocessor.PostProcessor),
 	"docker-push":          new(dockerpushpostprocessor.PostProcessor),
 	"docker-save":          new(dockersavepostprocessor.PostProcessor),
 	"docker-tag":           new(dockertagpostprocessor.PostProcessor),
 	"googlecompute-export": new(googlecomputeexportpostprocessor.PostProcessor),
 	"googlecompute-import": new(googlecomputeimportpostprocessor.PostProcessor),
 	"manifest":             new(manifestpostprocessor.PostProcessor),
+	"ovf":                  new(ovfpostprocessor.PostProcessor),
+	"s3-upload":            new(s3uploadpostprocessor.PostProcessor),
+	"sbom":                 new(sbompostprocessor.PostProcessor),
 	"shell-local":          new(shelllocalpostprocessor.PostProcessor),
+	"signature":            new(signaturepostprocessor.PostProcessor),
 	"vagrant":              new(vagrantpostprocessor.PostProcessor),
+	"vagrant-catalog":      new(vagrantcatalogpostprocessor.PostProcessor),
 	"vagrant-cloud":        new(vagrantcloudpostprocessor.PostProcessor),
 	"vsphere":              new(vspherepostprocessor.PostProcessor),
 	"vsphere-template":     new(vspheretemplatepostprocessor.PostProcessor),
@@ -5,6 +5,7 @@ package common
 // them. Embed this structure into your configuration class to get it.
 type PackerConfig struct {
 	PackerBuildName     string            `mapstructure:"packer_build_name"`
+	PackerBuildNames    []string          `mapstructure:"packer_build_names"`
 	PackerBuilderType   string            `mapstructure:"packer_builder_type"`
 	PackerDebug         bool              `mapstructure:"packer_debug"`
 	PackerForce         bool              `mapstructure:"packer_force"`
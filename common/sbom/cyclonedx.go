@@ -0,0 +1,122 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/packer/version"
+)
+
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Publisher  string        `json:"publisher,omitempty"`
+	Licenses   []cdxLicense  `json:"licenses,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxLicense struct {
+	License cdxLicenseName `json:"license"`
+}
+
+type cdxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CycloneDX returns the inventory as a CycloneDX 1.4 JSON document.
+func CycloneDX(inv *Inventory, subject Subject, created time.Time) ([]byte, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + id,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools: []cdxTool{{
+				Vendor:  "HashiCorp",
+				Name:    "packer",
+				Version: version.FormattedVersion(),
+			}},
+			Component: cdxComponent{
+				Type:    "operating-system",
+				Name:    subject.Name,
+				Version: subject.Version,
+			},
+		},
+		Components: []cdxComponent{},
+	}
+	if inv.Distro != "" {
+		doc.Metadata.Component.Properties = []cdxProperty{{Name: "packer:distro", Value: inv.Distro}}
+		if inv.DistroVersion != "" {
+			doc.Metadata.Component.Properties = append(doc.Metadata.Component.Properties,
+				cdxProperty{Name: "packer:distro_version", Value: inv.DistroVersion})
+		}
+	}
+
+	// The references must be unique, which package URLs are not always,
+	// like with the gpg-pubkey packages of rpm.
+	refs := make(map[string]bool)
+	for i, p := range inv.Packages {
+		c := cdxComponent{
+			BOMRef:    p.PURL(inv.Distro),
+			Type:      "library",
+			Name:      p.Name,
+			Version:   p.Version,
+			Publisher: p.Supplier,
+			PURL:      p.PURL(inv.Distro),
+			Properties: []cdxProperty{{
+				Name:  "packer:package_type",
+				Value: p.Type,
+			}},
+		}
+		if c.BOMRef == "" || refs[c.BOMRef] {
+			c.BOMRef = fmt.Sprintf("package-%d", i+1)
+		}
+		refs[c.BOMRef] = true
+		if p.License != "" {
+			c.Licenses = []cdxLicense{{License: cdxLicenseName{Name: p.License}}}
+		}
+		if p.Arch != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "packer:arch", Value: p.Arch})
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
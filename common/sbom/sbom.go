@@ -0,0 +1,76 @@
+// Package sbom describes the software installed on a machine, and writes it
+// as SPDX or CycloneDX software bills of materials.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// InventoryOutput is the build output holding the JSON encoded Inventory
+// collected by the sbom provisioner.
+const InventoryOutput = "sbom_packages"
+
+// FilesOutput is the build output listing, comma separated, the SBOM files
+// written by the sbom post-processor.
+const FilesOutput = "sbom_files"
+
+// The package types, after the package managers.
+const (
+	TypeDeb     = "deb"
+	TypeRPM     = "rpm"
+	TypeAPK     = "apk"
+	TypeWindows = "windows"
+)
+
+// Inventory lists the packages installed on a machine.
+type Inventory struct {
+	// Distro is the ID of the distribution from /etc/os-release, such as
+	// "debian" or "alpine", or "windows".
+	Distro string `json:"distro"`
+
+	// DistroVersion is the version of the distribution.
+	DistroVersion string `json:"distro_version,omitempty"`
+
+	Packages []Package `json:"packages"`
+}
+
+// Package is an installed package.
+type Package struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Arch     string `json:"arch,omitempty"`
+	Supplier string `json:"supplier,omitempty"`
+	License  string `json:"license,omitempty"`
+}
+
+// PURL returns the package URL of the package, or "" when there is no
+// package URL type for it.
+func (p *Package) PURL(distro string) string {
+	switch p.Type {
+	case TypeDeb, TypeRPM, TypeAPK:
+	default:
+		return ""
+	}
+
+	purl := fmt.Sprintf("pkg:%s/", p.Type)
+	if distro != "" {
+		purl += url.PathEscape(strings.ToLower(distro)) + "/"
+	}
+	purl += url.PathEscape(p.Name) + "@" + url.PathEscape(p.Version)
+	if p.Arch != "" {
+		purl += "?arch=" + url.QueryEscape(p.Arch)
+	}
+	return purl
+}
+
+// Subject describes the image an SBOM is about.
+type Subject struct {
+	// Name is the name of the build.
+	Name string
+
+	// Version identifies the image, such as the ID of the artifact.
+	Version string
+}
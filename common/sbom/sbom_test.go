@@ -0,0 +1,98 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testInventory() *Inventory {
+	return &Inventory{
+		Distro:        "debian",
+		DistroVersion: "10",
+		Packages: []Package{
+			{Type: TypeDeb, Name: "curl", Version: "7.64.0-4", Arch: "amd64", Supplier: "Alessandro Ghedini <ghedo@debian.org>"},
+			{Type: TypeDeb, Name: "libstdc++6", Version: "8.3.0-6", Arch: "amd64"},
+			{Type: TypeWindows, Name: "7-Zip 19.00 (x64)", Version: "19.00", Arch: "x64"},
+		},
+	}
+}
+
+func TestPackagePURL(t *testing.T) {
+	cases := []struct {
+		pkg      Package
+		distro   string
+		expected string
+	}{
+		{Package{Type: TypeDeb, Name: "libstdc++6", Version: "8.3.0-6", Arch: "amd64"}, "debian", "pkg:deb/debian/libstdc++6@8.3.0-6?arch=amd64"},
+		{Package{Type: TypeRPM, Name: "bash", Version: "1:4.4.19-7.el8", Arch: "x86_64"}, "centos", "pkg:rpm/centos/bash@1:4.4.19-7.el8?arch=x86_64"},
+		{Package{Type: TypeAPK, Name: "musl", Version: "1.1.22-r3"}, "", "pkg:apk/musl@1.1.22-r3"},
+		{Package{Type: TypeWindows, Name: "7-Zip", Version: "19.00"}, "windows", ""},
+	}
+	for _, c := range cases {
+		if purl := c.pkg.PURL(c.distro); purl != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, purl)
+		}
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	out, err := SPDX(testInventory(), Subject{Name: "debian base", Version: "sha256:1234"}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if doc.SPDXVersion != "SPDX-2.2" || doc.CreationInfo.Created != "1970-01-01T00:00:00Z" {
+		t.Fatalf("unexpected document: %s", out)
+	}
+	if len(doc.Packages) != 4 || len(doc.Relationships) != 4 {
+		t.Fatalf("unexpected packages: %s", out)
+	}
+	if doc.Packages[0].SPDXID != "SPDXRef-Image-debian-base" || doc.Packages[0].VersionInfo != "sha256:1234" {
+		t.Fatalf("unexpected image package: %#v", doc.Packages[0])
+	}
+	curl := doc.Packages[1]
+	if curl.Supplier != "Organization: Alessandro Ghedini <ghedo@debian.org>" ||
+		curl.ExternalRefs[0].ReferenceLocator != "pkg:deb/debian/curl@7.64.0-4?arch=amd64" {
+		t.Fatalf("unexpected package: %#v", curl)
+	}
+	if doc.Packages[3].Supplier != noAssertion || doc.Packages[3].ExternalRefs != nil {
+		t.Fatalf("unexpected package: %#v", doc.Packages[3])
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	inv := testInventory()
+	inv.Packages = append(inv.Packages, inv.Packages[0])
+
+	out, err := CycloneDX(inv, Subject{Name: "debian", Version: "sha256:1234"}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var doc cdxDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if doc.BOMFormat != "CycloneDX" || doc.Metadata.Component.Name != "debian" {
+		t.Fatalf("unexpected document: %s", out)
+	}
+	if len(doc.Components) != 4 {
+		t.Fatalf("unexpected components: %s", out)
+	}
+
+	refs := make(map[string]bool)
+	for _, c := range doc.Components {
+		if refs[c.BOMRef] {
+			t.Fatalf("duplicate reference %q", c.BOMRef)
+		}
+		refs[c.BOMRef] = true
+	}
+	if doc.Components[0].PURL != "pkg:deb/debian/curl@7.64.0-4?arch=amd64" {
+		t.Fatalf("unexpected component: %#v", doc.Components[0])
+	}
+}
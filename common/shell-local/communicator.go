@@ -2,6 +2,7 @@ package shell_local
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,6 +18,10 @@ type Communicator struct {
 }
 
 func (c *Communicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	if cmd.Pty != nil {
+		return errors.New("pseudo terminals are not supported by the shell-local communicator")
+	}
+
 	if len(c.ExecuteCommand) == 0 {
 		return fmt.Errorf("Error launching command via shell-local communicator: No ExecuteCommand provided")
 	}
@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// OutputFileEnvVar is the environment variable holding the path of the file
+// a script can write its "key=value" outputs to.
+const OutputFileEnvVar = "PACKER_OUTPUT_FILE"
+
+// Render renders each of vs into a new slice, leaving vs as is. The inline
+// commands and the environment variables are left out of the interpolation
+// done by Prepare and rendered with this when the provisioner runs, so that
+// they can use the outputs of the provisioners that ran before.
+func Render(vs []string, ctx *interpolate.Context) ([]string, error) {
+	if vs == nil {
+		return nil, nil
+	}
+
+	rendered := make([]string, len(vs))
+	for i, v := range vs {
+		var err error
+		if rendered[i], err = interpolate.Render(v, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// OutputCapture collects the outputs exported by a script, either as
+// "PACKER_OUTPUT key=value" lines on its standard output or as "key=value"
+// lines in the file at RemotePath.
+type OutputCapture struct {
+	RemotePath string
+
+	stdout bytes.Buffer
+}
+
+// Reset empties the remote output file, and creates it if it didn't exist.
+// It must be called before each run of the script.
+func (c *OutputCapture) Reset(comm packer.Communicator) error {
+	c.stdout.Reset()
+	if err := comm.Upload(c.RemotePath, new(bytes.Buffer), nil); err != nil {
+		return fmt.Errorf("Error creating output file: %s", err)
+	}
+	return nil
+}
+
+// Stdout is the writer the standard output of the script must be copied to.
+func (c *OutputCapture) Stdout() io.Writer {
+	return &c.stdout
+}
+
+// Save records the outputs of the script for the build and returns their
+// names.
+func (c *OutputCapture) Save(comm packer.Communicator, buildName string) ([]string, error) {
+	outputs, err := commonhelper.ParseOutputs(&c.stdout, commonhelper.OutputMarker)
+	if err != nil {
+		return nil, err
+	}
+
+	var file bytes.Buffer
+	if err := comm.Download(c.RemotePath, &file); err != nil {
+		return nil, fmt.Errorf("Error downloading output file: %s", err)
+	}
+	fileOutputs, err := commonhelper.ParseOutputs(&file, "")
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fileOutputs {
+		outputs[k] = v
+	}
+
+	if err := commonhelper.SetBuildOutputs(buildName, outputs); err != nil {
+		return nil, fmt.Errorf("Error saving outputs: %s", err)
+	}
+
+	names := make([]string, 0, len(outputs))
+	for k := range outputs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	log.Printf("Captured outputs: %s", strings.Join(names, ", "))
+	return names, nil
+}
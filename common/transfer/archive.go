@@ -0,0 +1,82 @@
+package transfer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+
+	"github.com/klauspost/pgzip"
+)
+
+func writeTarGz(w io.Writer, files []file) error {
+	gzw := pgzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	for _, f := range files {
+		header, err := tar.FileInfoHeader(f.info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = f.rel
+		if f.info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if f.info.IsDir() {
+			continue
+		}
+		if err := copyFile(tw, f.path); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+func writeZip(w io.Writer, files []file) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range files {
+		header, err := zip.FileInfoHeader(f.info)
+		if err != nil {
+			return err
+		}
+		header.Name = f.rel
+		if f.info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if f.info.IsDir() {
+			continue
+		}
+		if err := copyFile(fw, f.path); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,320 @@
+// Package transfer implements bulk directory uploads on top of any
+// communicator.
+//
+// Instead of sending files one at a time, the source directory is streamed
+// through the communicator as a single compressed archive (tar.gz for Unix
+// guests, zip for Windows guests) and unpacked on the guest. In delta mode
+// the guest is first asked for the SHA256 of every file under the
+// destination and only files whose contents differ are sent.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer/common/uuid"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
+	"github.com/masterzen/winrm"
+)
+
+const (
+	// ModeFile uploads files one at a time with Communicator.UploadDir.
+	ModeFile = "file"
+
+	// ModeArchive streams the whole directory as one archive.
+	ModeArchive = "archive"
+
+	// ModeDelta streams an archive of the files that differ on the guest.
+	ModeDelta = "delta"
+)
+
+// Config configures a directory transfer.
+type Config struct {
+	// Mode is one of ModeFile, ModeArchive or ModeDelta.
+	Mode string
+
+	// GuestOSType selects the archive format and the commands used on the
+	// guest. It is one of provisioner.UnixOSType or
+	// provisioner.WindowsOSType.
+	GuestOSType string
+
+	// StagingDir is where the archive is uploaded on the guest before it is
+	// unpacked. It defaults to /tmp on Unix and C:/Windows/Temp on Windows.
+	StagingDir string
+}
+
+// ValidMode returns an error if mode is not a known transfer mode.
+func ValidMode(mode string) error {
+	switch mode {
+	case ModeFile, ModeArchive, ModeDelta:
+		return nil
+	}
+	return fmt.Errorf("transfer mode must be one of: %s, %s, %s", ModeFile, ModeArchive, ModeDelta)
+}
+
+// file is a single entry of the local source tree.
+type file struct {
+	// rel is the slash separated path relative to the source directory
+	rel  string
+	path string
+	info os.FileInfo
+}
+
+// UploadDir uploads the directory src to dst on the guest. It follows the
+// same rules as packer.Communicator.UploadDir: unless src ends in a slash,
+// the base name of src is created inside dst.
+func UploadDir(ctx context.Context, ui packer.Ui, comm packer.Communicator, dst string, src string, exclude []string, config *Config) error {
+	if config.Mode == "" || config.Mode == ModeFile {
+		return comm.UploadDir(dst, src, exclude)
+	}
+	if err := ValidMode(config.Mode); err != nil {
+		return err
+	}
+
+	guestOS := config.GuestOSType
+	if guestOS == "" {
+		guestOS = provisioner.DefaultOSType
+	}
+
+	target := dst
+	if !strings.HasSuffix(src, "/") && !strings.HasSuffix(src, string(filepath.Separator)) {
+		target = strings.TrimRight(dst, `/\`) + "/" + filepath.Base(src)
+	}
+
+	files, err := walk(src, exclude)
+	if err != nil {
+		return err
+	}
+
+	if config.Mode == ModeDelta {
+		remote, err := remoteHashes(ctx, comm, guestOS, target)
+		if err != nil {
+			return fmt.Errorf("Error listing files on the guest: %s", err)
+		}
+
+		changed, err := filterUnchanged(files, remote)
+		if err != nil {
+			return err
+		}
+
+		ui.Message(fmt.Sprintf("%d of %d files changed", countFiles(changed), countFiles(files)))
+		if countFiles(changed) == 0 {
+			return nil
+		}
+		files = changed
+	}
+
+	stagingDir := config.StagingDir
+	if stagingDir == "" {
+		stagingDir = "/tmp"
+		if guestOS == provisioner.WindowsOSType {
+			stagingDir = "C:/Windows/Temp"
+		}
+	}
+
+	ext := ".tar.gz"
+	write := writeTarGz
+	if guestOS == provisioner.WindowsOSType {
+		ext = ".zip"
+		write = writeZip
+	}
+	archive := fmt.Sprintf("%s/packer-transfer-%s%s", strings.TrimRight(stagingDir, `/\`), uuid.TimeOrderedUUID(), ext)
+
+	// Stream the archive straight into the communicator
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(write(w, files))
+	}()
+
+	log.Printf("[INFO] Uploading %d entries from '%s' as archive '%s'", len(files), src, archive)
+	if err := comm.Upload(archive, r, nil); err != nil {
+		r.CloseWithError(err)
+		return fmt.Errorf("Error uploading archive: %s", err)
+	}
+
+	cmd := &packer.RemoteCmd{Command: extractCommand(guestOS, archive, target)}
+	if err := runCommand(ctx, comm, cmd, nil); err != nil {
+		return fmt.Errorf("Error unpacking archive on the guest: %s", err)
+	}
+
+	return nil
+}
+
+func walk(src string, exclude []string) ([]file, error) {
+	var files []file
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		for _, pattern := range exclude {
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			log.Printf("[WARN] Skipping '%s', it is not a regular file", path)
+			return nil
+		}
+
+		files = append(files, file{rel: rel, path: path, info: info})
+		return nil
+	})
+	return files, err
+}
+
+// filterUnchanged drops the files whose SHA256 matches the one reported
+// by the guest. Directories are always kept so that empty directories are
+// still created.
+func filterUnchanged(files []file, remote map[string]string) ([]file, error) {
+	var changed []file
+	for _, f := range files {
+		if f.info.IsDir() {
+			changed = append(changed, f)
+			continue
+		}
+
+		if h, ok := remote[f.rel]; ok {
+			local, err := hashFile(f.path)
+			if err != nil {
+				return nil, err
+			}
+			if local == h {
+				continue
+			}
+		}
+		changed = append(changed, f)
+	}
+	return changed, nil
+}
+
+func countFiles(files []file) int {
+	n := 0
+	for _, f := range files {
+		if !f.info.IsDir() {
+			n++
+		}
+	}
+	return n
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteHashes returns the SHA256 of every file below target on the guest,
+// keyed by slash separated path relative to target. A missing target
+// yields an empty map.
+func remoteHashes(ctx context.Context, comm packer.Communicator, guestOS string, target string) (map[string]string, error) {
+	var stdout bytes.Buffer
+	cmd := &packer.RemoteCmd{Command: hashCommand(guestOS, target)}
+	if err := runCommand(ctx, comm, cmd, &stdout); err != nil {
+		return nil, err
+	}
+	return parseHashes(&stdout), nil
+}
+
+func parseHashes(r io.Reader) map[string]string {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		rel := strings.TrimLeft(parts[1], " *")
+		rel = strings.TrimPrefix(filepath.ToSlash(strings.Replace(rel, `\`, "/", -1)), "./")
+		hashes[rel] = strings.ToLower(parts[0])
+	}
+	return hashes
+}
+
+func hashCommand(guestOS string, target string) string {
+	if guestOS == provisioner.WindowsOSType {
+		return winrm.Powershell(fmt.Sprintf(`$ProgressPreference='SilentlyContinue'
+$root = '%s'
+if (Test-Path -LiteralPath $root) {
+  $root = (Resolve-Path -LiteralPath $root).Path.TrimEnd('\')
+  Get-ChildItem -LiteralPath $root -Recurse -Force | Where-Object { -not $_.PSIsContainer } | ForEach-Object {
+    (Get-FileHash -Algorithm SHA256 -LiteralPath $_.FullName).Hash + ' ' + $_.FullName.Substring($root.Length + 1)
+  }
+}`, psQuote(target)))
+	}
+
+	return fmt.Sprintf(`if [ -d '%[1]s' ]; then cd '%[1]s' && `+
+		`if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; else h='shasum -a 256'; fi && `+
+		`find . -type f -exec $h {} +; fi`, shQuote(target))
+}
+
+func extractCommand(guestOS string, archive string, target string) string {
+	if guestOS == provisioner.WindowsOSType {
+		return winrm.Powershell(fmt.Sprintf(`$ProgressPreference='SilentlyContinue'
+$ErrorActionPreference='Stop'
+Expand-Archive -Force -LiteralPath '%s' -DestinationPath '%s'
+Remove-Item -Force -LiteralPath '%[1]s'`, psQuote(archive), psQuote(target)))
+	}
+
+	return fmt.Sprintf(`mkdir -p '%[2]s' && tar -xzf '%[1]s' -C '%[2]s'; e=$?; rm -f '%[1]s'; exit $e`,
+		shQuote(archive), shQuote(target))
+}
+
+// ShellQuote quotes s as a single argument for a POSIX shell.
+func ShellQuote(s string) string {
+	return "'" + shQuote(s) + "'"
+}
+
+func shQuote(s string) string {
+	return strings.Replace(s, "'", `'"'"'`, -1)
+}
+
+func psQuote(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+func runCommand(ctx context.Context, comm packer.Communicator, cmd *packer.RemoteCmd, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+	if code := cmd.Wait(); code != 0 {
+		return fmt.Errorf("command exited with status %d: %s", code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package transfer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
+)
+
+func testSourceDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "packer-transfer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "src", "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src", "empty"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src", "skip"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "src", "sub", "b.sh"), []byte("b"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "skip", "c.txt"), []byte("c"), 0644)
+	return dir
+}
+
+func tarEntries(t *testing.T, data string) map[string]*tar.Header {
+	gzr, err := gzip.NewReader(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(gzr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		entries[h.Name] = h
+	}
+	return entries
+}
+
+func keys(m map[string]*tar.Header) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestUploadDir_file(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := new(packer.MockCommunicator)
+	src := filepath.Join(dir, "src")
+	err := UploadDir(context.Background(), testUi(), comm, "/dst", src, nil, &Config{Mode: ModeFile})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if comm.UploadDirSrc != src || comm.UploadDirDst != "/dst" {
+		t.Fatalf("bad: %#v", comm)
+	}
+}
+
+func TestUploadDir_archive(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := new(packer.MockCommunicator)
+	err := UploadDir(context.Background(), testUi(), comm, "/dst", filepath.Join(dir, "src"), []string{"skip"}, &Config{Mode: ModeArchive})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(comm.UploadPath, "/tmp/packer-transfer-") || !strings.HasSuffix(comm.UploadPath, ".tar.gz") {
+		t.Fatalf("bad upload path: %s", comm.UploadPath)
+	}
+
+	entries := tarEntries(t, comm.UploadData)
+	expected := []string{"a.txt", "empty/", "sub/", "sub/b.sh"}
+	if !reflect.DeepEqual(keys(entries), expected) {
+		t.Fatalf("bad entries: %#v", keys(entries))
+	}
+	if entries["sub/b.sh"].Mode&0777 != 0755 {
+		t.Fatalf("mode not preserved: %o", entries["sub/b.sh"].Mode)
+	}
+
+	cmd := comm.StartCmd.Command
+	if !strings.Contains(cmd, "tar -xzf '"+comm.UploadPath+"' -C '/dst/src'") {
+		t.Fatalf("bad extract command: %s", cmd)
+	}
+}
+
+func TestUploadDir_archiveTrailingSlash(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := new(packer.MockCommunicator)
+	err := UploadDir(context.Background(), testUi(), comm, "/dst", filepath.Join(dir, "src")+"/", nil, &Config{Mode: ModeArchive})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(comm.StartCmd.Command, "-C '/dst'") {
+		t.Fatalf("bad extract command: %s", comm.StartCmd.Command)
+	}
+}
+
+func TestUploadDir_archiveWindows(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := new(packer.MockCommunicator)
+	config := &Config{
+		Mode:        ModeArchive,
+		GuestOSType: provisioner.WindowsOSType,
+	}
+	err := UploadDir(context.Background(), testUi(), comm, "C:/dst", filepath.Join(dir, "src"), nil, config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(comm.UploadPath, "C:/Windows/Temp/packer-transfer-") || !strings.HasSuffix(comm.UploadPath, ".zip") {
+		t.Fatalf("bad upload path: %s", comm.UploadPath)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader([]byte(comm.UploadData)), int64(len(comm.UploadData)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(zr.File) != 6 {
+		t.Fatalf("bad number of zip entries: %d", len(zr.File))
+	}
+
+	if !strings.HasPrefix(comm.StartCmd.Command, "powershell.exe -EncodedCommand ") {
+		t.Fatalf("bad extract command: %s", comm.StartCmd.Command)
+	}
+}
+
+func TestUploadDir_delta(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	// a.txt is up to date on the guest, sub/b.sh differs
+	comm := &packer.MockCommunicator{
+		StartStdout: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb  ./a.txt\n" +
+			"0000000000000000000000000000000000000000000000000000000000000000  ./sub/b.sh\n",
+	}
+	err := UploadDir(context.Background(), testUi(), comm, "/dst", filepath.Join(dir, "src"), []string{"skip"}, &Config{Mode: ModeDelta})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	entries := tarEntries(t, comm.UploadData)
+	expected := []string{"empty/", "sub/", "sub/b.sh"}
+	if !reflect.DeepEqual(keys(entries), expected) {
+		t.Fatalf("bad entries: %#v", keys(entries))
+	}
+}
+
+func TestUploadDir_deltaUnchanged(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := &packer.MockCommunicator{
+		StartStdout: "CA978112CA1BBDCAFAC231B39A23DC4DA786EFF8147C4E72B9807785AFEE48BB a.txt\n" +
+			"3E23E8160039594A33894F6564E1B1348BBD7A0088D42C4ACB73EEAED59C009D sub\\b.sh\n",
+	}
+	config := &Config{
+		Mode:        ModeDelta,
+		GuestOSType: provisioner.WindowsOSType,
+	}
+	err := UploadDir(context.Background(), testUi(), comm, "C:/dst", filepath.Join(dir, "src"), []string{"skip"}, config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if comm.UploadCalled {
+		t.Fatal("nothing should have been uploaded")
+	}
+}
+
+func TestUploadDir_extractFailure(t *testing.T) {
+	dir := testSourceDir(t)
+	defer os.RemoveAll(dir)
+
+	comm := &packer.MockCommunicator{
+		StartExitStatus: 2,
+		StartStderr:     "tar: not found",
+	}
+	err := UploadDir(context.Background(), testUi(), comm, "/dst", filepath.Join(dir, "src"), nil, &Config{Mode: ModeArchive})
+	if err == nil || !strings.Contains(err.Error(), "tar: not found") {
+		t.Fatalf("expected error, got: %v", err)
+	}
+}
+
+func TestValidMode(t *testing.T) {
+	for _, mode := range []string{ModeFile, ModeArchive, ModeDelta} {
+		if err := ValidMode(mode); err != nil {
+			t.Fatalf("%s should be valid: %s", mode, err)
+		}
+	}
+	if err := ValidMode("rsync"); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func testUi() *packer.BasicUi {
+	return &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+}
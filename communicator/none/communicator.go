@@ -25,6 +25,10 @@ func New(config string) (result *comm, err error) {
 }
 
 func (c *comm) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
+	if cmd.Pty != nil {
+		return errors.New("pseudo terminals are not supported when communicator = 'none'")
+	}
+
 	cmd.SetExited(0)
 	return
 }
@@ -0,0 +1,463 @@
+// Package qga implements a communicator that talks to qemu-guest-agent over
+// the host side of a virtio-serial channel.
+//
+// The agent speaks a line oriented JSON protocol. Commands are run with
+// guest-exec and guest-exec-status, and files are transferred with the
+// guest-file-* family of commands, so no network access to the guest is
+// required.
+package qga
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+// chunkSize is the amount of data moved per guest-file-read or
+// guest-file-write request.
+const chunkSize = 48 * 1024
+
+// Communicator represents the QEMU guest agent communicator
+type Communicator struct {
+	config *Config
+
+	conn net.Conn
+	dec  *json.Decoder
+
+	// The agent processes one request at a time, so every request and
+	// response pair is serialized through this lock.
+	l sync.Mutex
+
+	// stale is true when a request failed halfway, so its response may
+	// still come. The channel is synchronized again before the next one.
+	stale bool
+}
+
+type request struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Return json.RawMessage `json:"return"`
+	Error  *AgentError     `json:"error"`
+}
+
+// AgentError is an error reported by the guest agent.
+type AgentError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("guest agent error (%s): %s", e.Class, e.Desc)
+}
+
+type execStatus struct {
+	Exited   bool   `json:"exited"`
+	ExitCode *int   `json:"exitcode"`
+	Signal   *int   `json:"signal"`
+	OutData  string `json:"out-data"`
+	ErrData  string `json:"err-data"`
+}
+
+type fileRead struct {
+	Count  int    `json:"count"`
+	BufB64 string `json:"buf-b64"`
+	EOF    bool   `json:"eof"`
+}
+
+// New creates a new communicator implementation over the guest agent
+// socket. It verifies that the agent is responsive before returning.
+func New(config *Config) (*Communicator, error) {
+	if len(config.Shell) == 0 {
+		config.Shell = []string{"/bin/sh", "-c"}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = 500 * time.Millisecond
+	}
+
+	conn, err := net.Dial("unix", config.SocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Communicator{
+		config: config,
+		conn:   conn,
+	}
+
+	log.Printf("[DEBUG] synchronizing with guest agent on %s", config.SocketPath)
+	c.l.Lock()
+	err = c.sync()
+	c.l.Unlock()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the connection to the guest agent.
+func (c *Communicator) Close() error {
+	return c.conn.Close()
+}
+
+// Start implementation of communicator.Communicator interface
+func (c *Communicator) Start(ctx context.Context, rc *packer.RemoteCmd) error {
+	if rc.Pty != nil {
+		return errors.New("pseudo terminals are not supported by the guest agent")
+	}
+
+	args := map[string]interface{}{
+		"path":           c.config.Shell[0],
+		"arg":            append(c.config.Shell[1:len(c.config.Shell):len(c.config.Shell)], rc.Command),
+		"capture-output": true,
+	}
+
+	if rc.Stdin != nil {
+		input, err := ioutil.ReadAll(rc.Stdin)
+		if err != nil {
+			return fmt.Errorf("Error reading stdin: %s", err)
+		}
+		if len(input) > 0 {
+			args["input-data"] = base64.StdEncoding.EncodeToString(input)
+		}
+	}
+
+	var ret struct {
+		PID int `json:"pid"`
+	}
+	log.Printf("[INFO] starting remote command: %s", rc.Command)
+	if err := c.request("guest-exec", args, &ret); err != nil {
+		return err
+	}
+
+	go c.waitCommand(ctx, ret.PID, rc)
+	return nil
+}
+
+func (c *Communicator) waitCommand(ctx context.Context, pid int, rc *packer.RemoteCmd) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[INFO] stopped waiting for command '%s': %s", rc.Command, ctx.Err())
+			rc.SetExited(packer.CmdDisconnect)
+			return
+		case <-time.After(c.config.PollInterval):
+		}
+
+		var status execStatus
+		err := c.request("guest-exec-status", map[string]interface{}{"pid": pid}, &status)
+		if err != nil {
+			log.Printf("[ERROR] Error polling guest agent for command status: %s", err)
+			rc.SetExited(packer.CmdDisconnect)
+			return
+		}
+		if !status.Exited {
+			continue
+		}
+
+		writeData(rc.Stdout, status.OutData)
+		writeData(rc.Stderr, status.ErrData)
+
+		code := 0
+		switch {
+		case status.ExitCode != nil:
+			code = *status.ExitCode
+		case status.Signal != nil:
+			code = 128 + *status.Signal
+		}
+		log.Printf("[INFO] command '%s' exited with code: %d", rc.Command, code)
+		rc.SetExited(code)
+		return
+	}
+}
+
+func writeData(w io.Writer, data string) {
+	if w == nil || data == "" {
+		return
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		log.Printf("[WARN] Error decoding command output: %s", err)
+		return
+	}
+	w.Write(b)
+}
+
+// Upload implementation of communicator.Communicator interface
+func (c *Communicator) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	if strings.HasSuffix(path, "/") && fi != nil {
+		path += filepath.Base((*fi).Name())
+	}
+	log.Printf("Uploading file to '%s'", path)
+
+	handle, err := c.openFile(path, "w")
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, rerr := input.Read(buf)
+		if n > 0 {
+			err := c.request("guest-file-write", map[string]interface{}{
+				"handle":  handle,
+				"buf-b64": base64.StdEncoding.EncodeToString(buf[:n]),
+			}, nil)
+			if err != nil {
+				c.closeFile(handle)
+				return fmt.Errorf("Error writing '%s': %s", path, err)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			c.closeFile(handle)
+			return rerr
+		}
+	}
+
+	if err := c.closeFile(handle); err != nil {
+		return err
+	}
+
+	if fi != nil {
+		mode := fmt.Sprintf("chmod %04o %s", (*fi).Mode().Perm(), shellQuote(path))
+		if err := c.run(mode); err != nil {
+			log.Printf("[WARN] Unable to set mode on '%s': %s", path, err)
+		}
+	}
+
+	return nil
+}
+
+// UploadDir implementation of communicator.Communicator interface
+func (c *Communicator) UploadDir(dst string, src string, exclude []string) error {
+	if !strings.HasSuffix(src, "/") {
+		dst = filepath.ToSlash(filepath.Join(dst, filepath.Base(src)))
+	}
+	log.Printf("Uploading dir '%s' to '%s'", src, dst)
+
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := dst
+		if rel != "." {
+			rel = filepath.ToSlash(rel)
+			for _, pattern := range exclude {
+				if ok, _ := filepath.Match(pattern, rel); ok {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			target = dst + "/" + rel
+		}
+
+		if info.IsDir() {
+			return c.run("mkdir -p " + shellQuote(target))
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return c.Upload(target, f, &info)
+	})
+}
+
+// Download implementation of communicator.Communicator interface
+func (c *Communicator) Download(src string, dst io.Writer) error {
+	handle, err := c.openFile(src, "r")
+	if err != nil {
+		return err
+	}
+	defer c.closeFile(handle)
+
+	for {
+		var ret fileRead
+		err := c.request("guest-file-read", map[string]interface{}{
+			"handle": handle,
+			"count":  chunkSize,
+		}, &ret)
+		if err != nil {
+			return fmt.Errorf("Error reading '%s': %s", src, err)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(ret.BufB64)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(b); err != nil {
+			return err
+		}
+
+		if ret.EOF || ret.Count == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *Communicator) DownloadDir(src string, dst string, exclude []string) error {
+	return fmt.Errorf("The QEMU guest agent communicator doesn't support download dir.")
+}
+
+func (c *Communicator) openFile(path string, mode string) (int, error) {
+	var handle int
+	err := c.request("guest-file-open", map[string]interface{}{
+		"path": path,
+		"mode": mode,
+	}, &handle)
+	if err != nil {
+		return 0, fmt.Errorf("Error opening '%s': %s", path, err)
+	}
+	return handle, nil
+}
+
+func (c *Communicator) closeFile(handle int) error {
+	return c.request("guest-file-close", map[string]interface{}{"handle": handle}, nil)
+}
+
+// run runs a command on the guest and returns an error if it exits with a
+// non-zero status.
+func (c *Communicator) run(command string) error {
+	var stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stderr:  &stderr,
+	}
+	if err := c.Start(context.TODO(), cmd); err != nil {
+		return err
+	}
+	if code := cmd.Wait(); code != 0 {
+		return fmt.Errorf("'%s' exited with code %d: %s", command, code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// shellQuote quotes s as a single word for the shell of the guest.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// sync discards any stale responses that may be buffered in the channel,
+// from a previous connection or a request that failed, using
+// guest-sync-delimited with a random identifier. The agent precedes its
+// answer with a 0xFF byte, which never appears in JSON, so anything before
+// it is skipped. The lock must be held.
+func (c *Communicator) sync() error {
+	id := rand.New(rand.NewSource(time.Now().UnixNano())).Int31()
+
+	c.conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	// A 0xFF byte also resets the parser of the agent, in case a request
+	// was only partly written.
+	if _, err := c.conn.Write([]byte{0xff}); err != nil {
+		return err
+	}
+	err := json.NewEncoder(c.conn).Encode(&request{
+		Execute:   "guest-sync-delimited",
+		Arguments: map[string]interface{}{"id": id},
+	})
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(c.conn)
+	for {
+		if _, err := r.ReadBytes(0xff); err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(r)
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			return err
+		}
+		var ret int32
+		if json.Unmarshal(resp.Return, &ret) == nil && ret == id {
+			c.dec = dec
+			c.stale = false
+			return nil
+		}
+		log.Printf("[DEBUG] discarding stale guest agent response: %s", resp.Return)
+		r = bufio.NewReader(io.MultiReader(dec.Buffered(), r))
+	}
+}
+
+// request sends a command to the agent and decodes the return value into
+// ret, if it is not nil.
+func (c *Communicator) request(command string, args interface{}, ret interface{}) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.stale {
+		log.Printf("[DEBUG] synchronizing with guest agent after a failed request")
+		if err := c.sync(); err != nil {
+			return fmt.Errorf("Error synchronizing with the guest agent: %s", err)
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	err := json.NewEncoder(c.conn).Encode(&request{
+		Execute:   command,
+		Arguments: args,
+	})
+	if err != nil {
+		c.stale = true
+		return err
+	}
+
+	var resp response
+	if err := c.dec.Decode(&resp); err != nil {
+		// The decoder keeps failing once it failed, and the answer may
+		// still come, so both are replaced by the next sync.
+		c.stale = true
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if ret == nil {
+		return nil
+	}
+	if len(resp.Return) == 0 {
+		return errors.New("guest agent returned an empty response")
+	}
+	return json.Unmarshal(resp.Return, ret)
+}
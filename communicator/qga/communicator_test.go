@@ -0,0 +1,322 @@
+package qga
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+// fakeAgent is a minimal qemu-guest-agent implementation that keeps files
+// in memory and answers every command with a canned result.
+type fakeAgent struct {
+	l        net.Listener
+	mu       sync.Mutex
+	files    map[string]*bytes.Buffer
+	handles  map[int]string
+	commands []string
+}
+
+func newFakeAgent(t *testing.T) (*fakeAgent, string) {
+	dir, err := ioutil.TempDir("", "packer-qga")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(dir, "qga.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	a := &fakeAgent{
+		l:       l,
+		files:   make(map[string]*bytes.Buffer),
+		handles: make(map[int]string),
+	}
+	go a.serve()
+	return a, path
+}
+
+func (a *fakeAgent) Close() {
+	a.l.Close()
+	os.RemoveAll(filepath.Dir(a.l.Addr().String()))
+}
+
+func (a *fakeAgent) serve() {
+	conn, err := a.l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// A stale response left over from a previous client
+	conn.Write([]byte(`{"return": {}}` + "\n"))
+
+	dec := json.NewDecoder(&resetReader{r: conn})
+	enc := json.NewEncoder(conn)
+	for {
+		var req struct {
+			Execute   string                 `json:"execute"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		if req.Execute == "guest-exec" {
+			if argv := req.Arguments["arg"].([]interface{}); argv[len(argv)-1] == "slow" {
+				time.Sleep(700 * time.Millisecond)
+			}
+		}
+		if req.Execute == "guest-sync-delimited" {
+			conn.Write([]byte{0xff})
+		}
+		ret, agentErr := a.handle(req.Execute, req.Arguments)
+		if agentErr != nil {
+			enc.Encode(map[string]interface{}{"error": agentErr})
+			continue
+		}
+		enc.Encode(map[string]interface{}{"return": ret})
+	}
+}
+
+// resetReader drops the 0xFF bytes clients send to reset the parser of the
+// agent.
+type resetReader struct {
+	r io.Reader
+}
+
+func (r *resetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	return copy(p, bytes.Replace(p[:n], []byte{0xff}, nil, -1)), err
+}
+
+func (a *fakeAgent) handle(cmd string, args map[string]interface{}) (interface{}, *AgentError) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch cmd {
+	case "guest-sync", "guest-sync-delimited":
+		return args["id"], nil
+	case "guest-exec":
+		argv := args["arg"].([]interface{})
+		a.commands = append(a.commands, argv[len(argv)-1].(string))
+		return map[string]int{"pid": len(a.commands)}, nil
+	case "guest-exec-status":
+		command := a.commands[int(args["pid"].(float64))-1]
+		if command == "exit 3" {
+			return map[string]interface{}{"exited": true, "exitcode": 3}, nil
+		}
+		return map[string]interface{}{
+			"exited":   true,
+			"exitcode": 0,
+			"out-data": base64.StdEncoding.EncodeToString([]byte(command)),
+		}, nil
+	case "guest-file-open":
+		path := args["path"].(string)
+		if args["mode"] == "w" {
+			a.files[path] = new(bytes.Buffer)
+		} else if _, ok := a.files[path]; !ok {
+			return nil, &AgentError{Class: "GenericError", Desc: "No such file"}
+		}
+		h := len(a.handles) + 1000
+		a.handles[h] = path
+		return h, nil
+	case "guest-file-write":
+		path := a.handles[int(args["handle"].(float64))]
+		b, _ := base64.StdEncoding.DecodeString(args["buf-b64"].(string))
+		a.files[path].Write(b)
+		return map[string]int{"count": len(b)}, nil
+	case "guest-file-read":
+		path := a.handles[int(args["handle"].(float64))]
+		b := a.files[path].Next(int(args["count"].(float64)))
+		return map[string]interface{}{
+			"count":   len(b),
+			"buf-b64": base64.StdEncoding.EncodeToString(b),
+			"eof":     a.files[path].Len() == 0,
+		}, nil
+	case "guest-file-close":
+		delete(a.handles, int(args["handle"].(float64)))
+		return map[string]interface{}{}, nil
+	}
+
+	return nil, &AgentError{Class: "CommandNotFound", Desc: cmd}
+}
+
+func newTestCommunicator(t *testing.T) (*Communicator, *fakeAgent) {
+	agent, path := newFakeAgent(t)
+	comm, err := New(&Config{
+		SocketPath:   path,
+		Timeout:      5 * time.Second,
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		agent.Close()
+		t.Fatalf("error creating communicator: %s", err)
+	}
+	return comm, agent
+}
+
+func TestCommunicator_impl(t *testing.T) {
+	var _ packer.Communicator = new(Communicator)
+}
+
+func TestStart(t *testing.T) {
+	comm, agent := newTestCommunicator(t)
+	defer agent.Close()
+	defer comm.Close()
+
+	var stdout bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: "echo foo",
+		Stdout:  &stdout,
+	}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("error executing remote command: %s", err)
+	}
+	if code := cmd.Wait(); code != 0 {
+		t.Fatalf("bad exit code: %d", code)
+	}
+	if stdout.String() != "echo foo" {
+		t.Fatalf("bad command output: %q", stdout.String())
+	}
+
+	cmd = &packer.RemoteCmd{Command: "exit 3"}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("error executing remote command: %s", err)
+	}
+	if code := cmd.Wait(); code != 3 {
+		t.Fatalf("bad exit code: %d", code)
+	}
+}
+
+func TestUploadDownload(t *testing.T) {
+	comm, agent := newTestCommunicator(t)
+	defer agent.Close()
+	defer comm.Close()
+
+	payload := strings.Repeat("packer", chunkSize/2)
+	if err := comm.Upload("/tmp/payload", strings.NewReader(payload), nil); err != nil {
+		t.Fatalf("error uploading file: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := comm.Download("/tmp/payload", &out); err != nil {
+		t.Fatalf("error downloading file: %s", err)
+	}
+	if out.String() != payload {
+		t.Fatalf("downloaded content does not match uploaded content")
+	}
+
+	err := comm.Download("/tmp/missing", &out)
+	if err == nil || !strings.Contains(err.Error(), "No such file") {
+		t.Fatalf("expected agent error, got: %v", err)
+	}
+}
+
+func TestUploadDir(t *testing.T) {
+	comm, agent := newTestCommunicator(t)
+	defer agent.Close()
+	defer comm.Close()
+
+	src, err := ioutil.TempDir("", "packer-qga-src")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(src)
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.MkdirAll(filepath.Join(src, "cache"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "sub", "file.log"), []byte("log"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "cache", "file"), []byte("cache"), 0644)
+
+	if err := comm.UploadDir("/dst", src, []string{"cache", "*/*.log"}); err != nil {
+		t.Fatalf("error uploading dir: %s", err)
+	}
+
+	base := "/dst/" + filepath.Base(src)
+	if f, ok := agent.files[base+"/sub/file"]; !ok || f.String() != "hello" {
+		t.Fatalf("file not uploaded: %#v", agent.files)
+	}
+
+	expected := []string{
+		"mkdir -p '" + base + "'",
+		"mkdir -p '" + base + "/sub'",
+		"chmod 0644 '" + base + "/sub/file'",
+	}
+	if strings.Join(agent.commands, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("bad commands: %#v", agent.commands)
+	}
+}
+
+func TestRequest_resync(t *testing.T) {
+	agent, path := newFakeAgent(t)
+	defer agent.Close()
+	comm, err := New(&Config{
+		SocketPath:   path,
+		Timeout:      500 * time.Millisecond,
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error creating communicator: %s", err)
+	}
+	defer comm.Close()
+
+	// The agent answers after the request timed out
+	if err := comm.Start(context.Background(), &packer.RemoteCmd{Command: "slow"}); err == nil {
+		t.Fatal("the request should time out")
+	}
+
+	// The late answer isn't taken for the answer of the next request
+	var stdout bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: "echo foo",
+		Stdout:  &stdout,
+	}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("error executing remote command: %s", err)
+	}
+	if code := cmd.Wait(); code != 0 {
+		t.Fatalf("bad exit code: %d", code)
+	}
+	if stdout.String() != "echo foo" {
+		t.Fatalf("bad command output: %q", stdout.String())
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"/tmp/file":        "'/tmp/file'",
+		"/tmp/it's here":   `'/tmp/it'"'"'s here'`,
+		"/tmp/'; rm -rf /": `'/tmp/'"'"'; rm -rf /'`,
+	}
+	for in, expected := range cases {
+		if out := shellQuote(in); out != expected {
+			t.Fatalf("%s: bad quoting: %s", in, out)
+		}
+	}
+}
+
+func TestCommunicatorStart_pty(t *testing.T) {
+	comm, agent := newTestCommunicator(t)
+	defer agent.Close()
+	defer comm.Close()
+
+	cmd := &packer.RemoteCmd{Command: "sh", Pty: &packer.PtyConfig{Term: "xterm"}}
+	if err := comm.Start(context.Background(), cmd); err == nil {
+		t.Fatal("should reject pseudo terminals")
+	}
+	if len(agent.commands) != 0 {
+		t.Fatalf("should not run the command: %#v", agent.commands)
+	}
+}
@@ -0,0 +1,24 @@
+package qga
+
+import (
+	"time"
+)
+
+// Config is used to configure the QEMU guest agent connection
+type Config struct {
+	// SocketPath is the path to the host side of the virtio-serial
+	// channel that qemu-guest-agent is listening on.
+	SocketPath string
+
+	// Shell is the interpreter, with any leading arguments, that remote
+	// commands are passed to. Defaults to "/bin/sh -c".
+	Shell []string
+
+	// Timeout is the maximum amount of time to wait for a single agent
+	// request to complete.
+	Timeout time.Duration
+
+	// PollInterval is how often guest-exec-status is polled while a
+	// command is running.
+	PollInterval time.Duration
+}
@@ -12,10 +12,13 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/hashicorp/packer/common/retry"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/packer/tmp"
 	"github.com/pkg/sftp"
@@ -28,11 +31,36 @@ import (
 // out period is 1 minute. You can change it with Config.HandshakeTimeout.
 var ErrHandshakeTimeout = fmt.Errorf("Timeout during SSH handshake")
 
+// keepAliveTimeout is the minimum time we wait for the remote end to answer
+// a connection keepalive before considering the connection dead. A dead idle
+// connection is dropped after keepAliveFailures times the largest of this and
+// KeepAliveInterval, 30 seconds with the default interval.
+const keepAliveTimeout = 10 * time.Second
+
+// keepAliveFailures is how many connection keepalives in a row must go
+// unanswered before an idle connection is dropped.
+const keepAliveFailures = 3
+
 type comm struct {
-	client  *ssh.Client
-	config  *Config
-	conn    net.Conn
-	address string
+	// l protects client, conn, sftpClient and sessions. The connection is
+	// replaced every time we reconnect.
+	l          sync.Mutex
+	client     *ssh.Client
+	config     *Config
+	conn       net.Conn
+	address    string
+	sftpClient *sftp.Client
+
+	// done is closed along with the connection, to stop its keepalive.
+	done chan struct{}
+
+	// sessions counts the commands and file transfers in progress. A
+	// connection with sessions in progress is never dropped.
+	sessions int
+
+	// agentAuth is true once the agent forwarding auth callback was added
+	// to the SSH config, so reconnects don't add it again.
+	agentAuth bool
 }
 
 // Config is the structure used to configure the SSH communicator.
@@ -59,11 +87,18 @@ type Config struct {
 	UseSftp bool
 
 	// KeepAliveInterval sets how often we send a channel request to the
-	// server. A value < 0 disables.
+	// server. A value < 0 disables. An idle connection that stops answering
+	// is dropped after three unanswered requests, each given the largest of
+	// this interval and 10 seconds.
 	KeepAliveInterval time.Duration
 
 	// Timeout is how long to wait for a read or write to succeed.
 	Timeout time.Duration
+
+	// ReconnectTimeout is how long to keep trying to reconnect when the
+	// connection is lost, for instance because the remote host rebooted.
+	// Zero means we only try once.
+	ReconnectTimeout time.Duration
 }
 
 // Creates a new packer.Communicator implementation over SSH. This takes
@@ -75,7 +110,10 @@ func New(address string, config *Config) (result *comm, err error) {
 		address: address,
 	}
 
-	if err = result.reconnect(); err != nil {
+	result.l.Lock()
+	err = result.reconnect()
+	result.l.Unlock()
+	if err != nil {
 		result = nil
 		return
 	}
@@ -84,17 +122,36 @@ func New(address string, config *Config) (result *comm, err error) {
 }
 
 func (c *comm) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
-	session, err := c.newSession()
+	session, client, err := c.newSession(ctx)
 	if err != nil {
 		return
 	}
+	done := c.startSession()
+	defer func() {
+		if err != nil {
+			session.Close()
+			done()
+		}
+	}()
 
 	// Setup our session
 	session.Stdin = cmd.Stdin
 	session.Stdout = cmd.Stdout
 	session.Stderr = cmd.Stderr
 
-	if c.config.Pty {
+	if cmd.Pty != nil {
+		// Request a PTY for an interactive session, which echoes what is
+		// typed
+		termModes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+
+		if err = session.RequestPty(cmd.Pty.Term, cmd.Pty.Height, cmd.Pty.Width, termModes); err != nil {
+			return
+		}
+	} else if c.config.Pty {
 		// Request a PTY
 		termModes := ssh.TerminalModes{
 			ssh.ECHO:          0,     // do not echo
@@ -133,6 +190,7 @@ func (c *comm) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
 		defer session.Close()
 
 		err := session.Wait()
+		done()
 		exitStatus := 0
 		if err != nil {
 			switch err.(type) {
@@ -142,6 +200,14 @@ func (c *comm) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
 			case *ssh.ExitMissingError:
 				log.Printf("[ERROR] Remote command exited without exit status or exit signal.")
 				exitStatus = packer.CmdDisconnect
+
+				// This usually means the remote host is going away, e.g.
+				// for a reboot. Drop the connection if it no longer
+				// answers so the next command reconnects.
+				if err := c.ping(client); err != nil {
+					log.Printf("[INFO] SSH connection lost: %s", err)
+					c.drop(client)
+				}
 			default:
 				log.Printf("[ERROR] Error occurred waiting for ssh session: %s", err.Error())
 			}
@@ -152,6 +218,7 @@ func (c *comm) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
 }
 
 func (c *comm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	path = remotePath(path, c.config.UseSftp)
 	if c.config.UseSftp {
 		return c.sftpUploadSession(path, input, fi)
 	} else {
@@ -160,6 +227,7 @@ func (c *comm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
 }
 
 func (c *comm) UploadDir(dst string, src string, excl []string) error {
+	dst = remotePath(dst, c.config.UseSftp)
 	log.Printf("[DEBUG] Upload dir '%s' to '%s'", src, dst)
 	if c.config.UseSftp {
 		return c.sftpUploadDirSession(dst, src, excl)
@@ -169,6 +237,7 @@ func (c *comm) UploadDir(dst string, src string, excl []string) error {
 }
 
 func (c *comm) DownloadDir(src string, dst string, excl []string) error {
+	src = remotePath(src, false)
 	log.Printf("[DEBUG] Download dir '%s' to '%s'", src, dst)
 	scpFunc := func(w io.Writer, stdoutR *bufio.Reader) error {
 		dirStack := []string{dst}
@@ -241,45 +310,230 @@ func (c *comm) DownloadDir(src string, dst string, excl []string) error {
 }
 
 func (c *comm) Download(path string, output io.Writer) error {
+	path = remotePath(path, c.config.UseSftp)
 	if c.config.UseSftp {
 		return c.sftpDownloadSession(path, output)
 	}
 	return c.scpDownloadSession(path, output)
 }
 
-func (c *comm) newSession() (session *ssh.Session, err error) {
+// windowsPathRe matches remote paths that start with a drive letter.
+var windowsPathRe = regexp.MustCompile(`^/?[a-zA-Z]:[/\\]`)
+
+// remotePath translates Windows paths such as C:\Windows\Temp to the form
+// the OpenSSH server for Windows understands: forward slashes and, for
+// sftp, a leading slash. Other paths are returned unchanged.
+func remotePath(path string, useSftp bool) string {
+	if !windowsPathRe.MatchString(path) {
+		return path
+	}
+
+	path = strings.Replace(path, `\`, "/", -1)
+	if useSftp {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return path
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// newSession opens a session on the current connection, reconnecting if
+// the connection is gone. It returns the client the session belongs to.
+func (c *comm) newSession(ctx context.Context) (*ssh.Session, *ssh.Client, error) {
 	log.Println("[DEBUG] Opening new ssh session")
-	if c.client == nil {
-		err = errors.New("client not available")
+	client := c.currentClient()
+	if client != nil {
+		session, err := client.NewSession()
+		if err == nil {
+			return session, client, nil
+		}
+		log.Printf("[ERROR] ssh session open error: '%s', attempting reconnect", err)
 	} else {
-		session, err = c.client.NewSession()
+		log.Printf("[ERROR] ssh session open error: client not available, attempting reconnect")
 	}
 
+	client, err := c.reconnectWithRetry(ctx, client)
 	if err != nil {
-		log.Printf("[ERROR] ssh session open error: '%s', attempting reconnect", err)
-		if err := c.reconnect(); err != nil {
-			return nil, err
+		return nil, nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, client, nil
+}
+
+// currentClient returns the SSH client of the current connection.
+func (c *comm) currentClient() *ssh.Client {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.client
+}
+
+// startSession records a command or file transfer in progress, until the
+// returned function is called.
+func (c *comm) startSession() func() {
+	c.l.Lock()
+	c.sessions++
+	c.l.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.l.Lock()
+			c.sessions--
+			c.l.Unlock()
+		})
+	}
+}
+
+// reconnectWithRetry replaces the connection of the failed client. When
+// ReconnectTimeout is set, it keeps retrying for that long so that a remote
+// host that is rebooting has time to come back. The lock is only held
+// during each attempt, and a connection re-established meanwhile by
+// another caller is used as is.
+func (c *comm) reconnectWithRetry(ctx context.Context, failed *ssh.Client) (*ssh.Client, error) {
+	attempt := func(context.Context) error {
+		c.l.Lock()
+		defer c.l.Unlock()
+
+		if c.client != nil && c.client != failed {
+			return nil
 		}
+		return c.reconnect()
+	}
 
-		if c.client == nil {
-			return nil, errors.New("client not available")
-		} else {
-			return c.client.NewSession()
+	var err error
+	if c.config.ReconnectTimeout <= 0 {
+		err = attempt(ctx)
+	} else {
+		backoff := &retry.Backoff{
+			InitialBackoff: 1 * time.Second,
+			MaxBackoff:     15 * time.Second,
+			Multiplier:     2,
 		}
+		err = retry.Config{
+			StartTimeout: c.config.ReconnectTimeout,
+			RetryDelay:   backoff.Linear,
+		}.Run(ctx, attempt)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return session, nil
+	client := c.currentClient()
+	if client == nil {
+		return nil, errors.New("client not available")
+	}
+	return client, nil
 }
 
-func (c *comm) reconnect() (err error) {
+// drop closes the connection if client is still the one in use and no
+// session is in progress, so that the next operation reconnects instead of
+// using a dead connection.
+func (c *comm) drop(client *ssh.Client) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if client == nil || c.client != client {
+		return
+	}
+	if c.sessions > 0 {
+		log.Printf("[INFO] Not dropping the SSH connection, %d sessions are in progress", c.sessions)
+		return
+	}
+	c.closeLocked()
+}
+
+func (c *comm) closeLocked() {
+	if c.sftpClient != nil {
+		c.sftpClient.Close()
+	}
 	if c.conn != nil {
 		// Ignore errors here because we don't care if it fails
 		c.conn.Close()
 	}
+	if c.done != nil {
+		close(c.done)
+	}
 
-	// Set the conn and client to nil since we'll recreate it
+	c.done = nil
+	c.sftpClient = nil
 	c.conn = nil
 	c.client = nil
+}
+
+// ping sends a global request over the connection of client and waits for
+// the answer. Any answer will do, servers are free to reject the request.
+func (c *comm) ping(client *ssh.Client) error {
+	if client == nil {
+		return errors.New("client not available")
+	}
+
+	timeout := c.config.KeepAliveInterval
+	if timeout < keepAliveTimeout {
+		timeout = keepAliveTimeout
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no answer to keepalive after %s", timeout)
+	}
+}
+
+// keepAlive pings the connection of client every KeepAliveInterval while
+// it is idle, and drops it once it missed keepAliveFailures pings in a
+// row. The sessions in progress have their own keepalives, and a busy
+// remote host may be slow to answer, so a connection with sessions in
+// progress is left alone. It returns once done is closed.
+func (c *comm) keepAlive(client *ssh.Client, done <-chan struct{}) {
+	t := time.NewTicker(c.config.KeepAliveInterval)
+	defer t.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		c.l.Lock()
+		sessions := c.sessions
+		c.l.Unlock()
+		if sessions > 0 {
+			failures = 0
+			continue
+		}
+
+		if err := c.ping(client); err != nil {
+			failures++
+			log.Printf("[INFO] SSH keepalive failed (%d/%d): %s", failures, keepAliveFailures, err)
+			if failures < keepAliveFailures {
+				continue
+			}
+			log.Printf("[INFO] SSH connection lost")
+			c.drop(client)
+			return
+		}
+		failures = 0
+	}
+}
+
+// reconnect replaces the current connection. The lock must be held.
+func (c *comm) reconnect() (err error) {
+	// Close the current connection, we'll recreate it
+	c.closeLocked()
 
 	log.Printf("[DEBUG] reconnecting to TCP connection for SSH")
 	c.conn, err = c.config.Connection()
@@ -342,6 +596,10 @@ func (c *comm) reconnect() (err error) {
 	log.Printf("[DEBUG] handshake complete!")
 	if sshConn != nil {
 		c.client = ssh.NewClient(sshConn, sshChan, req)
+		c.done = make(chan struct{})
+		if c.config.KeepAliveInterval > 0 {
+			go c.keepAlive(c.client, c.done)
+		}
 	}
 	c.connectToAgent()
 
@@ -378,14 +636,17 @@ func (c *comm) connectToAgent() {
 		return
 	}
 
-	// add callback for forwarding agent to SSH config
-	// XXX - might want to handle reconnects appending multiple callbacks
-	auth := ssh.PublicKeysCallback(forwardingAgent.Signers)
-	c.config.SSHConfig.Auth = append(c.config.SSHConfig.Auth, auth)
+	// add callback for forwarding agent to SSH config, only once since we
+	// come here on every reconnect
+	if !c.agentAuth {
+		auth := ssh.PublicKeysCallback(forwardingAgent.Signers)
+		c.config.SSHConfig.Auth = append(c.config.SSHConfig.Auth, auth)
+		c.agentAuth = true
+	}
 	agent.ForwardToAgent(c.client, forwardingAgent)
 
 	// Setup a session to request agent forwarding
-	session, err := c.newSession()
+	session, err := c.client.NewSession()
 	if err != nil {
 		return
 	}
@@ -521,21 +782,62 @@ func (c *comm) sftpDownloadSession(path string, output io.Writer) error {
 }
 
 func (c *comm) sftpSession(f func(*sftp.Client) error) error {
-	client, err := c.newSftpClient()
+	client, err := c.sftp(context.Background())
 	if err != nil {
 		return fmt.Errorf("sftpSession error: %s", err.Error())
 	}
-	defer client.Close()
 
-	return f(client)
+	done := c.startSession()
+	err = f(client)
+	done()
+	if err != nil {
+		// Don't reuse a client that may be broken
+		c.l.Lock()
+		if c.sftpClient == client {
+			c.sftpClient.Close()
+			c.sftpClient = nil
+		}
+		c.l.Unlock()
+	}
+	return err
 }
 
-func (c *comm) newSftpClient() (*sftp.Client, error) {
-	session, err := c.newSession()
+// sftp returns the SFTP client of the current connection, starting the
+// subsystem only the first time.
+func (c *comm) sftp(ctx context.Context) (*sftp.Client, error) {
+	c.l.Lock()
+	client := c.sftpClient
+	c.l.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	session, sshClient, err := c.newSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err = newSftpClient(session)
 	if err != nil {
+		session.Close()
 		return nil, err
 	}
 
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.client != sshClient || c.sftpClient != nil {
+		// The connection was replaced, or another caller started the
+		// subsystem meanwhile.
+		client.Close()
+		if c.sftpClient == nil {
+			return nil, errors.New("SSH connection lost while starting sftp")
+		}
+		return c.sftpClient, nil
+	}
+	c.sftpClient = client
+	return client, nil
+}
+
+func newSftpClient(session *ssh.Session) (*sftp.Client, error) {
 	if err := session.RequestSubsystem("sftp"); err != nil {
 		return nil, err
 	}
@@ -667,11 +969,12 @@ func (c *comm) scpDownloadSession(path string, output io.Writer) error {
 }
 
 func (c *comm) scpSession(scpCommand string, f func(io.Writer, *bufio.Reader) error) error {
-	session, err := c.newSession()
+	session, _, err := c.newSession(context.Background())
 	if err != nil {
 		return err
 	}
 	defer session.Close()
+	defer c.startSession()()
 
 	// Get a pipe to stdin so that we can send data down
 	stdinW, err := session.StdinPipe()
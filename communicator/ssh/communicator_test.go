@@ -5,12 +5,19 @@ package ssh
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/packer/packer"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -227,3 +234,326 @@ func TestHandshakeTimeout(t *testing.T) {
 		t.Fatalf("Expected handshake timeout, got: %s", err)
 	}
 }
+
+// mockServer is an SSH server that runs no commands but answers them with a
+// zero exit status, serves sftp from the local filesystem and accepts any
+// number of connections.
+type mockServer struct {
+	address string
+
+	l     sync.Mutex
+	conns []*ssh.ServerConn
+	sftps int
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	s := &mockServer{address: l.Addr().String()}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+
+	return s
+}
+
+func (s *mockServer) serve(c net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, serverConfig)
+	if err != nil {
+		return
+	}
+	s.l.Lock()
+	s.conns = append(s.conns, conn)
+	s.l.Unlock()
+
+	go func() {
+		for req := range reqs {
+			req.Reply(false, nil)
+		}
+	}()
+
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				switch req.Type {
+				case "exec":
+					req.Reply(true, nil)
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					return
+				case "subsystem":
+					req.Reply(true, nil)
+					s.l.Lock()
+					s.sftps++
+					s.l.Unlock()
+
+					server, err := sftp.NewServer(channel, channel)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+// closeConns closes all the connections, as a reboot of the server would.
+func (s *mockServer) closeConns() {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *mockServer) stats() (int, int) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return len(s.conns), s.sftps
+}
+
+func testMockServerConfig(s *mockServer) *Config {
+	return &Config{
+		Connection: ConnectFunc("tcp", s.address),
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		},
+		DisableAgentForwarding: true,
+		ReconnectTimeout:       10 * time.Second,
+	}
+}
+
+func TestStart_reconnect(t *testing.T) {
+	server := newMockServer(t)
+	client, err := New(server.address, testMockServerConfig(server))
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	server.closeConns()
+	client.drop(client.currentClient())
+
+	cmd := &packer.RemoteCmd{Command: "true"}
+	if err := cmd.RunWithUi(context.Background(), client, &packer.BasicUi{Writer: new(bytes.Buffer)}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cmd.ExitStatus() != 0 {
+		t.Fatalf("bad exit status: %d", cmd.ExitStatus())
+	}
+
+	if conns, _ := server.stats(); conns != 2 {
+		t.Fatalf("expected a new connection, got %d connections", conns)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := newMockServer(t)
+	client, err := New(server.address, testMockServerConfig(server))
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	sshClient := client.currentClient()
+	if err := client.ping(sshClient); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	server.closeConns()
+	if err := client.ping(sshClient); err == nil {
+		t.Fatal("ping should fail on a closed connection")
+	}
+}
+
+func TestKeepAlive_stop(t *testing.T) {
+	server := newMockServer(t)
+	config := testMockServerConfig(server)
+	config.KeepAliveInterval = time.Hour
+	client, err := New(server.address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	client.l.Lock()
+	done := client.done
+	client.l.Unlock()
+
+	// The keepalive of a connection stops with it
+	client.drop(client.currentClient())
+	select {
+	case <-done:
+	default:
+		t.Fatal("the keepalive should be stopped")
+	}
+}
+
+func TestReconnect_unlocked(t *testing.T) {
+	server := newMockServer(t)
+	config := testMockServerConfig(server)
+	client, err := New(server.address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// The remote host is gone for good
+	config.Connection = func() (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	server.closeConns()
+	client.drop(client.currentClient())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.newSession(ctx)
+		errCh <- err
+	}()
+
+	// Other callers aren't blocked while it retries
+	time.Sleep(100 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		client.currentClient()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the lock is held while reconnecting")
+	}
+
+	// Cancelling stops the retries
+	cancel()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("should fail to reconnect")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling should stop reconnecting")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	server := newMockServer(t)
+	config := testMockServerConfig(server)
+	config.KeepAliveInterval = 10 * time.Millisecond
+	client, err := New(server.address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// A connection with sessions in progress is never dropped
+	done := client.startSession()
+	server.closeConns()
+	time.Sleep(100 * time.Millisecond)
+	if client.currentClient() == nil {
+		t.Fatal("the connection should not be dropped while sessions are in progress")
+	}
+	client.drop(client.currentClient())
+	if client.currentClient() == nil {
+		t.Fatal("the connection should not be dropped while sessions are in progress")
+	}
+
+	// Once idle, it is dropped after missing a few keepalives
+	done()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.currentClient() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the dead connection should be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpload_sftpReuse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer-ssh")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newMockServer(t)
+	config := testMockServerConfig(server)
+	config.UseSftp = true
+	client, err := New(server.address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.ToSlash(filepath.Join(dir, name))
+		if err := client.Upload(path, strings.NewReader(name), nil); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	conns, sftps := server.stats()
+	if conns != 1 || sftps != 1 {
+		t.Fatalf("expected 1 connection and 1 sftp session, got %d and %d", conns, sftps)
+	}
+
+	// A lost connection gets a new sftp session
+	server.closeConns()
+	client.drop(client.currentClient())
+	if err := client.Upload(filepath.ToSlash(filepath.Join(dir, "d")), strings.NewReader("d"), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	conns, sftps = server.stats()
+	if conns != 2 || sftps != 2 {
+		t.Fatalf("expected 2 connections and 2 sftp sessions, got %d and %d", conns, sftps)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "d"))
+	if err != nil || string(b) != "d" {
+		t.Fatalf("bad upload: %q %v", b, err)
+	}
+}
+
+func TestRemotePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		useSftp  bool
+		expected string
+	}{
+		{"/tmp/script.sh", false, "/tmp/script.sh"},
+		{"/tmp/script.sh", true, "/tmp/script.sh"},
+		{"relative/path", true, "relative/path"},
+		{"c:/Windows/Temp/script.ps1", false, "c:/Windows/Temp/script.ps1"},
+		{"c:/Windows/Temp/script.ps1", true, "/c:/Windows/Temp/script.ps1"},
+		{`C:\Windows\Temp\script.ps1`, false, "C:/Windows/Temp/script.ps1"},
+		{`C:\Windows\Temp\script.ps1`, true, "/C:/Windows/Temp/script.ps1"},
+		{"/C:/Windows/Temp", false, "C:/Windows/Temp"},
+		{"/C:/Windows/Temp", true, "/C:/Windows/Temp"},
+	}
+
+	for _, tc := range cases {
+		if actual := remotePath(tc.path, tc.useSftp); actual != tc.expected {
+			t.Fatalf("remotePath(%q, %t): expected %q, got %q", tc.path, tc.useSftp, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package winrm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
+)
+
+// ClientCert authenticates to WinRM with an X.509 client certificate over
+// HTTPS. The certificate and key are carried by the transporter itself
+// rather than the endpoint so that every client created for a connection,
+// including the ones used for file copies, presents them.
+type ClientCert struct {
+	winrm.ClientAuthRequest
+
+	Cert []byte
+	Key  []byte
+}
+
+// Transport creates the TLS transport presenting the client certificate
+func (c *ClientCert) Transport(endpoint *winrm.Endpoint) error {
+	if !endpoint.HTTPS {
+		return errors.New("WinRM certificate authentication requires HTTPS")
+	}
+
+	ep := *endpoint
+	ep.Cert = c.Cert
+	ep.Key = c.Key
+	return c.ClientAuthRequest.Transport(&ep)
+}
+
+// Kerberos authenticates to WinRM using Kerberos through SPNEGO
+// (HTTP Negotiate). Credentials come from a password, a keytab or an
+// existing credential cache, in that order of precedence.
+type Kerberos struct {
+	Username string
+	Password string
+	Realm    string
+
+	// KeytabPath and CCachePath are alternatives to Password.
+	KeytabPath string
+	CCachePath string
+
+	// ConfigPath is the path to a krb5.conf. If empty, KRB5_CONFIG and then
+	// /etc/krb5.conf are tried, falling back to locating the KDC through DNS.
+	ConfigPath string
+
+	// SPN is the service principal of the WinRM endpoint. It defaults to
+	// HTTP/<host>.
+	SPN string
+
+	url       string
+	spn       string
+	client    *krbclient.Client
+	transport http.RoundTripper
+}
+
+// Transport logs in to the KDC and creates the HTTP transport
+func (k *Kerberos) Transport(endpoint *winrm.Endpoint) error {
+	cfg, err := k.loadConfig()
+	if err != nil {
+		return fmt.Errorf("Error loading Kerberos configuration: %s", err)
+	}
+
+	settings := krbclient.DisablePAFXFAST(true)
+	switch {
+	case k.CCachePath != "":
+		cc, err := credentials.LoadCCache(k.CCachePath)
+		if err != nil {
+			return fmt.Errorf("Error loading Kerberos credential cache: %s", err)
+		}
+		k.client, err = krbclient.NewFromCCache(cc, cfg, settings)
+		if err != nil {
+			return fmt.Errorf("Error loading Kerberos credential cache: %s", err)
+		}
+	case k.KeytabPath != "":
+		kt, err := keytab.Load(k.KeytabPath)
+		if err != nil {
+			return fmt.Errorf("Error loading Kerberos keytab: %s", err)
+		}
+		k.client = krbclient.NewWithKeytab(k.Username, k.Realm, kt, cfg, settings)
+	default:
+		k.client = krbclient.NewWithPassword(k.Username, k.Realm, k.Password, cfg, settings)
+	}
+
+	if err := k.client.Login(); err != nil {
+		return fmt.Errorf("Kerberos login failed: %s", err)
+	}
+
+	k.spn = k.SPN
+	if k.spn == "" {
+		k.spn = "HTTP/" + endpoint.Host
+	}
+
+	scheme := "http"
+	if endpoint.HTTPS {
+		scheme = "https"
+	}
+	k.url = fmt.Sprintf("%s://%s/wsman", scheme, net.JoinHostPort(endpoint.Host, fmt.Sprint(endpoint.Port)))
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: endpoint.Insecure,
+			ServerName:         endpoint.TLSServerName,
+		},
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		ResponseHeaderTimeout: endpoint.Timeout,
+	}
+
+	if len(endpoint.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(endpoint.CACert) {
+			return errors.New("Unable to read certificates")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	k.transport = transport
+	return nil
+}
+
+// Post sends a SOAP message, negotiating authentication as needed
+func (k *Kerberos) Post(_ *winrm.Client, request *soap.SoapMessage) (string, error) {
+	client := spnego.NewClient(k.client, &http.Client{Transport: k.transport}, k.spn)
+
+	req, err := http.NewRequest("POST", k.url, strings.NewReader(request.String()))
+	if err != nil {
+		return "", fmt.Errorf("impossible to create http request %s", err)
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unknown error %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error while reading request body %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http error %d: %s", resp.StatusCode, body)
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/soap+xml") {
+		return "", fmt.Errorf("http response error: %d - invalid content type", resp.StatusCode)
+	}
+
+	return string(body), nil
+}
+
+func (k *Kerberos) loadConfig() (*krbconfig.Config, error) {
+	path := k.ConfigPath
+	if path == "" {
+		path = os.Getenv("KRB5_CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat("/etc/krb5.conf"); err == nil {
+			path = "/etc/krb5.conf"
+		}
+	}
+
+	if path != "" {
+		cfg, err := krbconfig.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if k.Realm == "" {
+			k.Realm = cfg.LibDefaults.DefaultRealm
+		}
+		return cfg, nil
+	}
+
+	// Without a krb5.conf, locate the KDCs of the realm through DNS SRV
+	// records.
+	cfg := krbconfig.New()
+	cfg.LibDefaults.DefaultRealm = k.Realm
+	cfg.LibDefaults.DNSLookupKDC = true
+	return cfg, nil
+}
@@ -3,6 +3,7 @@ package winrm
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -31,13 +32,7 @@ func New(config *Config) (*Communicator, error) {
 		Port:     config.Port,
 		HTTPS:    config.Https,
 		Insecure: config.Insecure,
-
-		/*
-			TODO
-			HTTPS:    connInfo.HTTPS,
-			Insecure: connInfo.Insecure,
-			CACert:   connInfo.CACert,
-		*/
+		CACert:   config.CACert,
 	}
 
 	// Create the client
@@ -76,6 +71,10 @@ func New(config *Config) (*Communicator, error) {
 
 // Start implementation of communicator.Communicator interface
 func (c *Communicator) Start(ctx context.Context, rc *packer.RemoteCmd) error {
+	if rc.Pty != nil {
+		return errors.New("pseudo terminals are not supported over WinRM")
+	}
+
 	shell, err := c.client.CreateShell()
 	if err != nil {
 		return err
@@ -177,6 +176,7 @@ func (c *Communicator) getClientConfig() *winrmcp.Config {
 		},
 		Https:                 c.config.Https,
 		Insecure:              c.config.Insecure,
+		CACertBytes:           c.config.CACert,
 		OperationTimeout:      c.config.Timeout,
 		MaxOperationsPerShell: 15, // lowest common denominator
 		TransportDecorator:    c.config.TransportDecorator,
@@ -10,6 +10,7 @@ import (
 
 	"github.com/dylanmei/winrmtest"
 	"github.com/hashicorp/packer/packer"
+	"github.com/masterzen/winrm"
 )
 
 const PAYLOAD = "stuff"
@@ -122,3 +123,10 @@ func TestUpload(t *testing.T) {
 	}
 
 }
+
+func TestClientCert_RequiresHTTPS(t *testing.T) {
+	c := &ClientCert{}
+	if err := c.Transport(&winrm.Endpoint{Host: "localhost", Port: 5985}); err == nil {
+		t.Fatal("should have error")
+	}
+}
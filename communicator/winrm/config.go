@@ -15,5 +15,6 @@ type Config struct {
 	Timeout            time.Duration
 	Https              bool
 	Insecure           bool
+	CACert             []byte
 	TransportDecorator func() winrm.Transporter
 }
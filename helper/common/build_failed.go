@@ -0,0 +1,23 @@
+package common
+
+import (
+	"os"
+)
+
+const buildFailedKey = "failed"
+
+// SetBuildFailed records that the build failed, so that the post-processors
+// of the other builds of the run can tell.
+func SetBuildFailed(buildName string, err error) error {
+	return SetSharedState(buildFailedKey, err.Error(), buildName)
+}
+
+// RetrieveBuildFailed returns the error the build failed with, or an empty
+// string if it didn't fail, or didn't finish yet.
+func RetrieveBuildFailed(buildName string) (string, error) {
+	value, err := RetrieveSharedState(buildFailedKey, buildName)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return value, err
+}
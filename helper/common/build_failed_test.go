@@ -0,0 +1,31 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBuildFailed(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-build-failed")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer RemoveRunSharedState()
+
+	failed, err := RetrieveBuildFailed("foo")
+	if err != nil || failed != "" {
+		t.Fatalf("should not be recorded: %q %v", failed, err)
+	}
+
+	if err := SetBuildFailed("foo", errors.New("bad")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	failed, err = RetrieveBuildFailed("foo")
+	if err != nil || failed != "bad" {
+		t.Fatalf("bad: %q %v", failed, err)
+	}
+
+	RemoveRunSharedState()
+	if failed, _ := RetrieveBuildFailed("foo"); failed != "" {
+		t.Fatalf("the state of the run should be removed: %q", failed)
+	}
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// OutputMarker prefixes the lines of a provisioner's standard output that
+// export a build output, as in "PACKER_OUTPUT key=value".
+const OutputMarker = "PACKER_OUTPUT "
+
+// ArtifactFilesOutput is the build output listing, comma separated, the
+// local files the provisioners attach to the artifacts of the build.
+const ArtifactFilesOutput = "artifact_files"
+
+const buildOutputsKey = "outputs"
+
+var buildOutputsLock sync.Mutex
+
+// SetBuildOutputs merges outputs into the outputs recorded for the build, so
+// that later provisioners and post-processors can read them back, even from
+// another plugin process.
+func SetBuildOutputs(buildName string, outputs map[string]string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	buildOutputsLock.Lock()
+	defer buildOutputsLock.Unlock()
+
+	current, err := retrieveBuildOutputs(buildName)
+	if err != nil {
+		return err
+	}
+	for k, v := range outputs {
+		current[k] = v
+	}
+	return setBuildOutputs(buildName, current)
+}
+
+// AddArtifactFiles attaches local files, such as reports, to the artifacts
+// of the build.
+func AddArtifactFiles(buildName string, files ...string) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	buildOutputsLock.Lock()
+	defer buildOutputsLock.Unlock()
+
+	current, err := retrieveBuildOutputs(buildName)
+	if err != nil {
+		return err
+	}
+	var all []string
+	if v := current[ArtifactFilesOutput]; v != "" {
+		all = strings.Split(v, ",")
+	}
+	for _, f := range files {
+		if !containsString(all, f) {
+			all = append(all, f)
+		}
+	}
+	current[ArtifactFilesOutput] = strings.Join(all, ",")
+	return setBuildOutputs(buildName, current)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func setBuildOutputs(buildName string, outputs map[string]string) error {
+	value, err := json.Marshal(outputs)
+	if err != nil {
+		return err
+	}
+	return SetSharedState(buildOutputsKey, string(value), buildName)
+}
+
+// RetrieveBuildOutputs returns the outputs recorded for the build so far.
+func RetrieveBuildOutputs(buildName string) (map[string]string, error) {
+	buildOutputsLock.Lock()
+	defer buildOutputsLock.Unlock()
+
+	return retrieveBuildOutputs(buildName)
+}
+
+func retrieveBuildOutputs(buildName string) (map[string]string, error) {
+	outputs := make(map[string]string)
+
+	value, err := RetrieveSharedState(buildOutputsKey, buildName)
+	if os.IsNotExist(err) {
+		return outputs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(value), &outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// RemoveBuildOutputs forgets the outputs recorded for the build.
+func RemoveBuildOutputs(buildName string) {
+	RemoveSharedStateFile(buildOutputsKey, buildName)
+}
+
+// ParseOutputs reads "key=value" lines. When prefix is not empty, only the
+// lines starting with it are considered, and the prefix is stripped. Other
+// lines, and lines without a valid key, are ignored.
+func ParseOutputs(r io.Reader, prefix string) (map[string]string, error) {
+	outputs := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if prefix != "" {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			line = strings.TrimPrefix(line, prefix)
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		outputs[key] = parts[1]
+	}
+
+	return outputs, scanner.Err()
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildOutputs(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-build-outputs")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer RemoveBuildOutputs("foo")
+
+	outputs, err := RetrieveBuildOutputs("foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(outputs) != 0 {
+		t.Fatalf("should be empty: %#v", outputs)
+	}
+
+	if err := SetBuildOutputs("foo", map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := SetBuildOutputs("foo", map[string]string{"b": "3"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outputs, err = RetrieveBuildOutputs("foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]string{"a": "1", "b": "3"}
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("bad: %#v", outputs)
+	}
+
+	outputs, err = RetrieveBuildOutputs("bar")
+	if err != nil || len(outputs) != 0 {
+		t.Fatalf("other builds should not see the outputs: %#v %v", outputs, err)
+	}
+}
+
+func TestAddArtifactFiles(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-artifact-files")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer RemoveBuildOutputs("foo")
+
+	if err := AddArtifactFiles("foo", "a.xml", "b.xml"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := AddArtifactFiles("foo", "b.xml", "c.json"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outputs, err := RetrieveBuildOutputs("foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs[ArtifactFilesOutput] != "a.xml,b.xml,c.json" {
+		t.Fatalf("bad: %#v", outputs)
+	}
+}
+
+func TestParseOutputs(t *testing.T) {
+	input := "Installing...\r\n" +
+		"PACKER_OUTPUT kernel=4.15.0\r\n" +
+		"PACKER_OUTPUT url=http://example.com/?a=b\n" +
+		"PACKER_OUTPUT broken\n" +
+		"done=true\n"
+
+	outputs, err := ParseOutputs(strings.NewReader(input), OutputMarker)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]string{
+		"kernel": "4.15.0",
+		"url":    "http://example.com/?a=b",
+	}
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("bad: %#v", outputs)
+	}
+
+	outputs, err = ParseOutputs(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs["done"] != "true" || len(outputs) != 1 {
+		t.Fatalf("bad: %#v", outputs)
+	}
+}
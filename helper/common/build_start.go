@@ -0,0 +1,32 @@
+package common
+
+import (
+	"os"
+	"time"
+)
+
+const buildStartKey = "start"
+
+// SetBuildStart records when the build started, so that post-processors
+// running in other plugin processes can tell how long it took.
+func SetBuildStart(buildName string, start time.Time) error {
+	return SetSharedState(buildStartKey, start.UTC().Format(time.RFC3339Nano), buildName)
+}
+
+// RetrieveBuildStart returns when the build started, or the zero time if
+// it wasn't recorded.
+func RetrieveBuildStart(buildName string) (time.Time, error) {
+	value, err := RetrieveSharedState(buildStartKey, buildName)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// RemoveBuildStart forgets when the build started.
+func RemoveBuildStart(buildName string) {
+	RemoveSharedStateFile(buildStartKey, buildName)
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBuildStart(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-build-start")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer RemoveBuildStart("foo")
+
+	start, err := RetrieveBuildStart("foo")
+	if err != nil || !start.IsZero() {
+		t.Fatalf("should not be recorded: %s %v", start, err)
+	}
+
+	expected := time.Date(2019, 6, 1, 12, 30, 0, 500, time.UTC)
+	if err := SetBuildStart("foo", expected); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	start, err = RetrieveBuildStart("foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !start.Equal(expected) {
+		t.Fatalf("bad: %s", start)
+	}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+)
+
+// UpdateJSONFile decodes the JSON file at path into v, runs update, then
+// writes v back. The file is locked meanwhile, so that builds running in
+// parallel, possibly in other processes, can update the same file.
+//
+// The lock is taken on path with a ".lock" suffix. The lock file is left
+// in place: removing it would let a process lock the new file while another
+// still holds the lock on the removed one.
+func UpdateJSONFile(path string, v interface{}, perm os.FileMode, update func() error) error {
+	lockFile := path + ".lock"
+	log.Printf("Acquiring lock for: %s", lockFile)
+	lock := flock.New(lockFile)
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := ReadJSONFile(path, v); err != nil {
+		return err
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	return WriteJSONFile(path, v, perm)
+}
+
+// ReadJSONFile decodes the JSON file at path into v. v is left as is when
+// the file doesn't exist or is empty.
+func ReadJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSONFile replaces the file at path with v encoded as JSON, through
+// a rename so that readers never see a partial file.
+func WriteJSONFile(path string, v interface{}, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The temporary file is only readable by its owner.
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
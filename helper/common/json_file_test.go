@@ -0,0 +1,74 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUpdateJSONFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "file.json")
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := make(map[string]int)
+			errs <- UpdateJSONFile(path, &m, 0644, func() error {
+				m[fmt.Sprintf("build-%d", i)] = i
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	m := make(map[string]int)
+	if err := ReadJSONFile(path, &m); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(m) != 10 {
+		t.Fatalf("updates were lost: %#v", m)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Fatalf("bad mode: %s", fi.Mode())
+	}
+	// Only the file and its lock are left
+	files, err := filepath.Glob(filepath.Join(td, "*"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("bad files: %v %v", files, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(td, ".file.json*")); len(files) > 0 {
+		t.Fatalf("leftover temporary files: %v", files)
+	}
+}
+
+func TestReadJSONFile_missing(t *testing.T) {
+	m := map[string]int{"a": 1}
+	if err := ReadJSONFile(filepath.Join(os.TempDir(), "packer-missing.json"), &m); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(m) != 1 {
+		t.Fatalf("should be left as is: %#v", m)
+	}
+}
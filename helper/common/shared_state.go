@@ -29,3 +29,16 @@ func RetrieveSharedState(key string, buildName string) (string, error) {
 func RemoveSharedStateFile(key string, buildName string) {
 	os.Remove(sharedStateFilename(key, buildName))
 }
+
+// RemoveRunSharedState removes all the state shared by the builds of the
+// run, once they are done.
+func RemoveRunSharedState() {
+	uuid := os.Getenv("PACKER_RUN_UUID")
+	if uuid == "" {
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(os.TempDir(), fmt.Sprintf("packer-%s-*", uuid)))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
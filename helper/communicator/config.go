@@ -1,6 +1,7 @@
 package communicator
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	packerssh "github.com/hashicorp/packer/communicator/ssh"
+	packerwinrm "github.com/hashicorp/packer/communicator/winrm"
 	"github.com/hashicorp/packer/helper/multistep"
 	helperssh "github.com/hashicorp/packer/helper/ssh"
 	"github.com/hashicorp/packer/packer"
@@ -52,6 +54,7 @@ type Config struct {
 	SSHProxyPassword          string        `mapstructure:"ssh_proxy_password"`
 	SSHKeepAliveInterval      time.Duration `mapstructure:"ssh_keep_alive_interval"`
 	SSHReadWriteTimeout       time.Duration `mapstructure:"ssh_read_write_timeout"`
+	SSHReconnectTimeout       time.Duration `mapstructure:"ssh_reconnect_timeout"`
 	// SSH Internals
 	SSHPublicKey  []byte
 	SSHPrivateKey []byte
@@ -65,10 +68,25 @@ type Config struct {
 	WinRMUseSSL             bool          `mapstructure:"winrm_use_ssl"`
 	WinRMInsecure           bool          `mapstructure:"winrm_insecure"`
 	WinRMUseNTLM            bool          `mapstructure:"winrm_use_ntlm"`
+	WinRMCACertFile         string        `mapstructure:"winrm_ca_cert_file"`
+	WinRMClientCertFile     string        `mapstructure:"winrm_client_cert_file"`
+	WinRMClientKeyFile      string        `mapstructure:"winrm_client_key_file"`
+	WinRMUseKerberos        bool          `mapstructure:"winrm_use_kerberos"`
+	WinRMKerberosRealm      string        `mapstructure:"winrm_kerberos_realm"`
+	WinRMKerberosKeytab     string        `mapstructure:"winrm_kerberos_keytab"`
+	WinRMKerberosCCache     string        `mapstructure:"winrm_kerberos_ccache"`
+	WinRMKerberosConfig     string        `mapstructure:"winrm_kerberos_config"`
+	WinRMKerberosSPN        string        `mapstructure:"winrm_kerberos_spn"`
 	WinRMTransportDecorator func() winrm.Transporter
+	// WinRM Internals
+	WinRMCACert []byte
 
 	// Delay
 	PauseBeforeConnect time.Duration `mapstructure:"pause_before_connecting"`
+
+	// The name of the build, used to share the connection details with
+	// the provisioners
+	buildName string
 }
 
 // ReadSSHPrivateKeyFile returns the SSH private key bytes
@@ -202,6 +220,10 @@ func (c *Config) Prepare(ctx *interpolate.Context) []error {
 		c.Type = "ssh"
 	}
 
+	if ctx != nil {
+		c.buildName = ctx.BuildName
+	}
+
 	var errs []error
 	switch c.Type {
 	case "ssh":
@@ -212,7 +234,7 @@ func (c *Config) Prepare(ctx *interpolate.Context) []error {
 		if es := c.prepareWinRM(ctx); len(es) > 0 {
 			errs = append(errs, es...)
 		}
-	case "docker", "dockerWindowsContainer", "none":
+	case "docker", "dockerWindowsContainer", "qga", "none":
 		break
 	default:
 		return []error{fmt.Errorf("Communicator type %s is invalid", c.Type)}
@@ -321,14 +343,142 @@ func (c *Config) prepareWinRM(ctx *interpolate.Context) []error {
 		c.WinRMTimeout = 30 * time.Minute
 	}
 
-	if c.WinRMUseNTLM == true {
+	var errs []error
+
+	useCert := c.WinRMClientCertFile != "" || c.WinRMClientKeyFile != ""
+	methods := 0
+	for _, enabled := range []bool{c.WinRMUseNTLM, c.WinRMUseKerberos, useCert} {
+		if enabled {
+			methods++
+		}
+	}
+	if methods > 1 {
+		errs = append(errs, errors.New(
+			"only one of winrm_use_ntlm, winrm_use_kerberos or winrm_client_cert_file may be used"))
+	}
+
+	if c.WinRMCACertFile != "" {
+		caCert, err := readWinRMFile(c.WinRMCACertFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("winrm_ca_cert_file is invalid: %s", err))
+		}
+		c.WinRMCACert = caCert
+	}
+
+	switch {
+	case c.WinRMUseNTLM:
 		c.WinRMTransportDecorator = func() winrm.Transporter { return &winrm.ClientNTLM{} }
+	case useCert:
+		if es := c.prepareWinRMCert(); len(es) > 0 {
+			errs = append(errs, es...)
+		}
+	case c.WinRMUseKerberos:
+		if es := c.prepareWinRMKerberos(); len(es) > 0 {
+			errs = append(errs, es...)
+		}
 	}
 
-	var errs []error
-	if c.WinRMUser == "" {
+	// Certificates identify the user and a credential cache carries the
+	// principal, so a username is only needed for the other methods.
+	if c.WinRMUser == "" && !useCert && !(c.WinRMUseKerberos && c.WinRMKerberosCCache != "") {
 		errs = append(errs, errors.New("winrm_username must be specified."))
 	}
 
 	return errs
 }
+
+func (c *Config) prepareWinRMCert() []error {
+	var errs []error
+	if c.WinRMClientCertFile == "" || c.WinRMClientKeyFile == "" {
+		errs = append(errs, errors.New(
+			"winrm_client_cert_file and winrm_client_key_file must both be specified"))
+	}
+	if !c.WinRMUseSSL {
+		errs = append(errs, errors.New(
+			"winrm_use_ssl must be true to use certificate authentication"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	cert, err := readWinRMFile(c.WinRMClientCertFile)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("winrm_client_cert_file is invalid: %s", err))
+	}
+	key, err := readWinRMFile(c.WinRMClientKeyFile)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("winrm_client_key_file is invalid: %s", err))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return []error{fmt.Errorf("winrm_client_cert_file and winrm_client_key_file are invalid: %s", err)}
+	}
+
+	c.WinRMTransportDecorator = func() winrm.Transporter {
+		return &packerwinrm.ClientCert{Cert: cert, Key: key}
+	}
+	return nil
+}
+
+func (c *Config) prepareWinRMKerberos() []error {
+	var errs []error
+	if c.WinRMKerberosKeytab != "" && c.WinRMKerberosCCache != "" {
+		errs = append(errs, errors.New(
+			"only one of winrm_kerberos_keytab or winrm_kerberos_ccache may be specified"))
+	}
+	if c.WinRMKerberosCCache == "" && c.WinRMKerberosRealm == "" {
+		errs = append(errs, errors.New(
+			"winrm_kerberos_realm must be specified to use Kerberos authentication"))
+	}
+	if c.WinRMKerberosKeytab == "" && c.WinRMKerberosCCache == "" && c.WinRMPassword == "" {
+		errs = append(errs, errors.New(
+			"one of winrm_password, winrm_kerberos_keytab or winrm_kerberos_ccache must be specified"))
+	}
+
+	for name, path := range map[string]*string{
+		"winrm_kerberos_keytab": &c.WinRMKerberosKeytab,
+		"winrm_kerberos_ccache": &c.WinRMKerberosCCache,
+		"winrm_kerberos_config": &c.WinRMKerberosConfig,
+	} {
+		if *path == "" {
+			continue
+		}
+		expanded, err := packer.ExpandUser(*path)
+		if err == nil {
+			_, err = os.Stat(expanded)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s is invalid: %s", name, err))
+			continue
+		}
+		*path = expanded
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	c.WinRMTransportDecorator = func() winrm.Transporter {
+		return &packerwinrm.Kerberos{
+			Username:   c.WinRMUser,
+			Password:   c.WinRMPassword,
+			Realm:      c.WinRMKerberosRealm,
+			KeytabPath: c.WinRMKerberosKeytab,
+			CCachePath: c.WinRMKerberosCCache,
+			ConfigPath: c.WinRMKerberosConfig,
+			SPN:        c.WinRMKerberosSPN,
+		}
+	}
+	return nil
+}
+
+func readWinRMFile(path string) ([]byte, error) {
+	path, err := packer.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
@@ -1,9 +1,20 @@
 package communicator
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
+	packerwinrm "github.com/hashicorp/packer/communicator/winrm"
 	"github.com/hashicorp/packer/template/interpolate"
 	"github.com/masterzen/winrm"
 )
@@ -126,6 +137,139 @@ func TestConfig_winrm_use_ntlm(t *testing.T) {
 
 }
 
+func TestConfig_winrm_client_cert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	c := &Config{
+		Type:                "winrm",
+		WinRMUseSSL:         true,
+		WinRMClientCertFile: certFile,
+		WinRMClientKeyFile:  keyFile,
+	}
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	if _, ok := c.WinRMTransportDecorator().(*packerwinrm.ClientCert); !ok {
+		t.Fatalf("WinRMTransportDecorator isn't ClientCert.")
+	}
+
+	// Certificate authentication requires HTTPS
+	c = &Config{
+		Type:                "winrm",
+		WinRMClientCertFile: certFile,
+		WinRMClientKeyFile:  keyFile,
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// Both the certificate and the key are required
+	c = &Config{
+		Type:                "winrm",
+		WinRMUseSSL:         true,
+		WinRMClientCertFile: certFile,
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// Only one authentication method may be chosen
+	c = &Config{
+		Type:                "winrm",
+		WinRMUseSSL:         true,
+		WinRMUseNTLM:        true,
+		WinRMClientCertFile: certFile,
+		WinRMClientKeyFile:  keyFile,
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+}
+
+func TestConfig_winrm_use_kerberos(t *testing.T) {
+	c := &Config{
+		Type:               "winrm",
+		WinRMUser:          "admin",
+		WinRMPassword:      "secret",
+		WinRMUseKerberos:   true,
+		WinRMKerberosRealm: "EXAMPLE.COM",
+	}
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	actual, ok := c.WinRMTransportDecorator().(*packerwinrm.Kerberos)
+	if !ok {
+		t.Fatalf("WinRMTransportDecorator isn't Kerberos.")
+	}
+	if actual.Realm != "EXAMPLE.COM" || actual.Username != "admin" || actual.Password != "secret" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// A realm is required unless a credential cache is used
+	c = &Config{
+		Type:             "winrm",
+		WinRMUser:        "admin",
+		WinRMPassword:    "secret",
+		WinRMUseKerberos: true,
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// Some credentials are required
+	c = &Config{
+		Type:               "winrm",
+		WinRMUser:          "admin",
+		WinRMUseKerberos:   true,
+		WinRMKerberosRealm: "EXAMPLE.COM",
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// The credential cache must exist
+	c = &Config{
+		Type:                "winrm",
+		WinRMUseKerberos:    true,
+		WinRMKerberosCCache: "/i/dont/exist",
+	}
+	if err := c.Prepare(testContext(t)); len(err) == 0 {
+		t.Fatal("should have error")
+	}
+}
+
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "packer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	return certFile, keyFile
+}
+
 func TestConfig_winrm(t *testing.T) {
 	c := &Config{
 		Type:      "winrm",
@@ -184,6 +184,7 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 			UseSftp:                s.Config.SSHFileTransferMethod == "sftp",
 			KeepAliveInterval:      s.Config.SSHKeepAliveInterval,
 			Timeout:                s.Config.SSHReadWriteTimeout,
+			ReconnectTimeout:       s.Config.SSHReconnectTimeout,
 		}
 
 		log.Printf("[INFO] Attempting SSH connection to %s...", address)
@@ -84,11 +84,15 @@ WaitLoop:
 }
 
 func (s *StepConnectWinRM) Cleanup(multistep.StateBag) {
+	if s.Config.buildName != "" {
+		RemoveWinRMEndpoint(s.Config.buildName)
+	}
 }
 
 func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan struct{}) (packer.Communicator, error) {
 	ctx := context.TODO()
 	var comm packer.Communicator
+	var endpoint *WinRMEndpoint
 	for {
 		select {
 		case <-cancel:
@@ -138,6 +142,7 @@ func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan
 			Timeout:            s.Config.WinRMTimeout,
 			Https:              s.Config.WinRMUseSSL,
 			Insecure:           s.Config.WinRMInsecure,
+			CACert:             s.Config.WinRMCACert,
 			TransportDecorator: s.Config.WinRMTransportDecorator,
 		})
 		if err != nil {
@@ -145,6 +150,16 @@ func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan
 			continue
 		}
 
+		endpoint = &WinRMEndpoint{
+			Host:        host,
+			Port:        port,
+			User:        user,
+			UseSSL:      s.Config.WinRMUseSSL,
+			Insecure:    s.Config.WinRMInsecure,
+			UseNTLM:     s.Config.WinRMUseNTLM,
+			UseKerberos: s.Config.WinRMUseKerberos,
+			CACertFile:  s.Config.WinRMCACertFile,
+		}
 		break
 	}
 	// run an "echo" command to make sure winrm is actually connected before moving on.
@@ -181,5 +196,12 @@ func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan
 		break
 	}
 
+	// Let the provisioners connect to the machine on their own
+	if s.Config.buildName != "" {
+		if err := SetWinRMEndpoint(s.Config.buildName, endpoint); err != nil {
+			log.Printf("[WARN] Error recording the WinRM endpoint: %s", err)
+		}
+	}
+
 	return comm, nil
 }
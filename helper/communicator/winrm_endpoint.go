@@ -0,0 +1,50 @@
+package communicator
+
+import (
+	"encoding/json"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+)
+
+// WinRMEndpoint describes the WinRM service Packer connected to, so that
+// provisioners running tools with their own WinRM client, such as Ansible,
+// can reach the machine directly. The password isn't recorded, as the
+// endpoint is kept in a file for the whole build.
+type WinRMEndpoint struct {
+	Host        string
+	Port        int
+	User        string
+	UseSSL      bool
+	Insecure    bool
+	UseNTLM     bool
+	UseKerberos bool
+	CACertFile  string
+}
+
+// SetWinRMEndpoint records the endpoint for the build.
+func SetWinRMEndpoint(buildName string, endpoint *WinRMEndpoint) error {
+	value, err := json.Marshal(endpoint)
+	if err != nil {
+		return err
+	}
+	return commonhelper.SetSharedState("winrm_endpoint", string(value), buildName)
+}
+
+// RetrieveWinRMEndpoint returns the endpoint recorded for the build.
+func RetrieveWinRMEndpoint(buildName string) (*WinRMEndpoint, error) {
+	value, err := commonhelper.RetrieveSharedState("winrm_endpoint", buildName)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoint WinRMEndpoint
+	if err := json.Unmarshal([]byte(value), &endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// RemoveWinRMEndpoint forgets the endpoint recorded for the build.
+func RemoveWinRMEndpoint(buildName string) {
+	commonhelper.RemoveSharedStateFile("winrm_endpoint", buildName)
+}
@@ -0,0 +1,47 @@
+package packer
+
+import (
+	"strings"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+)
+
+// ArtifactStateOutputs is the artifact State holding the outputs captured by
+// the provisioners during the build, as a map[string]string.
+const ArtifactStateOutputs = "build_outputs"
+
+// outputsArtifact is an Artifact implementation that adds the outputs of the
+// build to the State of the artifact it wraps, and the files the
+// provisioners attached to its Files.
+type outputsArtifact struct {
+	Artifact
+
+	outputs map[string]string
+}
+
+func (a *outputsArtifact) Files() []string {
+	files := a.Artifact.Files()
+	if v := a.outputs[commonhelper.ArtifactFilesOutput]; v != "" {
+		files = append(append([]string{}, files...), strings.Split(v, ",")...)
+	}
+	return files
+}
+
+func (a *outputsArtifact) State(name string) interface{} {
+	if name == ArtifactStateOutputs {
+		return a.outputs
+	}
+	return a.Artifact.State(name)
+}
+
+// withOutputs wraps artifact so that its State exposes outputs, unless there
+// are none.
+func withOutputs(artifact Artifact, outputs map[string]string) Artifact {
+	if artifact == nil || len(outputs) == 0 {
+		return artifact
+	}
+	if a, ok := artifact.(*outputsArtifact); ok {
+		artifact = a.Artifact
+	}
+	return &outputsArtifact{Artifact: artifact, outputs: outputs}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
 )
 
 const (
@@ -17,6 +20,10 @@ const (
 	// such who want to make use of this.
 	BuilderTypeConfigKey = "packer_builder_type"
 
+	// This key contains a []string of the names of the builds of the run,
+	// once filtered with -only and -except.
+	BuildNamesConfigKey = "packer_build_names"
+
 	// This is the key in configurations that is set to "true" when Packer
 	// debugging is enabled.
 	DebugConfigKey = "packer_debug"
@@ -34,6 +41,10 @@ const (
 	// TemplatePathKey is the path to the template that configured this build
 	TemplatePathKey = "packer_template_path"
 
+	// This key contains a []string of the names of the user variables that
+	// are sensitive.
+	SensitiveVarsConfigKey = "packer_sensitive_variables"
+
 	// This key contains a map[string]string of the user variables for
 	// template processing.
 	UserVariablesConfigKey = "packer_user_variables"
@@ -85,6 +96,7 @@ type Build interface {
 // (such as VirtualBox, EC2, etc.).
 type coreBuild struct {
 	name           string
+	buildNames     []string
 	builder        Builder
 	builderConfig  interface{}
 	builderType    string
@@ -93,6 +105,7 @@ type coreBuild struct {
 	provisioners   []coreBuildProvisioner
 	templatePath   string
 	variables      map[string]string
+	sensitiveVars  []string
 
 	debug         bool
 	force         bool
@@ -138,10 +151,12 @@ func (b *coreBuild) Prepare() (warn []string, err error) {
 
 	packerConfig := map[string]interface{}{
 		BuildNameConfigKey:     b.name,
+		BuildNamesConfigKey:    b.buildNames,
 		BuilderTypeConfigKey:   b.builderType,
 		DebugConfigKey:         b.debug,
 		ForceConfigKey:         b.force,
 		OnErrorConfigKey:       b.onError,
+		SensitiveVarsConfigKey: b.sensitiveVars,
 		TemplatePathKey:        b.templatePath,
 		UserVariablesConfigKey: b.variables,
 	}
@@ -179,10 +194,29 @@ func (b *coreBuild) Prepare() (warn []string, err error) {
 
 // Runs the actual build. Prepare must be called prior to running this.
 func (b *coreBuild) Run(ctx context.Context, originalUi Ui) ([]Artifact, error) {
+	artifacts, err := b.run(ctx, originalUi)
+	if err != nil {
+		// Let the post-processors of the other builds of the run know
+		if err := commonhelper.SetBuildFailed(b.name, err); err != nil {
+			log.Printf("Error recording the failure of the build: %s", err)
+		}
+	}
+	return artifacts, err
+}
+
+func (b *coreBuild) run(ctx context.Context, originalUi Ui) ([]Artifact, error) {
 	if !b.prepareCalled {
 		panic("Prepare must be called first")
 	}
 
+	// The outputs captured by the provisioners only live for this build
+	defer commonhelper.RemoveBuildOutputs(b.name)
+
+	if err := commonhelper.SetBuildStart(b.name, time.Now()); err != nil {
+		log.Printf("Error recording the start of the build: %s", err)
+	}
+	defer commonhelper.RemoveBuildStart(b.name)
+
 	// Copy the hooks
 	hooks := make(map[string][]Hook)
 	for hookName, hookList := range b.hooks {
@@ -245,6 +279,14 @@ func (b *coreBuild) Run(ctx context.Context, originalUi Ui) ([]Artifact, error)
 		return nil, nil
 	}
 
+	// Expose the outputs captured by the provisioners, if any, to the
+	// post-processors and in the resulting artifacts.
+	outputs, outputsErr := commonhelper.RetrieveBuildOutputs(b.name)
+	if outputsErr != nil {
+		log.Printf("Error reading the build outputs: %s", outputsErr)
+	}
+	builderArtifact = withOutputs(builderArtifact, outputs)
+
 	errors := make([]error, 0)
 	keepOriginalArtifact := len(b.postProcessors) == 0
 
@@ -315,7 +357,7 @@ PostProcessorRunSeqLoop:
 				}
 			}
 
-			priorArtifact = artifact
+			priorArtifact = withOutputs(artifact, outputs)
 		}
 
 		// Add on the last artifact to the results
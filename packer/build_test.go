@@ -2,8 +2,11 @@ package packer
 
 import (
 	"context"
+	"os"
 	"reflect"
 	"testing"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
 )
 
 func boolPointer(tf bool) *bool {
@@ -35,10 +38,12 @@ func testBuild() *coreBuild {
 func testDefaultPackerConfig() map[string]interface{} {
 	return map[string]interface{}{
 		BuildNameConfigKey:     "test",
+		BuildNamesConfigKey:    []string(nil),
 		BuilderTypeConfigKey:   "foo",
 		DebugConfigKey:         false,
 		ForceConfigKey:         false,
 		OnErrorConfigKey:       "cleanup",
+		SensitiveVarsConfigKey: []string(nil),
 		TemplatePathKey:        "",
 		UserVariablesConfigKey: make(map[string]string),
 	}
@@ -412,6 +417,76 @@ func TestBuild_Run_Artifacts(t *testing.T) {
 	}
 }
 
+func TestBuild_Run_Outputs(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-build-run-outputs")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+
+	build := testBuild()
+	build.provisioners[0].provisioner = &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			if err := commonhelper.AddArtifactFiles("test", "results.xml"); err != nil {
+				return err
+			}
+			return commonhelper.SetBuildOutputs("test", map[string]string{"kernel": "4.15"})
+		},
+	}
+	build.builder = &MockBuilder{
+		ArtifactId: "b",
+		RunFn: func(ctx context.Context) {
+			build.builder.(*MockBuilder).RunHook.Run(ctx, HookProvision, nil, new(MockCommunicator), nil)
+		},
+	}
+	build.Prepare()
+
+	artifacts, err := build.Run(context.Background(), testUi())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+
+	expected := map[string]string{"kernel": "4.15", commonhelper.ArtifactFilesOutput: "results.xml"}
+	for _, a := range artifacts {
+		if outputs := a.State(ArtifactStateOutputs); !reflect.DeepEqual(outputs, expected) {
+			t.Fatalf("bad outputs for %s: %#v", a.Id(), outputs)
+		}
+		if files := a.Files(); len(files) == 0 || files[len(files)-1] != "results.xml" {
+			t.Fatalf("bad files for %s: %#v", a.Id(), files)
+		}
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(outputs) != 0 {
+		t.Fatalf("outputs should be removed after the build: %#v", outputs)
+	}
+}
+
+func TestBuild_Run_Failed(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-build-run-failed")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveRunSharedState()
+
+	build := testBuild()
+	build.builder = &MockBuilder{RunErrResult: true}
+	build.Prepare()
+
+	if _, err := build.Run(context.Background(), testUi()); err == nil {
+		t.Fatal("should error")
+	}
+
+	failed, err := commonhelper.RetrieveBuildFailed("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if failed == "" {
+		t.Fatal("the failure should be recorded for the run")
+	}
+}
+
 func TestBuild_RunBeforePrepare(t *testing.T) {
 	defer func() {
 		p := recover()
@@ -33,6 +33,11 @@ type RemoteCmd struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	// Pty, if set, requests a pseudo terminal for the command, so that it
+	// can be used interactively. It is only supported by the SSH
+	// communicator.
+	Pty *PtyConfig
+
 	// Once Exited is true, this will contain the exit code of the process.
 	exitStatus int
 
@@ -43,6 +48,16 @@ type RemoteCmd struct {
 	exitCh     chan interface{}
 }
 
+// PtyConfig describes the pseudo terminal requested for a RemoteCmd.
+type PtyConfig struct {
+	// Term is the terminal type, such as "xterm".
+	Term string
+
+	// The size of the terminal, in characters.
+	Width  int
+	Height int
+}
+
 // A Communicator is the interface used to communicate with the machine
 // that exists that will eventually be packaged into an image. Communicators
 // allow you to execute remote commands, upload files, etc.
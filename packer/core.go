@@ -2,6 +2,7 @@ package packer
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 
 	ttmp "text/template"
@@ -112,6 +113,46 @@ func (c *Core) BuildNames() []string {
 	return r
 }
 
+// SelectedBuildNames returns the builds of this configured core that are
+// run, taking into account the only and except flags.
+func (c *Core) SelectedBuildNames() []string {
+	// Filter the "only"
+	if len(c.only) > 0 {
+		// Build our result set which we pre-allocate some sane number
+		result := make([]string, 0, len(c.only))
+		for _, n := range c.only {
+			if _, ok := c.builds[n]; ok {
+				result = append(result, n)
+			}
+		}
+
+		return result
+	}
+
+	// Filter the "except"
+	if len(c.except) > 0 {
+		// Build a set of the things we don't want
+		nameSet := make(map[string]struct{})
+		for _, n := range c.except {
+			nameSet[n] = struct{}{}
+		}
+
+		// Build our result set which is the names of all builds except
+		// those in the given set.
+		names := c.BuildNames()
+		result := make([]string, 0, len(names))
+		for _, n := range names {
+			if _, ok := nameSet[n]; !ok {
+				result = append(result, n)
+			}
+		}
+		return result
+	}
+
+	// We care about everything
+	return c.BuildNames()
+}
+
 // Build returns the Build object for the given name.
 func (c *Core) Build(n string) (Build, error) {
 	// Setup the builder
@@ -162,8 +203,40 @@ func (c *Core) Build(n string) (Build, error) {
 			}
 		}
 
-		// If we're pausing, we wrap the provisioner in a special pauser.
-		if rawP.PauseBefore > 0 {
+		// If we're retrying, each attempt gets its own timeout and we only
+		// pause before the first one.
+		if rawP.MaxRetries > 0 {
+			retryOn := make([]*regexp.Regexp, 0, len(rawP.RetryOn))
+			for _, expr := range rawP.RetryOn {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"provisioner '%s': invalid retry_on expression: %s",
+						rawP.Type, err)
+				}
+				retryOn = append(retryOn, re)
+			}
+
+			if rawP.Timeout > 0 {
+				provisioner = &TimeoutProvisioner{
+					Timeout:     rawP.Timeout,
+					Provisioner: provisioner,
+				}
+			}
+			provisioner = &RetriedProvisioner{
+				Provisioner: provisioner,
+				MaxRetries:  rawP.MaxRetries,
+				Backoff:     rawP.RetryBackoff,
+				RetryOn:     retryOn,
+			}
+			if rawP.PauseBefore > 0 {
+				provisioner = &PausedProvisioner{
+					PauseBefore: rawP.PauseBefore,
+					Provisioner: provisioner,
+				}
+			}
+		} else if rawP.PauseBefore > 0 {
+			// If we're pausing, we wrap the provisioner in a special pauser.
 			provisioner = &PausedProvisioner{
 				PauseBefore: rawP.PauseBefore,
 				Provisioner: provisioner,
@@ -175,6 +248,25 @@ func (c *Core) Build(n string) (Build, error) {
 			}
 		}
 
+		// If there's a condition, it is checked before anything else so
+		// that skipped provisioners don't pause.
+		if rawP.When != "" {
+			ictx := c.Context()
+			ictx.BuildName = n
+			ictx.BuildType = configBuilder.Type
+			conditional := &ConditionalProvisioner{
+				Provisioner: provisioner,
+				When:        rawP.When,
+				Context:     ictx,
+			}
+			if err := conditional.Validate(); err != nil {
+				return nil, fmt.Errorf(
+					"provisioner '%s': invalid 'when' condition: %s",
+					rawP.Type, err)
+			}
+			provisioner = conditional
+		}
+
 		provisioners = append(provisioners, coreBuildProvisioner{
 			pType:       rawP.Type,
 			provisioner: provisioner,
@@ -231,8 +323,14 @@ func (c *Core) Build(n string) (Build, error) {
 
 	// TODO hooks one day
 
+	var sensitiveVars []string
+	for _, v := range c.Template.SensitiveVariables {
+		sensitiveVars = append(sensitiveVars, v.Key)
+	}
+
 	return &coreBuild{
 		name:           n,
+		buildNames:     c.SelectedBuildNames(),
 		builder:        builder,
 		builderConfig:  configBuilder.Config,
 		builderType:    configBuilder.Type,
@@ -240,6 +338,7 @@ func (c *Core) Build(n string) (Build, error) {
 		provisioners:   provisioners,
 		templatePath:   c.Template.Path,
 		variables:      c.variables,
+		sensitiveVars:  sensitiveVars,
 	}, nil
 }
 
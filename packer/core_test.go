@@ -51,6 +51,58 @@ func TestCoreBuildNames(t *testing.T) {
 	}
 }
 
+func TestCoreSelectedBuildNames(t *testing.T) {
+	cases := []struct {
+		Only   []string
+		Except []string
+		Result []string
+	}{
+		{nil, nil, []string{"amd64", "arm64", "ppc64le"}},
+		{[]string{"arm64", "missing"}, nil, []string{"arm64"}},
+		{nil, []string{"arm64"}, []string{"amd64", "ppc64le"}},
+	}
+
+	for _, tc := range cases {
+		config := TestCoreConfig(t)
+		testCoreTemplate(t, config, fixtureDir("build-names-selected.json"))
+		config.Only = tc.Only
+		config.Except = tc.Except
+		core := TestCore(t, config)
+
+		names := core.SelectedBuildNames()
+		if !reflect.DeepEqual(names, tc.Result) {
+			t.Fatalf("only %v, except %v: %#v", tc.Only, tc.Except, names)
+		}
+	}
+}
+
+func TestCoreBuild_buildNames(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("build-names-selected.json"))
+	config.Except = []string{"ppc64le"}
+	b := TestBuilder(t, config, "test")
+	core := TestCore(t, config)
+
+	build, err := core.Build("amd64")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var result map[string]interface{}
+	err = configHelper.Decode(&result, nil, b.PrepareConfig...)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(result[BuildNamesConfigKey], []string{"amd64", "arm64"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
 func TestCoreBuild_basic(t *testing.T) {
 	config := TestCoreConfig(t)
 	testCoreTemplate(t, config, fixtureDir("build-basic.json"))
@@ -247,6 +299,42 @@ func TestCoreBuild_prov(t *testing.T) {
 	}
 }
 
+func TestCoreBuild_provWhen(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("build-prov-when.json"))
+	TestBuilder(t, config, "test")
+	p := TestProvisioner(t, config, "test")
+	core := TestCore(t, config)
+
+	build, err := core.Build("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.ProvCalled {
+		t.Fatal("provisioner should not be called")
+	}
+}
+
+func TestCoreBuild_provWhenInvalid(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("build-prov-when-bad.json"))
+	TestBuilder(t, config, "test")
+	TestProvisioner(t, config, "test")
+	core := TestCore(t, config)
+
+	if _, err := core.Build("test"); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestCoreBuild_provSkip(t *testing.T) {
 	config := TestCoreConfig(t)
 	testCoreTemplate(t, config, fixtureDir("build-prov-skip.json"))
@@ -427,6 +515,32 @@ func TestCoreBuild_templatePath(t *testing.T) {
 	}
 }
 
+func TestCoreBuild_sensitiveVars(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("sensitive-variables.json"))
+	b := TestBuilder(t, config, "test")
+	core := TestCore(t, config)
+
+	build, err := core.Build("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var result map[string]interface{}
+	err = configHelper.Decode(&result, nil, b.PrepareConfig...)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(result[SensitiveVarsConfigKey], []string{"foo"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
 func TestCore_pushInterpolate(t *testing.T) {
 	cases := []struct {
 		File   string
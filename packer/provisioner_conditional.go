@@ -0,0 +1,127 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// ConditionalProvisioner is a Provisioner implementation that only runs the
+// provisioner it wraps when the When expression evaluates to true.
+//
+// When is a regular interpolation, rendered right before the provisioner
+// would run. On top of the usual functions, it can use:
+//
+//   guest_os            the lowercase output of `uname -s` on the guest, or
+//                       "windows"
+//   probe CMD           the exit status of CMD on the guest
+//   probe_output CMD    the trimmed standard output of CMD on the guest
+type ConditionalProvisioner struct {
+	Provisioner
+
+	When    string
+	Context *interpolate.Context
+}
+
+// Validate checks the syntax of the When expression.
+func (p *ConditionalProvisioner) Validate() error {
+	return interpolate.Validate(p.When, p.context(context.Background(), nil))
+}
+
+func (p *ConditionalProvisioner) Provision(ctx context.Context, ui Ui, comm Communicator) error {
+	result, err := interpolate.Render(p.When, p.context(ctx, comm))
+	if err != nil {
+		return fmt.Errorf("Error evaluating condition '%s': %s", p.When, err)
+	}
+
+	run, err := strconv.ParseBool(strings.TrimSpace(result))
+	if err != nil {
+		return fmt.Errorf("Condition '%s' must be true or false, got '%s'", p.When, result)
+	}
+
+	if !run {
+		ui.Say(fmt.Sprintf("Skipping provisioner, condition '%s' is false", p.When))
+		return nil
+	}
+
+	return p.Provisioner.Provision(ctx, ui, comm)
+}
+
+// context returns a copy of the interpolation context with the functions
+// that query the guest through comm.
+func (p *ConditionalProvisioner) context(ctx context.Context, comm Communicator) *interpolate.Context {
+	ictx := *p.Context
+	ictx.Funcs = make(map[string]interface{})
+	for k, v := range p.Context.Funcs {
+		ictx.Funcs[k] = v
+	}
+
+	var guestOS string
+	ictx.Funcs["guest_os"] = func() (string, error) {
+		if guestOS != "" {
+			return guestOS, nil
+		}
+
+		var err error
+		guestOS, err = detectGuestOS(ctx, comm)
+		return guestOS, err
+	}
+	ictx.Funcs["probe"] = func(command string) (int, error) {
+		status, _, err := runProbe(ctx, comm, command)
+		return status, err
+	}
+	ictx.Funcs["probe_output"] = func(command string) (string, error) {
+		_, stdout, err := runProbe(ctx, comm, command)
+		return strings.TrimSpace(stdout), err
+	}
+
+	return &ictx
+}
+
+func detectGuestOS(ctx context.Context, comm Communicator) (string, error) {
+	status, stdout, err := runProbe(ctx, comm, "uname -s")
+	if err != nil {
+		return "", err
+	}
+	if status == 0 && strings.TrimSpace(stdout) != "" {
+		return strings.ToLower(strings.TrimSpace(stdout)), nil
+	}
+
+	status, stdout, err = runProbe(ctx, comm, "cmd /c ver")
+	if err != nil {
+		return "", err
+	}
+	if status == 0 && strings.Contains(stdout, "Windows") {
+		return "windows", nil
+	}
+
+	return "", fmt.Errorf("unable to detect the guest OS")
+}
+
+func runProbe(ctx context.Context, comm Communicator, command string) (int, string, error) {
+	if comm == nil {
+		return 0, "", fmt.Errorf("no communicator available to run '%s'", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd := &RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  new(bytes.Buffer),
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, "", err
+	}
+	status := cmd.Wait()
+	log.Printf("[INFO] Probe '%s' exited with status %d", command, status)
+
+	if status == CmdDisconnect {
+		return 0, "", fmt.Errorf("disconnected while running '%s'", command)
+	}
+	return status, stdout.String(), nil
+}
@@ -0,0 +1,139 @@
+package packer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+func TestConditionalProvisioner_impl(t *testing.T) {
+	var _ Provisioner = new(ConditionalProvisioner)
+}
+
+func testConditionalProvisioner(when string) (*ConditionalProvisioner, *MockProvisioner) {
+	mock := new(MockProvisioner)
+	return &ConditionalProvisioner{
+		Provisioner: mock,
+		When:        when,
+		Context: &interpolate.Context{
+			BuildName:     "ubuntu",
+			BuildType:     "qemu",
+			UserVariables: map[string]string{"env": "prod"},
+		},
+	}, mock
+}
+
+func TestConditionalProvisionerProvision(t *testing.T) {
+	cases := []struct {
+		When     string
+		Expected bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`{{ eq (user "env") "prod" }}`, true},
+		{`{{ eq (user "env") "dev" }}`, false},
+		{`{{ and (eq build_type "qemu") (ne build_name "rhel") }}`, true},
+		{`{{ eq guest_os "linux" }}`, true},
+		{`{{ eq (probe "test -f /etc/redhat-release") 0 }}`, false},
+		{`{{ eq (probe_output "lsb_release -is") "Linux" }}`, true},
+	}
+
+	for _, tc := range cases {
+		prov, mock := testConditionalProvisioner(tc.When)
+		comm := &probeCommunicator{
+			results: map[string]probeResult{
+				"uname -s":        {0, "Linux\n"},
+				"lsb_release -is": {0, "Linux\n"},
+			},
+		}
+
+		if err := prov.Provision(context.Background(), testUi(), comm); err != nil {
+			t.Fatalf("%s: err: %s", tc.When, err)
+		}
+		if mock.ProvCalled != tc.Expected {
+			t.Fatalf("%s: expected provisioner to run: %t", tc.When, tc.Expected)
+		}
+	}
+}
+
+// probeCommunicator answers commands from a fixed table.
+type probeCommunicator struct {
+	MockCommunicator
+	results map[string]probeResult
+	ran     []string
+}
+
+type probeResult struct {
+	status int
+	stdout string
+}
+
+func (c *probeCommunicator) Start(ctx context.Context, cmd *RemoteCmd) error {
+	c.ran = append(c.ran, cmd.Command)
+	r, ok := c.results[cmd.Command]
+	if !ok {
+		r = probeResult{status: 1}
+	}
+	cmd.Stdout.Write([]byte(r.stdout))
+	cmd.SetExited(r.status)
+	return nil
+}
+
+func TestConditionalProvisionerProvision_guestOSWindows(t *testing.T) {
+	prov, mock := testConditionalProvisioner(`{{ or (eq guest_os "windows") (eq guest_os "darwin") }}`)
+
+	comm := &probeCommunicator{
+		results: map[string]probeResult{
+			"cmd /c ver": {0, "\r\nMicrosoft Windows [Version 10.0.17763.1]\r\n"},
+		},
+	}
+	if err := prov.Provision(context.Background(), testUi(), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !mock.ProvCalled {
+		t.Fatal("should run on windows")
+	}
+	if len(comm.ran) != 2 {
+		t.Fatalf("should detect the guest OS once: %#v", comm.ran)
+	}
+}
+
+func TestConditionalProvisionerProvision_guestOSUnknown(t *testing.T) {
+	prov, mock := testConditionalProvisioner(`{{ eq guest_os "linux" }}`)
+
+	if err := prov.Provision(context.Background(), testUi(), new(probeCommunicator)); err == nil {
+		t.Fatal("should have error")
+	}
+	if mock.ProvCalled {
+		t.Fatal("should not run")
+	}
+}
+
+func TestConditionalProvisionerProvision_notBool(t *testing.T) {
+	prov, mock := testConditionalProvisioner(`{{ user "env" }}`)
+
+	if err := prov.Provision(context.Background(), testUi(), new(MockCommunicator)); err == nil {
+		t.Fatal("should have error")
+	}
+	if mock.ProvCalled {
+		t.Fatal("should not run")
+	}
+}
+
+func TestConditionalProvisionerValidate(t *testing.T) {
+	prov, _ := testConditionalProvisioner(`{{ eq (probe "true") 0 }}`)
+	if err := prov.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	prov, _ = testConditionalProvisioner(`{{ eq (probe "true") 0 `)
+	if err := prov.Validate(); err == nil {
+		t.Fatal("should have error")
+	}
+
+	prov, _ = testConditionalProvisioner(`{{ nope }}`)
+	if err := prov.Validate(); err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -0,0 +1,75 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/packer/common/retry"
+)
+
+// RetriedProvisioner is a Provisioner implementation that runs the
+// provisioner again when it fails, waiting longer between every attempt.
+type RetriedProvisioner struct {
+	Provisioner
+
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+
+	// Backoff is the wait before the first retry. It doubles after each
+	// retry, up to a minute or Backoff itself if that is longer.
+	Backoff time.Duration
+
+	// RetryOn restricts the retries to the errors matching one of these
+	// expressions. All errors are retried if it is empty.
+	RetryOn []*regexp.Regexp
+}
+
+func (p *RetriedProvisioner) Provision(ctx context.Context, ui Ui, comm Communicator) error {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = 2 * time.Second
+	}
+	maxBackoff := time.Minute
+	if backoff > maxBackoff {
+		maxBackoff = backoff
+	}
+	b := &retry.Backoff{
+		InitialBackoff: backoff,
+		MaxBackoff:     maxBackoff,
+		Multiplier:     2,
+	}
+
+	tries := p.MaxRetries + 1
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			ui.Say(fmt.Sprintf("Retrying provisioner (attempt %d of %d)...", attempt, tries))
+		}
+
+		err := p.Provisioner.Provision(ctx, ui, comm)
+		if err == nil || attempt == tries || !p.shouldRetry(err) || ctx.Err() != nil {
+			return err
+		}
+		ui.Error(fmt.Sprintf("Provisioner failed: %s", err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(b.Linear()):
+		}
+	}
+}
+
+func (p *RetriedProvisioner) shouldRetry(err error) bool {
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+
+	for _, re := range p.RetryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
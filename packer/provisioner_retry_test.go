@@ -0,0 +1,162 @@
+package packer
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRetriedProvisioner_impl(t *testing.T) {
+	var _ Provisioner = new(RetriedProvisioner)
+}
+
+func TestRetriedProvisionerProvision(t *testing.T) {
+	calls := 0
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("connection reset by peer")
+			}
+			return nil
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  3,
+		Backoff:     time.Millisecond,
+	}
+
+	if err := prov.Provision(context.Background(), testUi(), new(MockCommunicator)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetriedProvisionerProvision_exhausted(t *testing.T) {
+	calls := 0
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			calls++
+			return errors.New("failed")
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  2,
+		Backoff:     time.Millisecond,
+	}
+
+	err := prov.Provision(context.Background(), testUi(), new(MockCommunicator))
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("expected the provisioner error, got: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetriedProvisionerProvision_retryOn(t *testing.T) {
+	calls := 0
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			calls++
+			if calls == 1 {
+				return errors.New("Script exited with non-zero exit status: 100")
+			}
+			return errors.New("Script exited with non-zero exit status: 1")
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  5,
+		Backoff:     time.Millisecond,
+		RetryOn:     []*regexp.Regexp{regexp.MustCompile(`exit status: 100$`)},
+	}
+
+	err := prov.Provision(context.Background(), testUi(), new(MockCommunicator))
+	if err == nil || err.Error() != "Script exited with non-zero exit status: 1" {
+		t.Fatalf("expected the non matching error, got: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestRetriedProvisionerProvision_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			calls++
+			cancel()
+			return errors.New("cancelled")
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  5,
+		Backoff:     time.Millisecond,
+	}
+
+	if err := prov.Provision(ctx, testUi(), new(MockCommunicator)); err == nil {
+		t.Fatal("should have error")
+	}
+	if calls != 1 {
+		t.Fatalf("should not retry after cancellation, got %d attempts", calls)
+	}
+}
+
+func TestRetriedProvisionerProvision_noWaitAfterLastAttempt(t *testing.T) {
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			return errors.New("failed")
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  1,
+		Backoff:     200 * time.Millisecond,
+	}
+
+	start := time.Now()
+	if err := prov.Provision(context.Background(), testUi(), new(MockCommunicator)); err == nil {
+		t.Fatal("should have error")
+	}
+	// A single wait, between the two attempts
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed >= 400*time.Millisecond {
+		t.Fatalf("unexpected duration: %s", elapsed)
+	}
+}
+
+func TestRetriedProvisionerProvision_cancelWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	mock := &MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			calls++
+			return errors.New("failed")
+		},
+	}
+	prov := &RetriedProvisioner{
+		Provisioner: mock,
+		MaxRetries:  5,
+		Backoff:     time.Minute,
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := prov.Provision(ctx, testUi(), new(MockCommunicator)); err == nil {
+		t.Fatal("should have error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelling should interrupt the wait, took %s", elapsed)
+	}
+	if calls != 1 {
+		t.Fatalf("should not retry after cancellation, got %d attempts", calls)
+	}
+}
@@ -36,6 +36,7 @@ type CommunicatorStartArgs struct {
 	StdoutStreamId   uint32
 	StderrStreamId   uint32
 	ResponseStreamId uint32
+	Pty              *packer.PtyConfig
 }
 
 type CommunicatorDownloadArgs struct {
@@ -68,6 +69,7 @@ func Communicator(client *rpc.Client) *communicator {
 func (c *communicator) Start(ctx context.Context, cmd *packer.RemoteCmd) (err error) {
 	var args CommunicatorStartArgs
 	args.Command = cmd.Command
+	args.Pty = cmd.Pty
 
 	var wg sync.WaitGroup
 
@@ -208,6 +210,7 @@ func (c *CommunicatorServer) Start(args *CommunicatorStartArgs, reply *interface
 	// to the remote side.
 	var cmd packer.RemoteCmd
 	cmd.Command = args.Command
+	cmd.Pty = args.Pty
 
 	// Create a channel to signal we're done so that we can close
 	// our stdin/stdout/stderr streams
@@ -9,6 +9,10 @@ const BuilderId = "packer.post-processor.compress"
 
 type Artifact struct {
 	Path string
+
+	// Parts lists the parts of a split archive, in which case Path is the
+	// index of the parts.
+	Parts []string
 }
 
 func (a *Artifact) BuilderId() string {
@@ -20,7 +24,7 @@ func (*Artifact) Id() string {
 }
 
 func (a *Artifact) Files() []string {
-	return []string{a.Path}
+	return append(append([]string{}, a.Parts...), a.Path)
 }
 
 func (a *Artifact) String() string {
@@ -32,5 +36,10 @@ func (*Artifact) State(name string) interface{} {
 }
 
 func (a *Artifact) Destroy() error {
+	for _, part := range a.Parts {
+		if err := os.Remove(part); err != nil {
+			return err
+		}
+	}
 	return os.Remove(a.Path)
 }
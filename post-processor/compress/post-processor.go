@@ -16,6 +16,7 @@ import (
 	"github.com/hashicorp/packer/helper/config"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/template/interpolate"
+	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 	"github.com/pierrec/lz4"
 	"github.com/ulikunitz/xz"
@@ -40,10 +41,12 @@ type Config struct {
 	OutputPath       string `mapstructure:"output"`
 	Format           string `mapstructure:"format"`
 	CompressionLevel int    `mapstructure:"compression_level"`
+	SplitSize        string `mapstructure:"split_size"`
 
 	// Derived fields
 	Archive   string
 	Algorithm string
+	splitSize int64
 
 	ctx interpolate.Context
 }
@@ -90,6 +93,17 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 			errs, fmt.Errorf("Error parsing target template: %s", err))
 	}
 
+	if p.config.SplitSize != "" {
+		p.config.splitSize, err = parseSize(p.config.SplitSize)
+		if err == nil && p.config.splitSize <= 0 {
+			err = fmt.Errorf("must be positive")
+		}
+		if err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid split_size: %s", err))
+		}
+	}
+
 	p.config.detectFromFilename()
 
 	if len(errs.Errors) > 0 {
@@ -120,10 +134,20 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact
 		return nil, false, false, fmt.Errorf(
 			"Unable to create dir for archive %s: %s", target, err)
 	}
-	outputFile, err := os.Create(target)
-	if err != nil {
-		return nil, false, false, fmt.Errorf(
-			"Unable to create archive %s: %s", target, err)
+
+	// The archive goes to a file, or to parts of split_size bytes along
+	// with their index.
+	var outputFile io.WriteCloser
+	var splitter *splitWriter
+	if p.config.splitSize > 0 {
+		splitter = newSplitWriter(target, p.config.splitSize)
+		outputFile = splitter
+	} else {
+		outputFile, err = os.Create(target)
+		if err != nil {
+			return nil, false, false, fmt.Errorf(
+				"Unable to create archive %s: %s", target, err)
+		}
 	}
 	defer outputFile.Close()
 
@@ -135,25 +159,40 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact
 		ui.Say(fmt.Sprintf("Using bgzf compression with %d cores for %s",
 			runtime.GOMAXPROCS(-1), target))
 		output, err = makeBGZFWriter(outputFile, p.config.CompressionLevel)
-		defer output.Close()
 	case "lz4":
 		ui.Say(fmt.Sprintf("Using lz4 compression with %d cores for %s",
 			runtime.GOMAXPROCS(-1), target))
 		output, err = makeLZ4Writer(outputFile, p.config.CompressionLevel)
-		defer output.Close()
 	case "xz":
 		ui.Say(fmt.Sprintf("Using xz compression with 1 core for %s (library does not support MT)",
 			target))
 		output, err = makeXZWriter(outputFile)
-		defer output.Close()
 	case "pgzip":
 		ui.Say(fmt.Sprintf("Using pgzip compression with %d cores for %s",
 			runtime.GOMAXPROCS(-1), target))
 		output, err = makePgzipWriter(outputFile, p.config.CompressionLevel)
-		defer output.Close()
+	case "zstd":
+		ui.Say(fmt.Sprintf("Using zstd compression with %d cores for %s",
+			runtime.GOMAXPROCS(-1), target))
+		output, err = makeZstdWriter(outputFile, p.config.CompressionLevel)
 	default:
 		output = outputFile
 	}
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	// The compressors flush their last bytes when closed, which must happen
+	// before the file is closed.
+	outputClosed := false
+	closeOutput := func() error {
+		if outputClosed || output == outputFile {
+			return nil
+		}
+		outputClosed = true
+		return output.Close()
+	}
+	defer closeOutput()
 
 	compression := p.config.Algorithm
 	if compression == "" {
@@ -199,6 +238,24 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact
 		}
 	}
 
+	if err := closeOutput(); err != nil {
+		return nil, false, false, fmt.Errorf("Failed to compress %s: %s", target, err)
+	}
+	if err := outputFile.Close(); err != nil {
+		return nil, false, false, fmt.Errorf("Failed to write %s: %s", target, err)
+	}
+
+	if splitter != nil {
+		index := target + ".parts.json"
+		if err := splitter.WriteIndex(index); err != nil {
+			return nil, false, false, fmt.Errorf("Failed to write index %s: %s", index, err)
+		}
+		newArtifact.Path = index
+		newArtifact.Parts = splitter.Files()
+		ui.Say(fmt.Sprintf("Split %s in %d parts, listed in %s",
+			target, len(newArtifact.Parts), index))
+	}
+
 	ui.Say(fmt.Sprintf("Archive %s completed", target))
 
 	return newArtifact, false, false, nil
@@ -214,6 +271,7 @@ func (config *Config) detectFromFilename() {
 		"lz4":  "lz4",
 		"bgzf": "bgzf",
 		"xz":   "xz",
+		"zst":  "zstd",
 	}
 
 	if config.Format == "" {
@@ -278,6 +336,26 @@ func makeLZ4Writer(output io.WriteCloser, compressionLevel int) (io.WriteCloser,
 	return lzwriter, nil
 }
 
+// makeZstdWriter maps compressionLevel, from 1 to 9, onto the zstd encoder
+// levels, which go from fastest to best compression.
+func makeZstdWriter(output io.WriteCloser, compressionLevel int) (io.WriteCloser, error) {
+	level := zstd.SpeedDefault
+	switch {
+	case compressionLevel <= 0:
+	case compressionLevel <= 2:
+		level = zstd.SpeedFastest
+	case compressionLevel <= 5:
+		level = zstd.SpeedDefault
+	case compressionLevel <= 8:
+		level = zstd.SpeedBetterCompression
+	default:
+		level = zstd.SpeedBestCompression
+	}
+	return zstd.NewWriter(output,
+		zstd.WithEncoderLevel(level),
+		zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(-1)))
+}
+
 func makeXZWriter(output io.WriteCloser) (io.WriteCloser, error) {
 	xzwriter, err := xz.NewWriter(output)
 	if err != nil {
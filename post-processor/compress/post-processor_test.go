@@ -1,8 +1,13 @@
 package compress
 
 import (
+	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -12,6 +17,7 @@ import (
 	"github.com/hashicorp/packer/builder/file"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/template"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestDetectFilename(t *testing.T) {
@@ -54,6 +60,41 @@ func TestDetectFilename(t *testing.T) {
 	if lotsOfDots.Algorithm != "lz4" {
 		t.Error("Expected to find lz4 algorithm setting")
 	}
+
+	// Test .tar.zst
+	zstdFilename := Config{OutputPath: "test.tar.zst"}
+	zstdFilename.detectFromFilename()
+	if zstdFilename.Archive != "tar" {
+		t.Error("Expected to find tar archive setting")
+	}
+	if zstdFilename.Algorithm != "zstd" {
+		t.Error("Expected to find zstd algorithm setting")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"1024":  1024,
+		"500M":  500 * 1024 * 1024,
+		"4G":    4 * 1024 * 1024 * 1024,
+		"2 GiB": 2 * 1024 * 1024 * 1024,
+		"16kb":  16 * 1024,
+	}
+	for s, expected := range cases {
+		size, err := parseSize(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if size != expected {
+			t.Fatalf("%s: expected %d, got %d", s, expected, size)
+		}
+	}
+
+	for _, s := range []string{"", "G", "1.5G", "4P"} {
+		if _, err := parseSize(s); err == nil {
+			t.Fatalf("%s: should have error", s)
+		}
+	}
 }
 
 const expectedFileContents = "Hello world!"
@@ -151,6 +192,101 @@ func TestCompressOptions(t *testing.T) {
 	}
 }
 
+func TestCompressZstd(t *testing.T) {
+	const config = `
+	{
+	    "post-processors": [
+	        {
+	            "type": "compress",
+	            "output": "package.zst",
+	            "compression_level": 9
+	        }
+	    ]
+	}
+	`
+
+	artifact := testArchive(t, config)
+	defer artifact.Destroy()
+
+	archive, err := os.Open("package.zst")
+	if err != nil {
+		t.Fatalf("Unable to read archive: %s", err)
+	}
+	defer archive.Close()
+	zstdReader, err := zstd.NewReader(archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer zstdReader.Close()
+	data, _ := ioutil.ReadAll(zstdReader)
+
+	if string(data) != expectedFileContents {
+		t.Errorf("Expected:\n%s\nFound:\n%s\n", expectedFileContents, data)
+	}
+}
+
+func TestCompressSplit(t *testing.T) {
+	const config = `
+	{
+	    "post-processors": [
+	        {
+	            "type": "compress",
+	            "output": "package.tar",
+	            "split_size": "1000"
+	        }
+	    ]
+	}
+	`
+
+	artifact := testArchive(t, config)
+	defer artifact.Destroy()
+
+	files := artifact.Files()
+	if files[len(files)-1] != "package.tar.parts.json" {
+		t.Fatalf("Expected the index last: %v", files)
+	}
+	data, err := ioutil.ReadFile("package.tar.parts.json")
+	if err != nil {
+		t.Fatalf("Unable to read index: %s", err)
+	}
+	var index SplitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A tar of one small file is 2048 bytes: the header, the data and the
+	// two empty blocks of the end.
+	if len(index.Parts) != 3 || len(files) != 4 {
+		t.Fatalf("Expected 3 parts: %#v", index)
+	}
+	var tarball bytes.Buffer
+	for i, part := range index.Parts {
+		if part.Name != fmt.Sprintf("package.tar.%03d", i) {
+			t.Fatalf("Unexpected part: %#v", part)
+		}
+		data, err := ioutil.ReadFile(part.Name)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != part.SHA256 {
+			t.Fatalf("Checksum mismatch for %s", part.Name)
+		}
+		tarball.Write(data)
+	}
+	if int64(tarball.Len()) != index.Size {
+		t.Fatalf("Expected %d bytes, got %d", index.Size, tarball.Len())
+	}
+
+	reader := tar.NewReader(&tarball)
+	if _, err := reader.Next(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	contents, _ := ioutil.ReadAll(reader)
+	if string(contents) != expectedFileContents {
+		t.Errorf("Expected:\n%s\nFound:\n%s\n", expectedFileContents, contents)
+	}
+}
+
 func TestCompressInterpolation(t *testing.T) {
 	const config = `
 	{
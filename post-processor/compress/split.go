@@ -0,0 +1,163 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxParts is the number of parts the three digits suffix allows.
+const maxParts = 1000
+
+var sizePattern = regexp.MustCompile(`^(\d+)\s*([kmgt]?)(?:i?b)?$`)
+
+// parseSize reads a size in bytes, with an optional K, M, G or T binary
+// unit, as in "4G".
+func parseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	size, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %s", s, err)
+	}
+	if m[2] != "" {
+		size <<= uint(10 * (strings.Index("kmgt", m[2]) + 1))
+	}
+	return size, nil
+}
+
+// SplitIndex describes an archive split in parts. Concatenating the parts
+// in order gives the archive back.
+type SplitIndex struct {
+	Name   string      `json:"name"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256"`
+	Parts  []SplitPart `json:"parts"`
+}
+
+// SplitPart is a part of a split archive. Its name is relative to the
+// directory of the index.
+type SplitPart struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// splitWriter writes to parts of at most size bytes, named after path with
+// a numbered suffix: path.000, path.001, etc.
+type splitWriter struct {
+	path string
+	size int64
+
+	file  *os.File
+	hash  hash.Hash
+	part  SplitPart
+	total hash.Hash
+	index SplitIndex
+	files []string
+}
+
+func newSplitWriter(path string, size int64) *splitWriter {
+	return &splitWriter{
+		path:  path,
+		size:  size,
+		total: sha256.New(),
+		index: SplitIndex{Name: filepath.Base(path)},
+	}
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.file == nil {
+			if err := w.next(); err != nil {
+				return written, err
+			}
+		}
+
+		n := int64(len(p))
+		if left := w.size - w.part.Size; n > left {
+			n = left
+		}
+		m, err := w.file.Write(p[:n])
+		w.hash.Write(p[:m])
+		w.total.Write(p[:m])
+		w.part.Size += int64(m)
+		w.index.Size += int64(m)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[m:]
+
+		if w.part.Size == w.size {
+			if err := w.finish(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close closes the last part. An empty input still gets one, empty, part.
+func (w *splitWriter) Close() error {
+	if w.file == nil && len(w.index.Parts) == 0 {
+		if err := w.next(); err != nil {
+			return err
+		}
+	}
+	if w.file != nil {
+		return w.finish()
+	}
+	return nil
+}
+
+// WriteIndex writes the index of the parts to path, once closed.
+func (w *splitWriter) WriteIndex(path string) error {
+	w.index.SHA256 = hex.EncodeToString(w.total.Sum(nil))
+	data, err := json.MarshalIndent(&w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Files returns the paths of the parts.
+func (w *splitWriter) Files() []string {
+	return w.files
+}
+
+func (w *splitWriter) next() error {
+	if len(w.index.Parts) >= maxParts {
+		return fmt.Errorf("more than %d parts, split_size is too small", maxParts)
+	}
+
+	path := fmt.Sprintf("%s.%03d", w.path, len(w.index.Parts))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.hash = sha256.New()
+	w.part = SplitPart{Name: filepath.Base(path)}
+	w.files = append(w.files, path)
+	return nil
+}
+
+func (w *splitWriter) finish() error {
+	err := w.file.Close()
+	w.file = nil
+	w.part.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	w.index.Parts = append(w.index.Parts, w.part)
+	return err
+}
@@ -0,0 +1,49 @@
+package diskconvert
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const BuilderId = "packer.post-processor.disk-convert"
+
+// Artifact holds the converted disks.
+type Artifact struct {
+	format string
+	paths  []string
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (*Artifact) Id() string {
+	return ""
+}
+
+func (a *Artifact) Files() []string {
+	pathsCopy := make([]string, len(a.paths))
+	copy(pathsCopy, a.paths)
+	return pathsCopy
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("%s disks: %s", a.format, strings.Join(a.paths, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	if name == "disk_format" {
+		return a.format
+	}
+	return nil
+}
+
+func (a *Artifact) Destroy() error {
+	for _, path := range a.paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
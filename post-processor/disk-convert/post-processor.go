@@ -0,0 +1,340 @@
+package diskconvert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// diskFormat is a disk format qemu-img can write.
+type diskFormat struct {
+	// The name of the format for qemu-img.
+	driver string
+
+	// The extension of the converted disks.
+	extension string
+
+	// The subformats of sparse and fully allocated disks, if the format
+	// has a subformat option.
+	sparse string
+	full   string
+}
+
+var formats = map[string]diskFormat{
+	"qcow2": {driver: "qcow2", extension: "qcow2"},
+	"raw":   {driver: "raw", extension: "raw"},
+	"vmdk":  {driver: "vmdk", extension: "vmdk", sparse: "monolithicSparse", full: "monolithicFlat"},
+	"vhd":   {driver: "vpc", extension: "vhd", sparse: "dynamic", full: "fixed"},
+	"vhdx":  {driver: "vhdx", extension: "vhdx", sparse: "dynamic", full: "fixed"},
+	"vdi":   {driver: "vdi", extension: "vdi", sparse: "dynamic", full: "static"},
+}
+
+// diskExtensions are the extensions of the files that may be disks. Files
+// without an extension, like the disks of the qemu builder, may be disks
+// too.
+var diskExtensions = map[string]bool{
+	".qcow2": true,
+	".qcow":  true,
+	".img":   true,
+	".raw":   true,
+	".vmdk":  true,
+	".vhd":   true,
+	".vhdx":  true,
+	".vdi":   true,
+}
+
+// vmdkExtentPattern matches the extents of split and flat VMDK disks, which
+// are read through their descriptor.
+var vmdkExtentPattern = regexp.MustCompile(`-(s\d{3}|f\d{3}|flat)\.vmdk$`)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The format to convert the disks to.
+	Format string `mapstructure:"format"`
+
+	// The directory to write the converted disks to. Defaults to
+	// output-disk-convert-<build name>, out of the directory of the input
+	// artifact, which is usually removed once converted.
+	OutputDir string `mapstructure:"output_directory"`
+
+	// Whether to write sparse disks. Defaults to true.
+	Sparse *bool `mapstructure:"sparse"`
+
+	// Whether to compress qcow2 disks.
+	Compress bool `mapstructure:"compress"`
+
+	// Options of the target format, passed to qemu-img with -o.
+	Options map[string]string `mapstructure:"options"`
+
+	// The path of the qemu-img program.
+	QemuImgPath string `mapstructure:"qemu_img_path"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+// imageInfo is the part of the output of qemu-img info used here.
+type imageInfo struct {
+	Format      string `json:"format"`
+	VirtualSize int64  `json:"virtual-size"`
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	p.config.Format = strings.ToLower(p.config.Format)
+	format, ok := formats[p.config.Format]
+	if p.config.Format == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("format must be specified"))
+	} else if !ok {
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("Unsupported format: %s", p.config.Format))
+	}
+
+	if p.config.OutputDir == "" {
+		p.config.OutputDir = fmt.Sprintf("output-disk-convert-%s", p.config.PackerBuildName)
+	}
+
+	if p.config.Sparse == nil {
+		sparse := true
+		p.config.Sparse = &sparse
+	}
+
+	if p.config.Compress && format.driver != "qcow2" {
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("compress is only supported for qcow2 disks"))
+	}
+
+	if p.config.QemuImgPath == "" {
+		p.config.QemuImgPath = "qemu-img"
+	}
+	if _, err := exec.LookPath(p.config.QemuImgPath); err != nil {
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("qemu-img not found: %s", err))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	disks, err := p.findDisks(ctx, artifact.Files())
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(disks) == 0 {
+		return nil, false, false, fmt.Errorf(
+			"No disk found in the artifact: %s", strings.Join(artifact.Files(), ", "))
+	}
+
+	// Destroying the input artifact usually removes its whole directory,
+	// with the converted disks if they were written there.
+	keep := false
+	for _, source := range disks {
+		target := p.targetPath(source.path)
+		if target == source.path {
+			return nil, false, false, fmt.Errorf(
+				"Can't convert %s in place: set output_directory to another directory", source.path)
+		}
+		if inDirectoryOf(target, artifact.Files()) {
+			log.Printf("%s is written in the directory of the input artifact, keeping it", target)
+			keep = true
+		}
+	}
+
+	if err := os.MkdirAll(p.config.OutputDir, 0755); err != nil {
+		return nil, false, false, fmt.Errorf("Error creating %s: %s", p.config.OutputDir, err)
+	}
+
+	newArtifact := &Artifact{format: p.config.Format}
+	for _, source := range disks {
+		target := p.targetPath(source.path)
+		ui.Message(fmt.Sprintf("Converting %s (%s) to %s", source.path, source.info.Format, target))
+
+		if _, err := p.qemuImg(ctx, p.convertArgs(source.path, source.info.Format, target)...); err != nil {
+			os.Remove(target)
+			newArtifact.Destroy()
+			return nil, false, false, fmt.Errorf("Error converting %s: %s", source.path, err)
+		}
+
+		newArtifact.paths = append(newArtifact.paths, target)
+		if extent := p.flatExtent(target); extent != "" {
+			newArtifact.paths = append(newArtifact.paths, extent)
+		}
+	}
+
+	return newArtifact, keep, keep, nil
+}
+
+// inDirectoryOf returns whether path is in the directory, or a
+// subdirectory, of one of the files.
+func inDirectoryOf(path string, files []string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// disk is a disk of the input artifact.
+type disk struct {
+	path string
+	info imageInfo
+}
+
+// findDisks returns the disks among files.
+func (p *PostProcessor) findDisks(ctx context.Context, files []string) ([]disk, error) {
+	var disks []disk
+	for _, path := range files {
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != "" && !diskExtensions[ext] {
+			continue
+		}
+		if vmdkExtentPattern.MatchString(strings.ToLower(path)) {
+			continue
+		}
+
+		out, err := p.qemuImg(ctx, "info", "--output=json", path)
+		if err != nil {
+			if ext == "" {
+				// Not a disk after all.
+				log.Printf("Skipping %s: %s", path, err)
+				continue
+			}
+			return nil, fmt.Errorf("Error reading %s: %s", path, err)
+		}
+		var info imageInfo
+		if err := json.Unmarshal(out, &info); err != nil {
+			return nil, fmt.Errorf("Error reading the qemu-img info of %s: %s", path, err)
+		}
+
+		// Any file is a raw disk for qemu-img: only trust raw disks without
+		// an extension, like those of the qemu builder, or with an extension
+		// saying so.
+		if info.Format == "raw" && ext != "" && ext != ".raw" && ext != ".img" {
+			log.Printf("Skipping %s, which is not a disk", path)
+			continue
+		}
+		disks = append(disks, disk{path: path, info: info})
+	}
+
+	sort.SliceStable(disks, func(i, j int) bool { return disks[i].path < disks[j].path })
+	return disks, nil
+}
+
+// targetPath returns the path of the converted disk, with the extension of
+// the format.
+func (p *PostProcessor) targetPath(source string) string {
+	name := filepath.Base(source)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(p.config.OutputDir, name+"."+formats[p.config.Format].extension)
+}
+
+// flatExtent returns the path of the extent holding the data of a
+// monolithicFlat VMDK disk, next to its descriptor.
+func (p *PostProcessor) flatExtent(target string) string {
+	if p.config.Format != "vmdk" {
+		return ""
+	}
+	subformat := formats["vmdk"].sparse
+	if !*p.config.Sparse {
+		subformat = formats["vmdk"].full
+	}
+	if v, ok := p.config.Options["subformat"]; ok {
+		subformat = v
+	}
+	if subformat != "monolithicFlat" {
+		return ""
+	}
+	return strings.TrimSuffix(target, ".vmdk") + "-flat.vmdk"
+}
+
+func (p *PostProcessor) convertArgs(source, sourceFormat, target string) []string {
+	format := formats[p.config.Format]
+
+	args := []string{"convert", "-f", sourceFormat, "-O", format.driver}
+	if p.config.Compress {
+		args = append(args, "-c")
+	}
+	if !*p.config.Sparse {
+		// Write every sector, zeros included.
+		args = append(args, "-S", "0")
+	}
+
+	options := make(map[string]string)
+	if format.sparse != "" {
+		options["subformat"] = format.sparse
+		if !*p.config.Sparse {
+			options["subformat"] = format.full
+		}
+	}
+	for k, v := range p.config.Options {
+		options[k] = v
+	}
+	if len(options) > 0 {
+		keys := make([]string, 0, len(options))
+		for k := range options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			keys[i] = k + "=" + options[k]
+		}
+		args = append(args, "-o", strings.Join(keys, ","))
+	}
+
+	return append(args, source, target)
+}
+
+func (p *PostProcessor) qemuImg(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	log.Printf("Executing qemu-img: %#v", args)
+	cmd := exec.CommandContext(ctx, p.config.QemuImgPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("qemu-img error: %s\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
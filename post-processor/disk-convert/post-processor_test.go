@@ -0,0 +1,287 @@
+package diskconvert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+// testQemuImg writes a fake qemu-img, which logs its arguments, reports the
+// format of the disks after their extension and copies them to convert
+// them.
+func testQemuImg(t *testing.T, dir string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake qemu-img is a shell script")
+	}
+
+	script := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(dir, "qemu-img.log") + `"
+case "$1" in
+info)
+  case "$3" in
+  *.qcow2) echo '{"format": "qcow2", "virtual-size": 1024}' ;;
+  *.vmdk) echo '{"format": "vmdk", "virtual-size": 1024}' ;;
+  *) echo '{"format": "raw", "virtual-size": 1024}' ;;
+  esac ;;
+convert)
+  for last; do :; done
+  for src; do [ "$src" = "$last" ] && break; prev="$src"; done
+  cp "$prev" "$last" ;;
+esac
+`
+	path := filepath.Join(dir, "qemu-img")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return path
+}
+
+// testFiles writes files named after their content in dir.
+func testFiles(t *testing.T, dir string, names ...string) []string {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var files []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// dirArtifact removes its whole directory when destroyed, like the
+// artifacts of the qemu and virtualbox builders.
+type dirArtifact struct {
+	packer.MockArtifact
+	dir string
+}
+
+func (a *dirArtifact) Destroy() error {
+	return os.RemoveAll(a.dir)
+}
+
+func testConfig(qemuImg string) map[string]interface{} {
+	return map[string]interface{}{
+		"format":        "vhdx",
+		"qemu_img_path": qemuImg,
+	}
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-disk-convert")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	qemuImg := testQemuImg(t, td)
+
+	var p PostProcessor
+	if err := p.Configure(testConfig(qemuImg)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !*p.config.Sparse {
+		t.Fatal("should be sparse by default")
+	}
+
+	cases := []map[string]interface{}{
+		{"format": ""},
+		{"format": "qed"},
+		{"format": "vdi", "compress": true},
+		{"qemu_img_path": filepath.Join(td, "missing")},
+	}
+	for _, c := range cases {
+		p = PostProcessor{}
+		if err := p.Configure(testConfig(qemuImg), c); err == nil {
+			t.Fatalf("should have error: %#v", c)
+		}
+	}
+}
+
+func TestPostProcessorConvertArgs(t *testing.T) {
+	p := PostProcessor{config: Config{Format: "vhd"}}
+	sparse := false
+	p.config.Sparse = &sparse
+	args := p.convertArgs("disk.qcow2", "qcow2", "disk.vhd")
+	expected := []string{"convert", "-f", "qcow2", "-O", "vpc", "-S", "0", "-o", "subformat=fixed", "disk.qcow2", "disk.vhd"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+
+	p = PostProcessor{config: Config{Format: "vmdk", Options: map[string]string{"subformat": "streamOptimized"}}}
+	sparse = true
+	p.config.Sparse = &sparse
+	args = p.convertArgs("disk", "raw", "disk.vmdk")
+	expected = []string{"convert", "-f", "raw", "-O", "vmdk", "-o", "subformat=streamOptimized", "disk", "disk.vmdk"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+
+	p = PostProcessor{config: Config{Format: "qcow2", Compress: true, Sparse: &sparse}}
+	args = p.convertArgs("disk.vdi", "vdi", "disk.qcow2")
+	expected = []string{"convert", "-f", "vdi", "-O", "qcow2", "-c", "disk.vdi", "disk.qcow2"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-disk-convert")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	qemuImg := testQemuImg(t, td)
+
+	files := testFiles(t, filepath.Join(td, "output-qemu"),
+		"packer-ubuntu", "disk.vmdk", "disk-s001.vmdk", "ubuntu.vmx")
+
+	config := testConfig(qemuImg)
+	config["output_directory"] = filepath.Join(td, "hyperv")
+	var p PostProcessor
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), &packer.MockArtifact{FilesValue: files})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keep {
+		t.Fatal("should not keep the input artifact")
+	}
+
+	expected := []string{
+		filepath.Join(td, "hyperv", "disk.vhdx"),
+		filepath.Join(td, "hyperv", "packer-ubuntu.vhdx"),
+	}
+	if !reflect.DeepEqual(artifact.Files(), expected) {
+		t.Fatalf("unexpected files: %#v", artifact.Files())
+	}
+	for _, path := range expected {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(td, "qemu-img.log"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(log), "convert -f vmdk -O vhdx -o subformat=dynamic "+files[1]) {
+		t.Fatalf("unexpected qemu-img calls:\n%s", log)
+	}
+	if strings.Contains(string(log), "disk-s001.vmdk") {
+		t.Fatalf("the VMDK extents should be skipped:\n%s", log)
+	}
+
+	if err := artifact.Destroy(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(expected[0]); !os.IsNotExist(err) {
+		t.Fatal("the converted disks should be removed")
+	}
+}
+
+func TestPostProcessorPostProcess_defaultOutputDirectory(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-disk-convert")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	qemuImg := testQemuImg(t, td)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	files := testFiles(t, "output-qemu", "packer-ubuntu")
+	input := &dirArtifact{MockArtifact: packer.MockArtifact{FilesValue: files}, dir: "output-qemu"}
+
+	config := testConfig(qemuImg)
+	config["packer_build_name"] = "qemu"
+	var p PostProcessor
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keep {
+		t.Fatal("should not keep the input artifact")
+	}
+	expected := []string{filepath.Join("output-disk-convert-qemu", "packer-ubuntu.vhdx")}
+	if !reflect.DeepEqual(artifact.Files(), expected) {
+		t.Fatalf("unexpected files: %#v", artifact.Files())
+	}
+
+	// Packer destroys the input artifact, which must not take the converted
+	// disks with it.
+	if err := input.Destroy(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(expected[0]); err != nil {
+		t.Fatalf("the converted disk should remain: %s", err)
+	}
+}
+
+func TestPostProcessorPostProcess_inputDirectory(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-disk-convert")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	qemuImg := testQemuImg(t, td)
+
+	dir := filepath.Join(td, "output-qemu")
+	files := testFiles(t, dir, "disk.qcow2")
+	input := &packer.MockArtifact{FilesValue: files}
+
+	// Converting in place would overwrite the disk of the builder
+	config := testConfig(qemuImg)
+	config["format"] = "qcow2"
+	config["compress"] = true
+	config["output_directory"] = dir
+	var p PostProcessor
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), input); err == nil {
+		t.Fatal("should refuse to convert in place")
+	}
+
+	// The input artifact is kept when the disks are written in its directory
+	config = testConfig(qemuImg)
+	config["output_directory"] = dir
+	p = PostProcessor{}
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, keep, forceOverride, err := p.PostProcess(context.Background(), packer.TestUi(t), input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep || !forceOverride {
+		t.Fatal("should keep the input artifact")
+	}
+}
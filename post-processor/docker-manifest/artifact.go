@@ -0,0 +1,54 @@
+package dockermanifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+const BuilderId = "packer.post-processor.docker-manifest"
+
+// Artifact is a manifest list, or the image of a build waiting for the
+// other builds of the list.
+type Artifact struct {
+	// The names of the manifest list, one per tag.
+	Names []string
+
+	// The images of the list, by build name.
+	Images map[string]string
+
+	// Pushed is false when the image was recorded, and the manifest list
+	// is left to another build.
+	Pushed bool
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (*Artifact) Files() []string {
+	return nil
+}
+
+func (a *Artifact) Id() string {
+	return a.Names[0]
+}
+
+func (a *Artifact) String() string {
+	if !a.Pushed {
+		return fmt.Sprintf("Image recorded for the manifest list: %s", a.Names[0])
+	}
+	return fmt.Sprintf("Pushed manifest list: %s", strings.Join(a.Names, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	if name == "images" {
+		return a.Images
+	}
+	return nil
+}
+
+// Destroy does nothing: a manifest list can't be deleted from most
+// registries.
+func (*Artifact) Destroy() error {
+	return nil
+}
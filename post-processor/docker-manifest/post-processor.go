@@ -0,0 +1,235 @@
+package dockermanifest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/packer/builder/docker"
+	"github.com/hashicorp/packer/common"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	dockerimport "github.com/hashicorp/packer/post-processor/docker-import"
+	dockertag "github.com/hashicorp/packer/post-processor/docker-tag"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The repository of the manifest list, and its tags.
+	Repository string   `mapstructure:"repository"`
+	Tags       []string `mapstructure:"tags"`
+
+	// The names of the builds whose images make the manifest list.
+	Builds []string `mapstructure:"builds"`
+
+	// Whether the registry is served over plain HTTP.
+	Insecure bool `mapstructure:"insecure"`
+
+	Login                  bool
+	LoginUsername          string `mapstructure:"login_username"`
+	LoginPassword          string `mapstructure:"login_password"`
+	LoginServer            string `mapstructure:"login_server"`
+	EcrLogin               bool   `mapstructure:"ecr_login"`
+	docker.AwsAccessConfig `mapstructure:",squash"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	Driver docker.Driver
+
+	config Config
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	if p.config.Repository == "" {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("repository must be set"))
+	}
+	if len(p.config.Tags) == 0 {
+		p.config.Tags = []string{"latest"}
+	}
+	if len(p.config.Builds) == 0 {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("builds must list the builds of the manifest list"))
+	}
+	seen := make(map[string]bool)
+	for _, build := range p.config.Builds {
+		if seen[build] {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("build %s is listed twice", build))
+		}
+		seen[build] = true
+	}
+	// A build left out of the run with -only or -except never records its
+	// image, so the manifest list would never be pushed.
+	if len(p.config.PackerBuildNames) > 0 {
+		run := make(map[string]bool)
+		for _, build := range p.config.PackerBuildNames {
+			run[build] = true
+		}
+		for _, build := range p.config.Builds {
+			if !run[build] {
+				errs = packer.MultiErrorAppend(
+					errs, fmt.Errorf("build %s isn't part of this run, the manifest list can't be pushed", build))
+			}
+		}
+	}
+
+	if p.config.EcrLogin && p.config.LoginServer == "" {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("ECR login requires login server to be provided."))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	if artifact.BuilderId() != dockerimport.BuilderId &&
+		artifact.BuilderId() != dockertag.BuilderId {
+		err := fmt.Errorf(
+			"Unknown artifact type: %s\nCan only add docker-import, docker-tag and docker-push artifacts.",
+			artifact.BuilderId())
+		return nil, false, false, err
+	}
+
+	buildName := p.config.PackerBuildName
+	if !p.isListed(buildName) {
+		return nil, false, false, fmt.Errorf(
+			"Build %s is not listed in builds: %s", buildName, strings.Join(p.config.Builds, ", "))
+	}
+
+	driver := p.Driver
+	if driver == nil {
+		// If no driver is set, then we use the real driver
+		driver = &docker.DockerDriver{Ctx: &p.config.ctx, Ui: ui}
+	}
+
+	if p.config.EcrLogin {
+		ui.Message("Fetching ECR credentials...")
+
+		username, password, err := p.config.EcrGetLogin(p.config.LoginServer)
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		p.config.LoginUsername = username
+		p.config.LoginPassword = password
+	}
+
+	if p.config.Login || p.config.EcrLogin {
+		ui.Message("Logging in...")
+		err := driver.Login(
+			p.config.LoginServer,
+			p.config.LoginUsername,
+			p.config.LoginPassword)
+		if err != nil {
+			return nil, false, false, fmt.Errorf(
+				"Error logging in to Docker: %s", err)
+		}
+
+		defer func() {
+			ui.Message("Logging out...")
+			if err := driver.Logout(p.config.LoginServer); err != nil {
+				ui.Error(fmt.Sprintf("Error logging out: %s", err))
+			}
+		}()
+	}
+
+	// The manifest list references the images in the registry, so they
+	// are pushed first.
+	image := artifact.Id()
+	ui.Message("Pushing: " + image)
+	if err := driver.Push(image); err != nil {
+		return nil, false, false, err
+	}
+
+	names := make([]string, len(p.config.Tags))
+	for i, tag := range p.config.Tags {
+		names[i] = p.config.Repository + ":" + tag
+	}
+
+	state := newRunState(p.config.Repository)
+	images, err := state.add(buildName, image)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error recording the image: %s", err)
+	}
+
+	var missing, failed []string
+	for _, build := range p.config.Builds {
+		if _, ok := images[build]; ok {
+			continue
+		}
+		reason, err := commonhelper.RetrieveBuildFailed(build)
+		if err != nil {
+			log.Printf("Error reading the failure of build %s: %s", build, err)
+		}
+		if reason != "" {
+			failed = append(failed, build)
+		} else {
+			missing = append(missing, build)
+		}
+	}
+	if len(failed) > 0 {
+		state.remove()
+		return nil, false, false, fmt.Errorf(
+			"The manifest list can't be pushed, build %s failed", strings.Join(failed, ", "))
+	}
+	if len(missing) > 0 {
+		// The last build of the list pushes the manifest list, so that
+		// none waits for the others, whether they run in parallel or not.
+		ui.Message(fmt.Sprintf(
+			"Waiting for the images of %s, the last build pushes the manifest list",
+			strings.Join(missing, ", ")))
+		return &Artifact{Names: names, Images: images}, true, false, nil
+	}
+	defer state.remove()
+
+	refs := make([]string, len(p.config.Builds))
+	for i, build := range p.config.Builds {
+		refs[i] = images[build]
+	}
+	for _, name := range names {
+		ui.Message(fmt.Sprintf("Creating manifest list %s from: %s", name, strings.Join(refs, ", ")))
+		if err := driver.CreateManifest(name, refs, p.config.Insecure); err != nil {
+			return nil, false, false, fmt.Errorf("Error creating manifest list %s: %s", name, err)
+		}
+
+		ui.Message("Pushing: " + name)
+		if err := driver.PushManifest(name, p.config.Insecure); err != nil {
+			return nil, false, false, fmt.Errorf("Error pushing manifest list %s: %s", name, err)
+		}
+	}
+
+	return &Artifact{Names: names, Images: images, Pushed: true}, true, false, nil
+}
+
+func (p *PostProcessor) isListed(buildName string) bool {
+	for _, build := range p.config.Builds {
+		if build == buildName {
+			return true
+		}
+	}
+	return false
+}
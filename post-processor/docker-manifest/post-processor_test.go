@@ -0,0 +1,212 @@
+package dockermanifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer/builder/docker"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+	dockertag "github.com/hashicorp/packer/post-processor/docker-tag"
+)
+
+func testConfig(buildName string) map[string]interface{} {
+	return map[string]interface{}{
+		"repository":        "localhost:5000/foo/bar",
+		"tags":              []string{"1.0", "latest"},
+		"builds":            []string{"amd64", "arm64"},
+		"insecure":          true,
+		"packer_build_name": buildName,
+	}
+}
+
+func testPP(t *testing.T, buildName string, driver docker.Driver) *PostProcessor {
+	p := &PostProcessor{Driver: driver}
+	if err := p.Configure(testConfig(buildName)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return p
+}
+
+func testUi() *packer.BasicUi {
+	return &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+}
+
+func testRunUUID(t *testing.T) func() {
+	os.Setenv("PACKER_RUN_UUID", "docker-manifest-"+t.Name())
+	return func() {
+		newRunState("localhost:5000/foo/bar").remove()
+		commonhelper.RemoveRunSharedState()
+		os.Unsetenv("PACKER_RUN_UUID")
+	}
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{
+		"repository": "foo/bar",
+		"builds":     []string{"amd64"},
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.config.Tags, []string{"latest"}) {
+		t.Fatalf("bad tags: %v", p.config.Tags)
+	}
+
+	bad := []map[string]interface{}{
+		{"builds": []string{"amd64"}},
+		{"repository": "foo/bar"},
+		{"repository": "foo/bar", "builds": []string{"amd64", "amd64"}},
+		{"repository": "foo/bar", "builds": []string{"amd64"}, "ecr_login": true},
+		{"repository": "foo/bar", "builds": []string{"amd64", "arm64"}, "packer_build_names": []string{"amd64"}},
+	}
+	for _, raw := range bad {
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Fatalf("expected an error with %v", raw)
+		}
+	}
+}
+
+func TestPostProcessor_PostProcess(t *testing.T) {
+	defer testRunUUID(t)()
+
+	// The first build records its image
+	first := &docker.MockDriver{}
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: dockertag.BuilderId,
+		IdValue:        "localhost:5000/foo/bar:1.0-arm64",
+	}
+	result, keep, _, err := testPP(t, "arm64", first).PostProcess(context.Background(), testUi(), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep {
+		t.Fatal("should keep")
+	}
+	if !first.PushCalled || first.PushName != "localhost:5000/foo/bar:1.0-arm64" {
+		t.Fatalf("should push the image: %#v", first)
+	}
+	if first.CreateManifestCalled {
+		t.Fatal("should wait for the other build")
+	}
+	if result.(*Artifact).Pushed {
+		t.Fatal("should not be pushed")
+	}
+
+	// The last build pushes the manifest list
+	last := &docker.MockDriver{}
+	artifact.IdValue = "localhost:5000/foo/bar:1.0-amd64"
+	result, _, _, err = testPP(t, "amd64", last).PostProcess(context.Background(), testUi(), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !last.CreateManifestCalled || !last.PushManifestCalled {
+		t.Fatalf("should create and push the manifest list: %#v", last)
+	}
+	// The images are in the order of the builds
+	expected := []string{"localhost:5000/foo/bar:1.0-amd64", "localhost:5000/foo/bar:1.0-arm64"}
+	if !reflect.DeepEqual(last.CreateManifestImages, expected) {
+		t.Fatalf("bad images: %v", last.CreateManifestImages)
+	}
+	if !last.CreateManifestInsecure {
+		t.Fatal("should be insecure")
+	}
+	if last.PushManifestName != "localhost:5000/foo/bar:latest" {
+		t.Fatalf("bad name: %s", last.PushManifestName)
+	}
+	if !result.(*Artifact).Pushed || result.Id() != "localhost:5000/foo/bar:1.0" {
+		t.Fatalf("bad artifact: %#v", result)
+	}
+
+	if _, err := os.Stat(newRunState("localhost:5000/foo/bar").path); !os.IsNotExist(err) {
+		t.Fatal("the state should be removed")
+	}
+}
+
+func TestPostProcessor_PostProcess_login(t *testing.T) {
+	defer testRunUUID(t)()
+
+	driver := &docker.MockDriver{}
+	raw := testConfig("amd64")
+	raw["builds"] = []string{"amd64"}
+	raw["login"] = true
+	raw["login_server"] = "localhost:5000"
+	var p PostProcessor
+	p.Driver = driver
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: dockertag.BuilderId,
+		IdValue:        "localhost:5000/foo/bar:1.0-amd64",
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), testUi(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !driver.LoginCalled || driver.LoginRepo != "localhost:5000" || !driver.LogoutCalled {
+		t.Fatalf("should log in and out: %#v", driver)
+	}
+	if !driver.PushManifestCalled {
+		t.Fatal("should push the manifest list")
+	}
+}
+
+func TestPostProcessor_PostProcess_badBuild(t *testing.T) {
+	defer testRunUUID(t)()
+
+	driver := &docker.MockDriver{}
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: dockertag.BuilderId,
+		IdValue:        "localhost:5000/foo/bar:1.0-386",
+	}
+	_, _, _, err := testPP(t, "386", driver).PostProcess(context.Background(), testUi(), artifact)
+	if err == nil {
+		t.Fatal("should error with a build not listed")
+	}
+
+	artifact.BuilderIdValue = "packer.post-processor.compress"
+	_, _, _, err = testPP(t, "amd64", driver).PostProcess(context.Background(), testUi(), artifact)
+	if err == nil {
+		t.Fatal("should error with an unknown artifact")
+	}
+	if driver.PushCalled {
+		t.Fatal("should not push")
+	}
+}
+
+func TestPostProcessor_PostProcess_failedBuild(t *testing.T) {
+	defer testRunUUID(t)()
+
+	if err := commonhelper.SetBuildFailed("arm64", errors.New("bad")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	driver := &docker.MockDriver{}
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: dockertag.BuilderId,
+		IdValue:        "localhost:5000/foo/bar:1.0-amd64",
+	}
+	_, _, _, err := testPP(t, "amd64", driver).PostProcess(context.Background(), testUi(), artifact)
+	if err == nil {
+		t.Fatal("should error when a build of the list failed")
+	}
+	if driver.CreateManifestCalled {
+		t.Fatal("should not create the manifest list")
+	}
+	if _, err := os.Stat(newRunState("localhost:5000/foo/bar").path); !os.IsNotExist(err) {
+		t.Fatal("the state should be removed")
+	}
+}
@@ -0,0 +1,45 @@
+package dockermanifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+)
+
+// runState records the images the builds of a run pushed for a manifest
+// list. Each build runs its own post-processor, possibly in its own
+// process, so the state is kept in a file shared by the run.
+type runState struct {
+	path string
+}
+
+func newRunState(repository string) *runState {
+	uuid := os.Getenv("PACKER_RUN_UUID")
+	sum := sha256.Sum256([]byte(repository))
+	name := fmt.Sprintf("packer-%s-docker-manifest-%s", uuid, hex.EncodeToString(sum[:8]))
+	return &runState{path: filepath.Join(os.TempDir(), name)}
+}
+
+// add records the image of a build and returns the images of all the
+// builds recorded so far, by build name.
+func (s *runState) add(buildName, image string) (map[string]string, error) {
+	images := make(map[string]string)
+	err := commonhelper.UpdateJSONFile(s.path, &images, 0600, func() error {
+		images[buildName] = image
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// remove deletes the state once the manifest list is pushed. Its lock file
+// is left for Packer to remove at the end of the run.
+func (s *runState) remove() {
+	os.Remove(s.path)
+}
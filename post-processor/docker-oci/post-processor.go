@@ -0,0 +1,148 @@
+package dockeroci
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/hashicorp/packer/builder/docker"
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/post-processor/artifice"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+const BuilderId = "packer.post-processor.docker-oci"
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The path of the OCI image layout, a directory or a .tar archive.
+	OutputPath string `mapstructure:"output"`
+
+	RefName      string   `mapstructure:"ref_name"`
+	Changes      []string `mapstructure:"changes"`
+	Author       string   `mapstructure:"author"`
+	Message      string   `mapstructure:"message"`
+	Architecture string   `mapstructure:"architecture"`
+	OS           string   `mapstructure:"os"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+type outputPathTemplate struct {
+	BuildName   string
+	BuilderType string
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"output"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	if p.config.OutputPath == "" {
+		p.config.OutputPath = "packer_{{.BuildName}}_{{.BuilderType}}.oci.tar"
+	}
+	if err = interpolate.Validate(p.config.OutputPath, &p.config.ctx); err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing target template: %s", err))
+	}
+
+	if p.config.RefName == "" {
+		p.config.RefName = "latest"
+	}
+	if p.config.Architecture == "" {
+		p.config.Architecture = runtime.GOARCH
+	}
+	if p.config.OS == "" {
+		p.config.OS = "linux"
+	}
+
+	if err := new(docker.ImageConfig).ApplyChanges(p.config.Changes); err != nil {
+		errs = packer.MultiErrorAppend(errs, err)
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	switch artifact.BuilderId() {
+	case docker.BuilderId, artifice.BuilderId:
+		break
+	default:
+		err := fmt.Errorf(
+			"Unknown artifact type: %s\nCan only convert Docker builder and Artifice post-processor artifacts.",
+			artifact.BuilderId())
+		return nil, false, false, err
+	}
+
+	p.config.ctx.Data = &outputPathTemplate{
+		BuildName:   p.config.PackerBuildName,
+		BuilderType: p.config.PackerBuilderType,
+	}
+	target, err := interpolate.Render(p.config.OutputPath, &p.config.ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error interpolating output value: %s", err)
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		if !p.config.PackerForce {
+			return nil, false, false, fmt.Errorf(
+				"Output %s already exists, use -force to replace it", target)
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	var imageConfig docker.ImageConfig
+	if err := imageConfig.ApplyChanges(p.config.Changes); err != nil {
+		return nil, false, false, err
+	}
+
+	// There should be only one artifact of the Docker builder
+	source := artifact.Files()[0]
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer f.Close()
+
+	ui.Message(fmt.Sprintf("Converting %s to the OCI image layout %s", source, target))
+	err = docker.WriteOCILayout(target, f, &docker.OCIImage{
+		Architecture: p.config.Architecture,
+		OS:           p.config.OS,
+		Author:       p.config.Author,
+		Comment:      p.config.Message,
+		Config:       imageConfig,
+		RefName:      p.config.RefName,
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error writing the OCI image layout: %s", err)
+	}
+
+	return &docker.OCIArtifact{
+		BuilderIdValue: BuilderId,
+		Path:           target,
+		RefName:        p.config.RefName,
+	}, false, false, nil
+}
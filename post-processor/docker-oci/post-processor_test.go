@@ -0,0 +1,151 @@
+package dockeroci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/builder/docker"
+	"github.com/hashicorp/packer/packer"
+)
+
+func testExport(t *testing.T, dir string) *packer.MockArtifact {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	content := []byte("hello")
+	if err := tw.WriteHeader(&tar.Header{Name: "etc/motd", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tw.Write(content)
+	tw.Close()
+
+	path := filepath.Join(dir, "export.tar")
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &packer.MockArtifact{
+		BuilderIdValue: docker.BuilderId,
+		FilesValue:     []string{path},
+	}
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.RefName != "latest" || p.config.OS != "linux" {
+		t.Fatalf("bad config: %#v", p.config)
+	}
+
+	p = PostProcessor{}
+	if err := p.Configure(map[string]interface{}{"changes": []string{"RUN make"}}); err == nil {
+		t.Fatal("expected an error with an unsupported change")
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-docker-oci")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var p PostProcessor
+	err = p.Configure(map[string]interface{}{
+		"output":       filepath.Join(td, "{{.BuildName}}"),
+		"architecture": "arm64",
+		"ref_name":     "1.0",
+		"changes": []string{
+			"ENV APP_ENV=production",
+			"LABEL maintainer=ops",
+			"CMD [\"/app\"]",
+		},
+		"packer_build_name": "app",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), testExport(t, td))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keep {
+		t.Fatal("should not keep the input artifact")
+	}
+	if result.BuilderId() != BuilderId || result.Id() != "1.0" {
+		t.Fatalf("bad artifact: %#v", result)
+	}
+
+	dir := filepath.Join(td, "app")
+	var index docker.OCIIndex
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if index.Manifests[0].Platform.Architecture != "arm64" {
+		t.Fatalf("bad platform: %#v", index.Manifests[0].Platform)
+	}
+
+	var manifest docker.OCIManifest
+	data, err = ioutil.ReadFile(blobPath(dir, index.Manifests[0].Digest))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var config docker.OCIImageConfig
+	data, err = ioutil.ReadFile(blobPath(dir, manifest.Config.Digest))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := docker.ImageConfig{
+		Env:    []string{"APP_ENV=production"},
+		Cmd:    []string{"/app"},
+		Labels: map[string]string{"maintainer": "ops"},
+	}
+	if !reflect.DeepEqual(config.Config, expected) {
+		t.Fatalf("bad config: %#v", config.Config)
+	}
+
+	// The layout isn't replaced without -force
+	_, _, _, err = p.PostProcess(context.Background(), packer.TestUi(t), testExport(t, td))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an error with an existing layout, got: %v", err)
+	}
+}
+
+func TestPostProcessorPostProcess_badArtifact(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{BuilderIdValue: docker.BuilderIdImport}
+	if _, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact); err == nil {
+		t.Fatal("expected an error with an image artifact")
+	}
+}
+
+func blobPath(dir, digest string) string {
+	return filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
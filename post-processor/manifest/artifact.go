@@ -10,13 +10,20 @@ type ArtifactFile struct {
 }
 
 type Artifact struct {
-	BuildName     string            `json:"name"`
-	BuilderType   string            `json:"builder_type"`
-	BuildTime     int64             `json:"build_time"`
-	ArtifactFiles []ArtifactFile    `json:"files"`
-	ArtifactId    string            `json:"artifact_id"`
-	PackerRunUUID string            `json:"packer_run_uuid"`
-	CustomData    map[string]string `json:"custom_data"`
+	BuildName      string                 `json:"name"`
+	BuilderType    string                 `json:"builder_type"`
+	BuildTime      int64                  `json:"build_time"`
+	BuildStartTime int64                  `json:"build_start_time,omitempty"`
+	BuildDuration  int64                  `json:"build_duration,omitempty"`
+	ArtifactFiles  []ArtifactFile         `json:"files"`
+	ArtifactId     string                 `json:"artifact_id"`
+	ArtifactState  map[string]interface{} `json:"artifact_state,omitempty"`
+	PackerRunUUID  string                 `json:"packer_run_uuid"`
+	TemplateHash   string                 `json:"template_hash,omitempty"`
+	GitRevision    string                 `json:"git_revision,omitempty"`
+	Variables      map[string]string      `json:"variables,omitempty"`
+	CustomData     map[string]string      `json:"custom_data"`
+	SBOM           []string               `json:"sbom,omitempty"`
 }
 
 func (a *Artifact) BuilderId() string {
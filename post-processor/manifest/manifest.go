@@ -0,0 +1,52 @@
+package manifest
+
+import (
+	commonhelper "github.com/hashicorp/packer/helper/common"
+)
+
+type ManifestFile struct {
+	Builds      []Artifact `json:"builds"`
+	LastRunUUID string     `json:"last_run_uuid"`
+}
+
+// updateManifest reads the manifest at path, updates it and writes it back.
+// Builds running in parallel share the manifest, so it is locked for the
+// whole update.
+func updateManifest(path string, update func(*ManifestFile) error) error {
+	m := &ManifestFile{}
+	return commonhelper.UpdateJSONFile(path, m, 0664, func() error {
+		return update(m)
+	})
+}
+
+// readManifest reads a manifest, or returns an empty one if it doesn't
+// exist.
+func readManifest(path string) (*ManifestFile, error) {
+	m := &ManifestFile{}
+	if err := commonhelper.ReadJSONFile(path, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// prune removes the builds of all but the last keep runs.
+func (m *ManifestFile) prune(keep int) {
+	// The builds are appended as they finish, so the latest runs are the
+	// ones of the last builds.
+	kept := make(map[string]bool)
+	for i := len(m.Builds) - 1; i >= 0; i-- {
+		run := m.Builds[i].PackerRunUUID
+		if !kept[run] && len(kept) == keep {
+			break
+		}
+		kept[run] = true
+	}
+
+	builds := m.Builds[:0]
+	for _, b := range m.Builds {
+		if kept[b.PackerRunUUID] {
+			builds = append(builds, b)
+		}
+	}
+	m.Builds = builds
+}
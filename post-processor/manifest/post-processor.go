@@ -2,44 +2,53 @@ package manifest
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/sbom"
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/helper/config"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/template/interpolate"
 )
 
+// The state of the artifacts recorded by default. Most cloud builders
+// describe their artifacts with it.
+const metadataState = "atlas.artifact.metadata"
+
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
-	OutputPath string            `mapstructure:"output"`
-	StripPath  bool              `mapstructure:"strip_path"`
-	CustomData map[string]string `mapstructure:"custom_data"`
-	ctx        interpolate.Context
+	OutputPath    string            `mapstructure:"output"`
+	StripPath     bool              `mapstructure:"strip_path"`
+	CustomData    map[string]string `mapstructure:"custom_data"`
+	ArtifactState []string          `mapstructure:"artifact_state"`
+	KeepRuns      int               `mapstructure:"keep_runs"`
+	ctx           interpolate.Context
 }
 
 type PostProcessor struct {
 	config Config
 }
 
-type ManifestFile struct {
-	Builds      []Artifact `json:"builds"`
-	LastRunUUID string     `json:"last_run_uuid"`
-}
-
 func (p *PostProcessor) Configure(raws ...interface{}) error {
 	err := config.Decode(&p.config, &config.DecodeOpts{
 		Interpolate:        true,
 		InterpolateContext: &p.config.ctx,
 		InterpolateFilter: &interpolate.RenderFilter{
-			Exclude: []string{},
+			Exclude: []string{
+				"custom_data",
+			},
 		},
 	}, raws...)
 	if err != nil {
@@ -54,6 +63,14 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 		return fmt.Errorf("Error parsing target template: %s", err)
 	}
 
+	if p.config.ArtifactState == nil {
+		p.config.ArtifactState = []string{metadataState}
+	}
+
+	if p.config.KeepRuns < 0 {
+		return fmt.Errorf("keep_runs must be positive")
+	}
+
 	return nil
 }
 
@@ -77,10 +94,48 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source pa
 		artifact.ArtifactFiles = append(artifact.ArtifactFiles, af)
 	}
 	artifact.ArtifactId = source.Id()
-	artifact.CustomData = p.config.CustomData
+	// The custom data may use outputs captured by the provisioners, which
+	// weren't known when the post-processor was configured.
+	if len(p.config.CustomData) > 0 {
+		artifact.CustomData = make(map[string]string, len(p.config.CustomData))
+		for k, v := range p.config.CustomData {
+			if artifact.CustomData[k], err = interpolate.Render(v, &p.config.ctx); err != nil {
+				return source, true, true, fmt.Errorf("Error processing custom_data %s: %s", k, err)
+			}
+		}
+	}
+	// Reference the software bills of materials written by the sbom
+	// post-processor, if any.
+	outputs, err := commonhelper.RetrieveBuildOutputs(p.config.PackerBuildName)
+	if err != nil {
+		return source, true, true, fmt.Errorf("Error reading the build outputs: %s", err)
+	}
+	if files := outputs[sbom.FilesOutput]; files != "" {
+		for _, name := range strings.Split(files, ",") {
+			if p.config.StripPath {
+				name = filepath.Base(name)
+			}
+			artifact.SBOM = append(artifact.SBOM, name)
+		}
+	}
+	artifact.ArtifactState = p.artifactState(source)
 	artifact.BuilderType = p.config.PackerBuilderType
 	artifact.BuildName = p.config.PackerBuildName
 	artifact.BuildTime = time.Now().Unix()
+	start, err := commonhelper.RetrieveBuildStart(p.config.PackerBuildName)
+	if err != nil {
+		log.Printf("Error reading the start of the build: %s", err)
+	} else if !start.IsZero() {
+		artifact.BuildStartTime = start.Unix()
+		artifact.BuildDuration = artifact.BuildTime - artifact.BuildStartTime
+	}
+	if path := p.config.ctx.TemplatePath; path != "" {
+		if artifact.TemplateHash, err = templateHash(path); err != nil {
+			log.Printf("Error hashing the template: %s", err)
+		}
+	}
+	artifact.GitRevision = gitRevision(p.config.ctx.TemplatePath)
+	artifact.Variables = p.variables()
 	// Since each post-processor runs in a different process we need a way to
 	// coordinate between various post-processors in a single packer run. We do
 	// this by setting a UUID per run and tracking this in the manifest file.
@@ -90,54 +145,119 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source pa
 	// the file before we proceed.
 	artifact.PackerRunUUID = os.Getenv("PACKER_RUN_UUID")
 
-	// Create a lock file with exclusive access. If this fails we will retry
-	// after a delay.
-	lockFilename := p.config.OutputPath + ".lock"
-	for i := 0; i < 3; i++ {
-		// The file should not be locked for very long so we'll keep this short.
-		time.Sleep((time.Duration(i) * 200 * time.Millisecond))
-		_, err = os.OpenFile(lockFilename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
-		if err == nil {
-			break
+	err = updateManifest(p.config.OutputPath, func(manifestFile *ManifestFile) error {
+		// If -force is set and we are not on same run, truncate the file.
+		// Otherwise we will continue to add new builds to the existing
+		// manifest file.
+		if p.config.PackerForce && artifact.PackerRunUUID != manifestFile.LastRunUUID {
+			*manifestFile = ManifestFile{}
 		}
-		log.Printf("Error locking manifest file for reading and writing. Will sleep and retry. %s", err)
-	}
-	defer os.Remove(lockFilename)
 
-	// Read the current manifest file from disk
-	contents := []byte{}
-	if contents, err = ioutil.ReadFile(p.config.OutputPath); err != nil && !os.IsNotExist(err) {
-		return source, true, true, fmt.Errorf("Unable to open %s for reading: %s", p.config.OutputPath, err)
+		// Add the current artifact to the manifest file
+		manifestFile.Builds = append(manifestFile.Builds, *artifact)
+		manifestFile.LastRunUUID = artifact.PackerRunUUID
+
+		if p.config.KeepRuns > 0 {
+			manifestFile.prune(p.config.KeepRuns)
+		}
+		return nil
+	})
+	if err != nil {
+		return source, true, true, fmt.Errorf("Unable to update %s: %s", p.config.OutputPath, err)
 	}
 
-	// Parse the manifest file JSON, if we have one
-	manifestFile := &ManifestFile{}
-	if len(contents) > 0 {
-		if err = json.Unmarshal(contents, manifestFile); err != nil {
-			return source, true, true, fmt.Errorf("Unable to parse content from %s: %s", p.config.OutputPath, err)
+	// The manifest should never delete the artifacts it is set to record, so it
+	// forcibly sets "keep" to true.
+	return source, true, true, nil
+}
+
+// artifactState returns the state of the artifact to record. The names
+// without state are skipped.
+func (p *PostProcessor) artifactState(source packer.Artifact) map[string]interface{} {
+	var state map[string]interface{}
+	for _, name := range p.config.ArtifactState {
+		value := jsonValue(source.State(name))
+		if value == nil {
+			continue
+		}
+		if _, err := json.Marshal(value); err != nil {
+			log.Printf("Skipping the %s state of the artifact: %s", name, err)
+			continue
 		}
+		if state == nil {
+			state = make(map[string]interface{})
+		}
+		state[name] = value
 	}
+	return state
+}
 
-	// If -force is set and we are not on same run, truncate the file. Otherwise
-	// we will continue to add new builds to the existing manifest file.
-	if p.config.PackerForce && os.Getenv("PACKER_RUN_UUID") != manifestFile.LastRunUUID {
-		manifestFile = &ManifestFile{}
+// variables returns the user variables, except the sensitive ones.
+func (p *PostProcessor) variables() map[string]string {
+	sensitive := make(map[string]bool)
+	for _, name := range p.config.PackerSensitiveVars {
+		sensitive[name] = true
 	}
 
-	// Add the current artifact to the manifest file
-	manifestFile.Builds = append(manifestFile.Builds, *artifact)
-	manifestFile.LastRunUUID = os.Getenv("PACKER_RUN_UUID")
+	var vars map[string]string
+	for k, v := range p.config.PackerUserVars {
+		if sensitive[k] {
+			continue
+		}
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[k] = v
+	}
+	return vars
+}
 
-	// Write JSON to disk
-	if out, err := json.MarshalIndent(manifestFile, "", "  "); err == nil {
-		if err = ioutil.WriteFile(p.config.OutputPath, out, 0664); err != nil {
-			return source, true, true, fmt.Errorf("Unable to write %s: %s", p.config.OutputPath, err)
+// jsonValue converts the maps decoded from the RPC connection with the
+// plugins, whose keys are interfaces, to maps that can be marshalled.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
 		}
-	} else {
-		return source, true, true, fmt.Errorf("Unable to marshal JSON %s", err)
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = jsonValue(e)
+		}
+		return s
 	}
+	return v
+}
 
-	// The manifest should never delete the artifacts it is set to record, so it
-	// forcibly sets "keep" to true.
-	return source, true, true, nil
+// templateHash returns the SHA256 checksum of the template.
+func templateHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gitRevision returns the commit checked out in the git repository holding
+// the template, if any.
+func gitRevision(templatePath string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	if templatePath != "" {
+		cmd.Dir = filepath.Dir(templatePath)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		log.Printf("Not recording the git revision: %s", err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
 }
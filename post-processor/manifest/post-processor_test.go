@@ -0,0 +1,268 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig(output string) map[string]interface{} {
+	return map[string]interface{}{
+		"output":              output,
+		"packer_build_name":   "vbox",
+		"packer_builder_type": "virtualbox-iso",
+	}
+}
+
+func testPP(t *testing.T, raws ...interface{}) *PostProcessor {
+	var p PostProcessor
+	if err := p.Configure(raws...); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &p
+}
+
+func testManifest(t *testing.T, path string) *ManifestFile {
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return m
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	p := testPP(t, map[string]interface{}{})
+	if p.config.OutputPath != "packer-manifest.json" {
+		t.Fatalf("bad output: %s", p.config.OutputPath)
+	}
+	if !reflect.DeepEqual(p.config.ArtifactState, []string{metadataState}) {
+		t.Fatalf("bad artifact state: %#v", p.config.ArtifactState)
+	}
+
+	var bad PostProcessor
+	if err := bad.Configure(map[string]interface{}{"keep_runs": -1}); err == nil {
+		t.Fatal("should error with a negative keep_runs")
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-manifest")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	template := filepath.Join(td, "template.json")
+	if err := ioutil.WriteFile(template, []byte("{}"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	os.Setenv("PACKER_RUN_UUID", "test-manifest")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	start := time.Now().Add(-time.Minute)
+	if err := commonhelper.SetBuildStart("vbox", start); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer commonhelper.RemoveBuildStart("vbox")
+
+	output := filepath.Join(td, "manifest.json")
+	raw := testConfig(output)
+	raw["artifact_state"] = []string{"metadata", "missing"}
+	raw["packer_template_path"] = template
+	raw["packer_user_variables"] = map[string]string{"version": "1.0", "password": "secret"}
+	raw["packer_sensitive_variables"] = []string{"password"}
+	p := testPP(t, raw)
+
+	artifact := &packer.MockArtifact{
+		FilesValue: []string{template},
+		StateValues: map[string]interface{}{
+			"metadata": map[interface{}]interface{}{"region": "us-east-1"},
+		},
+	}
+	_, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep {
+		t.Fatal("should keep the artifact")
+	}
+
+	m := testManifest(t, output)
+	if len(m.Builds) != 1 || m.LastRunUUID != "test-manifest" {
+		t.Fatalf("bad manifest: %#v", m)
+	}
+	b := m.Builds[0]
+	if b.BuildName != "vbox" || b.BuilderType != "virtualbox-iso" || b.PackerRunUUID != "test-manifest" {
+		t.Fatalf("bad build: %#v", b)
+	}
+	if b.BuildStartTime != start.Unix() || b.BuildDuration < 60 {
+		t.Fatalf("bad timing: %d %d", b.BuildStartTime, b.BuildDuration)
+	}
+	// The SHA256 checksum of "{}"
+	if b.TemplateHash != "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Fatalf("bad template hash: %s", b.TemplateHash)
+	}
+	if !reflect.DeepEqual(b.Variables, map[string]string{"version": "1.0"}) {
+		t.Fatalf("the sensitive variables should not be recorded: %#v", b.Variables)
+	}
+	expected := map[string]interface{}{
+		"metadata": map[string]interface{}{"region": "us-east-1"},
+	}
+	if !reflect.DeepEqual(b.ArtifactState, expected) {
+		t.Fatalf("bad artifact state: %#v", b.ArtifactState)
+	}
+	if len(b.ArtifactFiles) != 1 || b.ArtifactFiles[0].Size != 2 {
+		t.Fatalf("bad files: %#v", b.ArtifactFiles)
+	}
+
+	// The temporary files are renamed
+	files, err := filepath.Glob(filepath.Join(td, ".manifest.json*"))
+	if err != nil || len(files) > 0 {
+		t.Fatalf("leftover temporary files: %v %v", files, err)
+	}
+}
+
+func TestPostProcessorPostProcess_parallel(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-manifest")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	os.Setenv("PACKER_RUN_UUID", "test-manifest-parallel")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+
+	output := filepath.Join(td, "manifest.json")
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		raw := testConfig(output)
+		raw["packer_build_name"] = fmt.Sprintf("build-%d", i)
+		p := testPP(t, raw)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), &packer.MockArtifact{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if m := testManifest(t, output); len(m.Builds) != 10 {
+		t.Fatalf("builds were lost: %d", len(m.Builds))
+	}
+}
+
+func TestPostProcessorPostProcess_runs(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-manifest")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	defer os.Unsetenv("PACKER_RUN_UUID")
+
+	output := filepath.Join(td, "manifest.json")
+	run := func(uuid string, raw map[string]interface{}) {
+		os.Setenv("PACKER_RUN_UUID", uuid)
+		p := testPP(t, raw)
+		_, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), &packer.MockArtifact{})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	runs := func() []string {
+		var uuids []string
+		for _, b := range testManifest(t, output).Builds {
+			uuids = append(uuids, b.PackerRunUUID)
+		}
+		return uuids
+	}
+
+	run("1", testConfig(output))
+	run("1", testConfig(output))
+	run("2", testConfig(output))
+	run("3", testConfig(output))
+	if uuids := strings.Join(runs(), ","); uuids != "1,1,2,3" {
+		t.Fatalf("bad runs: %s", uuids)
+	}
+
+	// Only the builds of the last runs are kept
+	raw := testConfig(output)
+	raw["keep_runs"] = 2
+	run("4", raw)
+	if uuids := strings.Join(runs(), ","); uuids != "3,4" {
+		t.Fatalf("bad runs: %s", uuids)
+	}
+	run("4", raw)
+	if uuids := strings.Join(runs(), ","); uuids != "3,4,4" {
+		t.Fatalf("bad runs: %s", uuids)
+	}
+
+	// -force truncates the manifest on a new run
+	raw = testConfig(output)
+	raw["packer_force"] = true
+	run("5", raw)
+	run("5", raw)
+	if uuids := strings.Join(runs(), ","); uuids != "5,5" {
+		t.Fatalf("bad runs: %s", uuids)
+	}
+}
+
+func TestPostProcessorPostProcess_customDataOutputs(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-manifest")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	os.Setenv("PACKER_RUN_UUID", "test-manifest-outputs")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("vbox")
+
+	output := filepath.Join(td, "manifest.json")
+	raw := testConfig(output)
+	raw["custom_data"] = map[string]string{"kernel": `{{ output "kernel" }}`}
+	p := testPP(t, raw)
+
+	// The outputs are captured by the provisioners, after the
+	// post-processor was configured.
+	if err := commonhelper.SetBuildOutputs("vbox", map[string]string{"kernel": "4.15"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	m := testManifest(t, output)
+	if m.Builds[0].CustomData["kernel"] != "4.15" {
+		t.Fatalf("bad custom data: %#v", m.Builds[0].CustomData)
+	}
+
+	// Other fields are rendered before the build starts
+	raw = testConfig(`{{ output "missing" }}.json`)
+	var bad PostProcessor
+	if err := bad.Configure(raw); err == nil {
+		t.Fatal("should error on an output in another field")
+	}
+}
@@ -0,0 +1,45 @@
+package ovf
+
+import (
+	"fmt"
+	"os"
+)
+
+const BuilderId = "packer.post-processor.ovf"
+
+// Artifact is an OVA package, or an OVF descriptor along with its manifest
+// and disks.
+type Artifact struct {
+	files []string
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (*Artifact) Id() string {
+	return ""
+}
+
+func (a *Artifact) Files() []string {
+	filesCopy := make([]string, len(a.files))
+	copy(filesCopy, a.files)
+	return filesCopy
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("OVF package in: %s", a.files[0])
+}
+
+func (*Artifact) State(name string) interface{} {
+	return nil
+}
+
+func (a *Artifact) Destroy() error {
+	for _, path := range a.files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
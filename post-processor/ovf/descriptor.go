@@ -0,0 +1,148 @@
+package ovf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"text/template"
+)
+
+// descriptorData is the data of the OVF descriptor template.
+type descriptorData struct {
+	Name              string
+	OSID              int
+	OSType            string
+	VirtualSystemType string
+	CPUs              int
+	Memory            int
+	Firmware          string
+	Controller        controller
+	Disks             []descriptorDisk
+	Network           string
+	NICType           string
+}
+
+// descriptorDisk is a disk of the package.
+type descriptorDisk struct {
+	Href     string
+	Size     int64
+	Capacity int64
+	Format   string
+}
+
+// controller is the RASD description of a disk controller.
+type controller struct {
+	ResourceType    int
+	ResourceSubType string
+	Name            string
+}
+
+var controllers = map[string]controller{
+	"scsi": {ResourceType: 6, ResourceSubType: "lsilogic", Name: "SCSI Controller"},
+	"sata": {ResourceType: 20, ResourceSubType: "AHCI", Name: "SATA Controller"},
+	"ide":  {ResourceType: 5, ResourceSubType: "PIIX4", Name: "IDE Controller"},
+}
+
+// descriptorTemplate is an OVF 1.0 descriptor. The instance IDs of the
+// hardware items are 1 for the CPUs, 2 for the memory and 3 for the disk
+// controller, followed by the disks and the NIC.
+var descriptorTemplate = template.Must(template.New("ovf").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+	"add": func(a, b int) int { return a + b },
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+{{- range $i, $d := .Disks}}
+    <File ovf:href="{{xml $d.Href}}" ovf:id="file{{add $i 1}}" ovf:size="{{$d.Size}}"/>
+{{- end}}
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+{{- range $i, $d := .Disks}}
+    <Disk ovf:capacity="{{$d.Capacity}}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk{{add $i 1}}" ovf:fileRef="file{{add $i 1}}" ovf:format="{{$d.Format}}"/>
+{{- end}}
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="{{xml .Network}}">
+      <Description>The {{xml .Network}} network</Description>
+    </Network>
+  </NetworkSection>
+  <VirtualSystem ovf:id="{{xml .Name}}">
+    <Info>A virtual machine</Info>
+    <Name>{{xml .Name}}</Name>
+    <OperatingSystemSection ovf:id="{{.OSID}}"{{if .OSType}} vmw:osType="{{xml .OSType}}"{{end}}>
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{xml .Name}}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>{{xml .VirtualSystemType}}</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>{{.CPUs}} virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.CPUs}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>{{.Memory}}MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.Memory}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>{{.Controller.Name}}</rasd:Description>
+        <rasd:ElementName>{{.Controller.Name}} 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>{{.Controller.ResourceSubType}}</rasd:ResourceSubType>
+        <rasd:ResourceType>{{.Controller.ResourceType}}</rasd:ResourceType>
+      </Item>
+{{- $controller := 3}}
+{{- range $i, $d := .Disks}}
+      <Item>
+        <rasd:AddressOnParent>{{$i}}</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk {{add $i 1}}</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk{{add $i 1}}</rasd:HostResource>
+        <rasd:InstanceID>{{add $controller (add $i 1)}}</rasd:InstanceID>
+        <rasd:Parent>{{$controller}}</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+{{- end}}
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>{{xml .Network}}</rasd:Connection>
+        <rasd:Description>{{xml .NICType}} ethernet adapter on "{{xml .Network}}"</rasd:Description>
+        <rasd:ElementName>Network Adapter 1</rasd:ElementName>
+        <rasd:InstanceID>{{add $controller (add (len .Disks) 1)}}</rasd:InstanceID>
+        <rasd:ResourceSubType>{{xml .NICType}}</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+{{- if .Firmware}}
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="{{xml .Firmware}}"/>
+{{- end}}
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`))
+
+// descriptor renders the OVF descriptor.
+func descriptor(data *descriptorData) ([]byte, error) {
+	var b bytes.Buffer
+	if err := descriptorTemplate.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
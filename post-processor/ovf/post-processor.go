@@ -0,0 +1,400 @@
+package ovf
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// ustarMaxSize is the size of the largest file a ustar header can describe.
+const ustarMaxSize = 1<<33 - 1
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The path of the package: an OVA file, or an OVF descriptor written
+	// along with its manifest and disks.
+	OutputPath string `mapstructure:"output"`
+
+	// The name of the virtual machine. Defaults to the name of the build.
+	VMName string `mapstructure:"vm_name"`
+
+	// The hardware of the virtual machine.
+	CPUs           int    `mapstructure:"cpus"`
+	Memory         int    `mapstructure:"memory"`
+	DiskController string `mapstructure:"disk_controller"`
+	Network        string `mapstructure:"network"`
+	NICType        string `mapstructure:"nic_type"`
+	Firmware       string `mapstructure:"firmware"`
+
+	// The guest OS, as a CIM operating system ID and a VMware guest ID.
+	OSID   int    `mapstructure:"os_id"`
+	OSType string `mapstructure:"os_type"`
+
+	// The virtual hardware family, such as vmx-10.
+	VirtualSystemType string `mapstructure:"virtual_system_type"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+type outputPathTemplate struct {
+	BuildName   string
+	BuilderType string
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"output"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	if p.config.OutputPath == "" {
+		p.config.OutputPath = "packer_{{.BuildName}}_{{.BuilderType}}.ova"
+	}
+	if err = interpolate.Validate(p.config.OutputPath, &p.config.ctx); err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing target template: %s", err))
+	}
+	switch strings.ToLower(filepath.Ext(p.config.OutputPath)) {
+	case ".ova", ".ovf":
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("output must end with .ova or .ovf"))
+	}
+
+	if p.config.VMName == "" {
+		p.config.VMName = p.config.PackerBuildName
+	}
+	if p.config.VMName == "" {
+		p.config.VMName = "packer"
+	}
+
+	if p.config.CPUs == 0 {
+		p.config.CPUs = 1
+	}
+	if p.config.Memory == 0 {
+		p.config.Memory = 1024
+	}
+	if p.config.CPUs < 0 || p.config.Memory < 0 {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("cpus and memory must be positive"))
+	}
+
+	if p.config.DiskController == "" {
+		p.config.DiskController = "scsi"
+	}
+	p.config.DiskController = strings.ToLower(p.config.DiskController)
+	if _, ok := controllers[p.config.DiskController]; !ok {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Unsupported disk_controller: %s", p.config.DiskController))
+	}
+
+	if p.config.Network == "" {
+		p.config.Network = "VM Network"
+	}
+	if p.config.NICType == "" {
+		p.config.NICType = "E1000"
+	}
+
+	switch p.config.Firmware {
+	case "", "bios", "efi":
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("firmware must be bios or efi"))
+	}
+
+	if p.config.OSID == 0 {
+		// Other Linux 64-Bit
+		p.config.OSID = 101
+		if p.config.OSType == "" {
+			p.config.OSType = "otherLinux64Guest"
+		}
+	}
+
+	if p.config.VirtualSystemType == "" {
+		p.config.VirtualSystemType = "vmx-10"
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// packageFile is a file of the package.
+type packageFile struct {
+	// The name of the file in the package, and its path on disk.
+	name string
+	path string
+	size int64
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	p.config.ctx.Data = &outputPathTemplate{
+		BuildName:   p.config.PackerBuildName,
+		BuilderType: p.config.PackerBuilderType,
+	}
+	target, err := interpolate.Render(p.config.OutputPath, &p.config.ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error interpolating output value: %s", err)
+	}
+
+	data := &descriptorData{
+		Name:              p.config.VMName,
+		OSID:              p.config.OSID,
+		OSType:            p.config.OSType,
+		VirtualSystemType: p.config.VirtualSystemType,
+		CPUs:              p.config.CPUs,
+		Memory:            p.config.Memory,
+		Controller:        controllers[p.config.DiskController],
+		Network:           p.config.Network,
+		NICType:           p.config.NICType,
+	}
+	if p.config.Firmware == "efi" {
+		data.Firmware = "efi"
+	}
+
+	var disks []packageFile
+	for _, path := range artifact.Files() {
+		if strings.ToLower(filepath.Ext(path)) != ".vmdk" {
+			continue
+		}
+		info, err := readVMDK(path)
+		if err != nil {
+			return nil, false, false, fmt.Errorf(
+				"%s; convert the disks to streamOptimized VMDK disks first, with the disk-convert post-processor", err)
+		}
+		if !info.StreamOptimized {
+			ui.Message(fmt.Sprintf(
+				"Warning: %s is not a streamOptimized VMDK disk, which vSphere requires", path))
+		}
+
+		name := fmt.Sprintf("%s-disk%d.vmdk", p.config.VMName, len(disks)+1)
+		disks = append(disks, packageFile{name: name, path: path, size: info.Size})
+		data.Disks = append(data.Disks, descriptorDisk{
+			Href:     name,
+			Size:     info.Size,
+			Capacity: info.Capacity,
+			Format:   info.Format(),
+		})
+	}
+	if len(disks) == 0 {
+		return nil, false, false, fmt.Errorf(
+			"No VMDK disk found in the artifact; convert the disks with the disk-convert post-processor first")
+	}
+	if p.config.DiskController == "ide" && len(disks) > 2 {
+		return nil, false, false, fmt.Errorf("An IDE controller only holds 2 disks, found %d", len(disks))
+	}
+
+	desc, err := descriptor(data)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error creating the OVF descriptor: %s", err)
+	}
+
+	// The manifest lists the digests of the descriptor and of the disks.
+	base := strings.TrimSuffix(filepath.Base(target), filepath.Ext(target))
+	descName := base + ".ovf"
+	manifestName := base + ".mf"
+	sum := sha256.Sum256(desc)
+	manifest := fmt.Sprintf("SHA256(%s)= %s\n", descName, hex.EncodeToString(sum[:]))
+	for _, disk := range disks {
+		ui.Message(fmt.Sprintf("Computing the digest of %s", disk.path))
+		digest, err := fileDigest(disk.path)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Error reading %s: %s", disk.path, err)
+		}
+		manifest += fmt.Sprintf("SHA256(%s)= %s\n", disk.name, digest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, false, false, fmt.Errorf("Unable to create dir for %s: %s", target, err)
+	}
+
+	var newArtifact *Artifact
+	var shared bool
+	if strings.ToLower(filepath.Ext(target)) == ".ova" {
+		ui.Say(fmt.Sprintf("Writing OVA package %s", target))
+		err = writeOVA(target, desc, descName, []byte(manifest), manifestName, disks)
+		newArtifact = &Artifact{files: []string{target}}
+	} else {
+		ui.Say(fmt.Sprintf("Writing OVF package %s", target))
+		newArtifact, shared, err = writeOVF(target, desc, []byte(manifest), manifestName, disks)
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	// Destroying the input artifact would remove the disks the package
+	// shares with it.
+	return newArtifact, shared, shared, nil
+}
+
+// writeOVA writes the package as a tar archive: the descriptor first, then
+// the manifest and the disks, as the OVF specification requires.
+func writeOVA(target string, desc []byte, descName string, manifest []byte, manifestName string, disks []packageFile) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("Unable to create %s: %s", target, err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	writeBytes := func(name string, data []byte) error {
+		if err := tw.WriteHeader(tarHeader(name, int64(len(data)))); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeBytes(descName, desc); err != nil {
+		return fmt.Errorf("Error writing %s: %s", target, err)
+	}
+	if err := writeBytes(manifestName, manifest); err != nil {
+		return fmt.Errorf("Error writing %s: %s", target, err)
+	}
+	for _, disk := range disks {
+		if err := tw.WriteHeader(tarHeader(disk.name, disk.size)); err != nil {
+			return fmt.Errorf("Error writing %s: %s", target, err)
+		}
+		src, err := os.Open(disk.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("Error adding %s to %s: %s", disk.path, target, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("Error writing %s: %s", target, err)
+	}
+	return f.Close()
+}
+
+func tarHeader(name string, size int64) *tar.Header {
+	h := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatUSTAR,
+	}
+	// Disks larger than 8GB don't fit in a ustar header.
+	if size > ustarMaxSize {
+		h.Format = tar.FormatPAX
+	}
+	return h
+}
+
+// writeOVF writes the descriptor and the manifest next to the disks. It
+// tells whether some disks already were where the descriptor expects them,
+// in which case they are shared with the input artifact.
+func writeOVF(target string, desc []byte, manifest []byte, manifestName string, disks []packageFile) (*Artifact, bool, error) {
+	dir := filepath.Dir(target)
+	artifact := &Artifact{}
+
+	write := func(path string, data []byte) error {
+		artifact.files = append(artifact.files, path)
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	if err := write(target, desc); err != nil {
+		artifact.Destroy()
+		return nil, false, fmt.Errorf("Error writing %s: %s", target, err)
+	}
+	if err := write(filepath.Join(dir, manifestName), manifest); err != nil {
+		artifact.Destroy()
+		return nil, false, fmt.Errorf("Error writing the manifest: %s", err)
+	}
+
+	var shared []string
+	for _, disk := range disks {
+		path := filepath.Join(dir, disk.name)
+		if sameFile(disk.path, path) {
+			// The disk is already where the descriptor expects it, and
+			// belongs to the input artifact as well.
+			shared = append(shared, path)
+			continue
+		}
+		artifact.files = append(artifact.files, path)
+		if err := copyFile(disk.path, path); err != nil {
+			artifact.Destroy()
+			return nil, false, fmt.Errorf("Error copying %s: %s", disk.path, err)
+		}
+	}
+	// The shared disks are only listed once nothing can fail, so that a
+	// failure doesn't remove them.
+	artifact.files = append(artifact.files, shared...)
+	return artifact, len(shared) > 0, nil
+}
+
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
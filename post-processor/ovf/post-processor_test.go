@@ -0,0 +1,353 @@
+package ovf
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+// testVMDK writes a file starting with a sparse VMDK header.
+func testVMDK(t *testing.T, path string, flags uint32, sectors uint64) {
+	var b bytes.Buffer
+	h := vmdkHeader{Magic: vmdkMagic, Version: 3, Flags: flags, Capacity: sectors}
+	if err := binary.Write(&b, binary.LittleEndian, h); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	b.Write(make([]byte, 512-b.Len()))
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func testConfig(output string) map[string]interface{} {
+	return map[string]interface{}{
+		"output":              output,
+		"vm_name":             "test",
+		"cpus":                2,
+		"memory":              2048,
+		"packer_build_name":   "build",
+		"packer_builder_type": "qemu",
+	}
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.CPUs != 1 || p.config.Memory != 1024 {
+		t.Fatalf("bad hardware: %d CPUs, %dMB", p.config.CPUs, p.config.Memory)
+	}
+	if p.config.DiskController != "scsi" || p.config.OSID != 101 {
+		t.Fatalf("bad config: %#v", p.config)
+	}
+
+	bad := []map[string]interface{}{
+		{"output": "image.tar"},
+		{"disk_controller": "nvme"},
+		{"firmware": "uefi"},
+		{"memory": -1},
+	}
+	for _, raw := range bad {
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Fatalf("expected an error with %v", raw)
+		}
+	}
+}
+
+func TestReadVMDK(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "disk.vmdk")
+	testVMDK(t, path, vmdkFlagCompressed|vmdkFlagMarkers|1, 2048)
+	info, err := readVMDK(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.Capacity != 1024*1024 || info.Size != 512 || !info.StreamOptimized {
+		t.Fatalf("bad: %#v", info)
+	}
+	if info.Format() != formatStreamOptimized {
+		t.Fatalf("bad format: %s", info.Format())
+	}
+
+	testVMDK(t, path, 1, 2048)
+	info, err = readVMDK(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.StreamOptimized || info.Format() != formatSparse {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	descriptor := "# Disk DescriptorFile\nversion=1\n"
+	if err := ioutil.WriteFile(path, []byte(descriptor), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := readVMDK(path); err == nil {
+		t.Fatal("expected an error with a text descriptor")
+	}
+}
+
+func TestDescriptor(t *testing.T) {
+	data := &descriptorData{
+		Name:              "web & db",
+		OSID:              101,
+		OSType:            "otherLinux64Guest",
+		VirtualSystemType: "vmx-10",
+		CPUs:              2,
+		Memory:            2048,
+		Firmware:          "efi",
+		Controller:        controllers["sata"],
+		Disks: []descriptorDisk{
+			{Href: "a-disk1.vmdk", Size: 512, Capacity: 1024, Format: formatStreamOptimized},
+			{Href: "a-disk2.vmdk", Size: 512, Capacity: 2048, Format: formatStreamOptimized},
+		},
+		Network: "VM Network",
+		NICType: "VMXNET3",
+	}
+	out, err := descriptor(data)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var envelope struct {
+		Files []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"References>File"`
+		Disks []struct {
+			Capacity int64 `xml:"capacity,attr"`
+		} `xml:"DiskSection>Disk"`
+		Name  string `xml:"VirtualSystem>Name"`
+		Items []struct {
+			InstanceID      int    `xml:"InstanceID"`
+			ResourceType    int    `xml:"ResourceType"`
+			ResourceSubType string `xml:"ResourceSubType"`
+			Parent          int    `xml:"Parent"`
+			VirtualQuantity int    `xml:"VirtualQuantity"`
+		} `xml:"VirtualSystem>VirtualHardwareSection>Item"`
+	}
+	if err := xml.Unmarshal(out, &envelope); err != nil {
+		t.Fatalf("invalid descriptor: %s\n%s", err, out)
+	}
+
+	if envelope.Name != data.Name {
+		t.Fatalf("bad name: %q", envelope.Name)
+	}
+	if len(envelope.Files) != 2 || envelope.Files[1].Href != "a-disk2.vmdk" {
+		t.Fatalf("bad references: %#v", envelope.Files)
+	}
+	if len(envelope.Disks) != 2 || envelope.Disks[1].Capacity != 2048 {
+		t.Fatalf("bad disks: %#v", envelope.Disks)
+	}
+
+	// CPUs, memory, controller, 2 disks and the NIC
+	if len(envelope.Items) != 6 {
+		t.Fatalf("bad items: %#v", envelope.Items)
+	}
+	for i, item := range envelope.Items {
+		if item.InstanceID != i+1 {
+			t.Fatalf("bad instance ID of item %d: %d", i, item.InstanceID)
+		}
+	}
+	if envelope.Items[0].VirtualQuantity != 2 || envelope.Items[1].VirtualQuantity != 2048 {
+		t.Fatalf("bad hardware: %#v", envelope.Items[:2])
+	}
+	if envelope.Items[2].ResourceType != 20 {
+		t.Fatalf("bad controller: %#v", envelope.Items[2])
+	}
+	if envelope.Items[4].ResourceType != 17 || envelope.Items[4].Parent != 3 {
+		t.Fatalf("bad disk: %#v", envelope.Items[4])
+	}
+	if envelope.Items[5].ResourceSubType != "VMXNET3" {
+		t.Fatalf("bad NIC: %#v", envelope.Items[5])
+	}
+	if !bytes.Contains(out, []byte(`vmw:value="efi"`)) {
+		t.Fatal("missing the firmware")
+	}
+}
+
+func TestPostProcessorPostProcess_OVA(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	disk := filepath.Join(td, "disk.vmdk")
+	testVMDK(t, disk, vmdkFlagCompressed|vmdkFlagMarkers, 2048)
+	other := filepath.Join(td, "disk.qcow2")
+	if err := ioutil.WriteFile(other, []byte("qcow2"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var p PostProcessor
+	if err := p.Configure(testConfig(filepath.Join(td, "{{.BuildName}}.ova"))); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{FilesValue: []string{other, disk}}
+	result, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keep {
+		t.Fatal("should not keep the input artifact")
+	}
+	target := filepath.Join(td, "build.ova")
+	if files := result.Files(); len(files) != 1 || files[0] != target {
+		t.Fatalf("bad files: %v", files)
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	var names []string
+	contents := map[string][]byte{}
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		names = append(names, h.Name)
+		contents[h.Name] = b
+	}
+
+	expected := []string{"build.ovf", "build.mf", "test-disk1.vmdk"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("bad entries: %v", names)
+	}
+
+	var manifest string
+	for _, name := range []string{"build.ovf", "test-disk1.vmdk"} {
+		sum := sha256.Sum256(contents[name])
+		manifest += fmt.Sprintf("SHA256(%s)= %s\n", name, hex.EncodeToString(sum[:]))
+	}
+	if string(contents["build.mf"]) != manifest {
+		t.Fatalf("bad manifest:\n%s\nexpected:\n%s", contents["build.mf"], manifest)
+	}
+}
+
+func TestPostProcessorPostProcess_OVF(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	disk := filepath.Join(td, "disk.vmdk")
+	testVMDK(t, disk, 0, 2048)
+
+	var p PostProcessor
+	out := filepath.Join(td, "out", "vm.ovf")
+	if err := p.Configure(testConfig(out)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{FilesValue: []string{disk}}
+	result, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		out,
+		filepath.Join(td, "out", "vm.mf"),
+		filepath.Join(td, "out", "test-disk1.vmdk"),
+	}
+	if strings.Join(result.Files(), ",") != strings.Join(expected, ",") {
+		t.Fatalf("bad files: %v", result.Files())
+	}
+	for _, path := range expected {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if err := result.Destroy(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatal("the descriptor should be removed")
+	}
+}
+
+func TestPostProcessorPostProcess_OVFSharedDisk(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// The disk already has the name the descriptor gives it
+	disk := filepath.Join(td, "test-disk1.vmdk")
+	testVMDK(t, disk, 0, 2048)
+
+	var p PostProcessor
+	out := filepath.Join(td, "vm.ovf")
+	if err := p.Configure(testConfig(out)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{FilesValue: []string{disk}}
+	result, keep, forceOverride, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep || !forceOverride {
+		t.Fatal("should keep the input artifact, which shares the disk")
+	}
+
+	expected := []string{out, filepath.Join(td, "vm.mf"), disk}
+	if strings.Join(result.Files(), ",") != strings.Join(expected, ",") {
+		t.Fatalf("bad files: %v", result.Files())
+	}
+}
+
+func TestPostProcessorPostProcess_noVMDK(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var p PostProcessor
+	if err := p.Configure(testConfig(filepath.Join(td, "vm.ova"))); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{FilesValue: []string{filepath.Join(td, "disk.qcow2")}}
+	_, _, _, err = p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err == nil || !strings.Contains(err.Error(), "disk-convert") {
+		t.Fatalf("expected an error suggesting disk-convert, got: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package ovf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// vmdkMagic starts the header of sparse VMDK extents: "KDMV".
+	vmdkMagic = 0x564d444b
+
+	vmdkSectorSize = 512
+
+	// The flags of streamOptimized extents: compressed grains, and markers.
+	vmdkFlagCompressed = 1 << 16
+	vmdkFlagMarkers    = 1 << 17
+)
+
+// The OVF formats of VMDK disks.
+const (
+	formatStreamOptimized = "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"
+	formatSparse          = "http://www.vmware.com/interfaces/specifications/vmdk.html#sparse"
+)
+
+// vmdkHeader is the start of the header of a sparse VMDK extent.
+type vmdkHeader struct {
+	Magic    uint32
+	Version  uint32
+	Flags    uint32
+	Capacity uint64
+}
+
+// vmdkInfo describes a VMDK disk.
+type vmdkInfo struct {
+	// Capacity is the virtual size of the disk, in bytes.
+	Capacity int64
+
+	// Size is the size of the file.
+	Size int64
+
+	StreamOptimized bool
+}
+
+// Format returns the OVF format of the disk.
+func (i *vmdkInfo) Format() string {
+	if i.StreamOptimized {
+		return formatStreamOptimized
+	}
+	return formatSparse
+}
+
+// readVMDK reads the header of a monolithic sparse VMDK disk. Disks made of
+// a text descriptor and separate extents aren't supported.
+func readVMDK(path string) (*vmdkInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var h vmdkHeader
+	if err := binary.Read(f, binary.LittleEndian, &h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%s is not a sparse VMDK disk", path)
+		}
+		return nil, err
+	}
+	if h.Magic != vmdkMagic {
+		return nil, fmt.Errorf("%s is not a sparse VMDK disk", path)
+	}
+
+	return &vmdkInfo{
+		Capacity:        int64(h.Capacity) * vmdkSectorSize,
+		Size:            fi.Size(),
+		StreamOptimized: h.Flags&vmdkFlagCompressed != 0 && h.Flags&vmdkFlagMarkers != 0,
+	}, nil
+}
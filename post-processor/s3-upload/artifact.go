@@ -0,0 +1,70 @@
+package s3upload
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const BuilderId = "packer.post-processor.s3-upload"
+
+// Artifact is a set of objects uploaded to a bucket.
+type Artifact struct {
+	Bucket string
+	Keys   []string
+
+	// PresignedURLs maps the keys to presigned URLs, if any were asked
+	// for.
+	PresignedURLs map[string]string
+
+	s3conn s3iface.S3API
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (*Artifact) Files() []string {
+	return nil
+}
+
+func (a *Artifact) Id() string {
+	urls := make([]string, len(a.Keys))
+	for i, key := range a.Keys {
+		urls[i] = fmt.Sprintf("s3://%s/%s", a.Bucket, key)
+	}
+	return strings.Join(urls, ",")
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("Objects uploaded to the %s bucket: %s", a.Bucket, strings.Join(a.Keys, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case "bucket":
+		return a.Bucket
+	case "keys":
+		return a.Keys
+	case "presigned_urls":
+		return a.PresignedURLs
+	}
+	return nil
+}
+
+// Destroy deletes the uploaded objects.
+func (a *Artifact) Destroy() error {
+	for _, key := range a.Keys {
+		_, err := a.s3conn.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(a.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("Error deleting s3://%s/%s: %s", a.Bucket, key, err)
+		}
+	}
+	return nil
+}
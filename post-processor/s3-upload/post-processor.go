@@ -0,0 +1,322 @@
+package s3upload
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	awscommon "github.com/hashicorp/packer/builder/amazon/common"
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// The longest validity of presigned URLs signed with SigV4.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+type Config struct {
+	common.PackerConfig    `mapstructure:",squash"`
+	awscommon.AccessConfig `mapstructure:",squash"`
+
+	Bucket string `mapstructure:"bucket"`
+
+	// The key of each file, a template.
+	Key string `mapstructure:"key"`
+
+	// The endpoint of an S3 compatible store, such as MinIO, and whether to
+	// address the buckets in the path of the URLs rather than in the host.
+	Endpoint       string `mapstructure:"endpoint"`
+	ForcePathStyle *bool  `mapstructure:"force_path_style"`
+
+	// The size of the parts of multipart uploads, in megabytes, and how
+	// many are uploaded at once.
+	PartSize    int64 `mapstructure:"part_size"`
+	Concurrency int   `mapstructure:"concurrency"`
+
+	Metadata map[string]string `mapstructure:"metadata"`
+	Tags     map[string]string `mapstructure:"tags"`
+
+	ACL          string `mapstructure:"acl"`
+	StorageClass string `mapstructure:"storage_class"`
+	Encryption   string `mapstructure:"encryption"`
+	KMSKeyID     string `mapstructure:"kms_key_id"`
+
+	// How long the presigned URLs of the objects are valid. None are
+	// generated when 0.
+	PresignExpiry time.Duration `mapstructure:"presign_expiry"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+type keyTemplate struct {
+	BuildName   string
+	BuilderType string
+
+	// The name of the file, and its path relative to the other files of
+	// the artifact.
+	Filename string
+	Path     string
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	p.config.ctx.Funcs = awscommon.TemplateFuncs
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"key"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+	errs = packer.MultiErrorAppend(errs, p.config.AccessConfig.Prepare(&p.config.ctx)...)
+
+	if p.config.Bucket == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("bucket must be set"))
+	}
+
+	if p.config.Key == "" {
+		p.config.Key = "{{.BuildName}}/{{.Path}}"
+	}
+	if err = interpolate.Validate(p.config.Key, &p.config.ctx); err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing key template: %s", err))
+	}
+
+	if p.config.Endpoint != "" {
+		if _, err := url.Parse(p.config.Endpoint); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid endpoint %q: %s", p.config.Endpoint, err))
+		}
+		// S3 compatible stores don't care about the region, but the
+		// requests must be signed for one.
+		if p.config.RawRegion == "" {
+			p.config.RawRegion = "us-east-1"
+		}
+		if p.config.ForcePathStyle == nil {
+			p.config.ForcePathStyle = aws.Bool(true)
+		}
+	}
+
+	if p.config.PartSize == 0 {
+		p.config.PartSize = 16
+	}
+	if p.config.PartSize*1024*1024 < s3manager.MinUploadPartSize {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("part_size must be at least 5"))
+	}
+	if p.config.Concurrency == 0 {
+		p.config.Concurrency = s3manager.DefaultUploadConcurrency
+	}
+	if p.config.Concurrency < 0 {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("concurrency must be positive"))
+	}
+
+	if p.config.Encryption != "" && p.config.Encryption != "AES256" && p.config.Encryption != "aws:kms" {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("invalid encryption '%s'. Only 'AES256' and 'aws:kms' are allowed", p.config.Encryption))
+	}
+	if p.config.KMSKeyID != "" && p.config.Encryption != "aws:kms" {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("kms_key_id requires encryption to be 'aws:kms'"))
+	}
+
+	if p.config.PresignExpiry < 0 || p.config.PresignExpiry > maxPresignExpiry {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("presign_expiry must be between 0 and %s", maxPresignExpiry))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packer.LogSecretFilter.Set(p.config.AccessKey, p.config.SecretKey, p.config.Token)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	files := artifact.Files()
+	if len(files) == 0 {
+		return nil, false, false, fmt.Errorf(
+			"The %s artifact has no file to upload", artifact.BuilderId())
+	}
+
+	session, err := p.config.Session()
+	if err != nil {
+		return nil, false, false, err
+	}
+	s3config := aws.NewConfig()
+	if p.config.Endpoint != "" {
+		s3config = s3config.WithEndpoint(p.config.Endpoint)
+	}
+	if p.config.ForcePathStyle != nil {
+		s3config = s3config.WithS3ForcePathStyle(*p.config.ForcePathStyle)
+	}
+	s3conn := s3.New(session, s3config)
+
+	uploader := s3manager.NewUploaderWithClient(s3conn, func(u *s3manager.Uploader) {
+		u.PartSize = p.config.PartSize * 1024 * 1024
+		u.Concurrency = p.config.Concurrency
+	})
+
+	keys, err := p.keys(files)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	result := &Artifact{
+		Bucket: p.config.Bucket,
+		s3conn: s3conn,
+	}
+	for i, path := range files {
+		key := keys[i]
+		ui.Message(fmt.Sprintf("Uploading %s to s3://%s/%s", path, p.config.Bucket, key))
+		if err := p.upload(ctx, uploader, path, key); err != nil {
+			return nil, false, false, fmt.Errorf(
+				"Error uploading %s to s3://%s/%s: %s", path, p.config.Bucket, key, err)
+		}
+		result.Keys = append(result.Keys, key)
+	}
+
+	if p.config.PresignExpiry > 0 {
+		result.PresignedURLs = make(map[string]string)
+		for _, key := range result.Keys {
+			req, _ := s3conn.GetObjectRequest(&s3.GetObjectInput{
+				Bucket: aws.String(p.config.Bucket),
+				Key:    aws.String(key),
+			})
+			u, err := req.Presign(p.config.PresignExpiry)
+			if err != nil {
+				return nil, false, false, fmt.Errorf("Error presigning the URL of %s: %s", key, err)
+			}
+			result.PresignedURLs[key] = u
+			ui.Message(fmt.Sprintf("Presigned URL of %s, valid for %s: %s", key, p.config.PresignExpiry, u))
+		}
+	}
+
+	return result, true, false, nil
+}
+
+// keys renders the key of each file.
+func (p *PostProcessor) keys(files []string) ([]string, error) {
+	base := commonDir(files)
+
+	keys := make([]string, len(files))
+	seen := make(map[string]string)
+	for i, path := range files {
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			rel = filepath.Base(path)
+		}
+
+		p.config.ctx.Data = &keyTemplate{
+			BuildName:   p.config.PackerBuildName,
+			BuilderType: p.config.PackerBuilderType,
+			Filename:    filepath.Base(path),
+			Path:        filepath.ToSlash(rel),
+		}
+		key, err := interpolate.Render(p.config.Key, &p.config.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Error rendering key template: %s", err)
+		}
+		key = strings.TrimPrefix(key, "/")
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded to %s, use {{.Path}} in the key", other, path, key)
+		}
+		seen[key] = path
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+func (p *PostProcessor) upload(ctx context.Context, uploader *s3manager.Uploader, path, key string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(p.config.Bucket),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String(contentType),
+	}
+	if len(p.config.Metadata) > 0 {
+		input.Metadata = aws.StringMap(p.config.Metadata)
+	}
+	if len(p.config.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range p.config.Tags {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+	if p.config.ACL != "" {
+		input.ACL = aws.String(p.config.ACL)
+	}
+	if p.config.StorageClass != "" {
+		input.StorageClass = aws.String(p.config.StorageClass)
+	}
+	if p.config.Encryption != "" {
+		input.ServerSideEncryption = aws.String(p.config.Encryption)
+	}
+	if p.config.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(p.config.KMSKeyID)
+	}
+
+	output, err := uploader.UploadWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded %s to %s", path, output.Location)
+	return nil
+}
+
+// commonDir returns the deepest directory holding all the files.
+func commonDir(files []string) string {
+	dirs := make([]string, len(files))
+	for i, path := range files {
+		dirs[i] = filepath.Dir(filepath.Clean(path))
+	}
+	sort.Strings(dirs)
+
+	first := strings.Split(dirs[0], string(filepath.Separator))
+	last := strings.Split(dirs[len(dirs)-1], string(filepath.Separator))
+	n := 0
+	for n < len(first) && n < len(last) && first[n] == last[n] {
+		n++
+	}
+	dir := strings.Join(first[:n], string(filepath.Separator))
+	if dir == "" && filepath.IsAbs(dirs[0]) {
+		return string(filepath.Separator)
+	}
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
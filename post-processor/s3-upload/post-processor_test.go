@@ -0,0 +1,332 @@
+package s3upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+// fakeS3 is a minimal S3 server, storing the objects in memory.
+type fakeS3 struct {
+	sync.Mutex
+
+	objects map[string][]byte
+	headers map[string]http.Header
+	parts   map[string]map[int][]byte
+
+	multipartUploads int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		headers: make(map[string]http.Header),
+		parts:   make(map[string]map[int][]byte),
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Path style: /bucket/key
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	_, initiate := query["uploads"]
+
+	switch {
+	case r.Method == "POST" && initiate:
+		s.multipartUploads++
+		id := fmt.Sprintf("upload-%d", s.multipartUploads)
+		s.parts[id] = make(map[int][]byte)
+		s.headers[name] = r.Header
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, id)
+	case r.Method == "PUT" && query.Get("uploadId") != "":
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts[query.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+	case r.Method == "POST" && query.Get("uploadId") != "":
+		parts := s.parts[query.Get("uploadId")]
+		var numbers []int
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var object bytes.Buffer
+		for _, n := range numbers {
+			object.Write(parts[n])
+		}
+		s.objects[name] = object.Bytes()
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>"object"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == "PUT":
+		s.objects[name] = body
+		s.headers[name] = r.Header
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == "DELETE":
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func testConfig(endpoint string) map[string]interface{} {
+	return map[string]interface{}{
+		"access_key":        "minio",
+		"secret_key":        "minio123",
+		"endpoint":          endpoint,
+		"bucket":            "artifacts",
+		"packer_build_name": "qemu",
+	}
+}
+
+func testFiles(t *testing.T, dir string, files map[string][]byte) []string {
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(testConfig("http://localhost:9000")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.RawRegion != "us-east-1" || !*p.config.ForcePathStyle {
+		t.Fatalf("bad defaults for a custom endpoint: %#v", p.config)
+	}
+	if p.config.PartSize != 16 {
+		t.Fatalf("bad part size: %d", p.config.PartSize)
+	}
+
+	bad := map[string]interface{}{
+		"bucket":         "",
+		"part_size":      4,
+		"concurrency":    -1,
+		"encryption":     "des",
+		"kms_key_id":     "key",
+		"presign_expiry": "200h",
+	}
+	for key, value := range bad {
+		raw := testConfig("http://localhost:9000")
+		raw[key] = value
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Fatalf("expected an error with %s", key)
+		}
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	s3 := newFakeS3()
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	td, err := ioutil.TempDir("", "packer-s3-upload")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Larger than a part, to be uploaded in parts
+	disk := bytes.Repeat([]byte("disk"), 3*1024*1024)
+	files := testFiles(t, td, map[string][]byte{
+		"image/disk.qcow2":     disk,
+		"image/disk.sha256":    []byte("checksum"),
+		"image/meta/info.json": []byte("{}"),
+	})
+
+	raw := testConfig(server.URL)
+	raw["key"] = "images/{{.BuildName}}/{{.Path}}"
+	raw["part_size"] = 5
+	raw["metadata"] = map[string]string{"build": "42"}
+	raw["tags"] = map[string]string{"team": "infra", "env": "test"}
+	raw["presign_expiry"] = "1h"
+	var p PostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact := &packer.MockArtifact{FilesValue: files}
+	result, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep {
+		t.Fatal("should keep the input artifact")
+	}
+
+	keys := []string{
+		"images/qemu/disk.qcow2",
+		"images/qemu/disk.sha256",
+		"images/qemu/meta/info.json",
+	}
+	if !reflect.DeepEqual(result.State("keys"), keys) {
+		t.Fatalf("bad keys: %v", result.State("keys"))
+	}
+	if !bytes.Equal(s3.objects["artifacts/images/qemu/disk.qcow2"], disk) {
+		t.Fatal("bad multipart upload")
+	}
+	if s3.multipartUploads != 1 {
+		t.Fatalf("the disk should be uploaded in parts: %d", s3.multipartUploads)
+	}
+	if string(s3.objects["artifacts/images/qemu/disk.sha256"]) != "checksum" {
+		t.Fatal("bad upload")
+	}
+
+	headers := s3.headers["artifacts/images/qemu/meta/info.json"]
+	if headers.Get("X-Amz-Meta-Build") != "42" {
+		t.Fatalf("bad metadata: %v", headers)
+	}
+	if headers.Get("X-Amz-Tagging") != "env=test&team=infra" {
+		t.Fatalf("bad tags: %s", headers.Get("X-Amz-Tagging"))
+	}
+	if headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("bad content type: %s", headers.Get("Content-Type"))
+	}
+
+	urls := result.State("presigned_urls").(map[string]string)
+	u, err := url.Parse(urls["images/qemu/disk.qcow2"])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(u.String(), server.URL+"/artifacts/images/qemu/disk.qcow2?") ||
+		u.Query().Get("X-Amz-Expires") != "3600" {
+		t.Fatalf("bad presigned URL: %s", u)
+	}
+
+	if err := result.Destroy(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(s3.objects) != 0 {
+		t.Fatalf("the objects should be deleted: %v", len(s3.objects))
+	}
+}
+
+func TestPostProcessorPostProcess_conflictingKeys(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-s3-upload")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := testFiles(t, td, map[string][]byte{
+		"a/disk.img": []byte("a"),
+		"b/disk.img": []byte("b"),
+	})
+
+	raw := testConfig("http://localhost:9000")
+	raw["key"] = "{{.Filename}}"
+	var p PostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact := &packer.MockArtifact{FilesValue: files}
+	if _, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact); err == nil {
+		t.Fatal("expected an error with conflicting keys")
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	cases := []struct {
+		files    []string
+		expected string
+	}{
+		{[]string{"/a/b/c.img"}, "/a/b"},
+		{[]string{"/a/b/c.img", "/a/b/d/e.img"}, "/a/b"},
+		{[]string{"/a/b/c.img", "/a/d/e.img"}, "/a"},
+		{[]string{"/a/c.img", "/b/e.img"}, "/"},
+		{[]string{"a/c.img", "b/e.img"}, "."},
+		{[]string{"c.img"}, "."},
+	}
+	for _, tc := range cases {
+		var files []string
+		for _, f := range tc.files {
+			files = append(files, filepath.FromSlash(f))
+		}
+		if dir := commonDir(files); dir != filepath.FromSlash(tc.expected) {
+			t.Fatalf("bad common dir of %v: %s", tc.files, dir)
+		}
+	}
+}
+
+// TestPostProcessorPostProcess_minio uploads to a MinIO server, such as
+// one started with:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// with the S3_UPLOAD_ENDPOINT, S3_UPLOAD_BUCKET, AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables set.
+func TestPostProcessorPostProcess_minio(t *testing.T) {
+	if os.Getenv("PACKER_ACC") == "" || os.Getenv("S3_UPLOAD_ENDPOINT") == "" {
+		t.Skip("This test is only run with PACKER_ACC=1 and S3_UPLOAD_ENDPOINT set")
+	}
+
+	td, err := ioutil.TempDir("", "packer-s3-upload")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	files := testFiles(t, td, map[string][]byte{
+		"disk.raw": bytes.Repeat([]byte{0}, 6*1024*1024),
+	})
+
+	var p PostProcessor
+	err = p.Configure(map[string]interface{}{
+		"endpoint":          os.Getenv("S3_UPLOAD_ENDPOINT"),
+		"bucket":            os.Getenv("S3_UPLOAD_BUCKET"),
+		"part_size":         5,
+		"tags":              map[string]string{"test": "true"},
+		"presign_expiry":    "5m",
+		"packer_build_name": "acc",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact := &packer.MockArtifact{FilesValue: files}
+	result, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer result.Destroy()
+
+	u := result.State("presigned_urls").(map[string]string)["acc/disk.raw"]
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != 6*1024*1024 {
+		t.Fatalf("bad download: %s, %d bytes", resp.Status, resp.ContentLength)
+	}
+}
@@ -0,0 +1,47 @@
+package sbom
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+const BuilderId = "packer.post-processor.sbom"
+
+// StateFiles is the artifact state listing the SBOM files.
+const StateFiles = "sbom_files"
+
+// Artifact is the input artifact along with its software bills of
+// materials.
+type Artifact struct {
+	artifact packer.Artifact
+	files    []string
+}
+
+func (a *Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return append(append([]string{}, a.artifact.Files()...), a.files...)
+}
+
+func (a *Artifact) Id() string {
+	return a.artifact.Id()
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("%s\nSBOM: %s", a.artifact.String(), strings.Join(a.files, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	if name == StateFiles {
+		return a.files
+	}
+	return a.artifact.State(name)
+}
+
+func (a *Artifact) Destroy() error {
+	return a.artifact.Destroy()
+}
@@ -0,0 +1,159 @@
+package sbom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/sbom"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// formats maps the SBOM formats to the functions writing them.
+var formats = map[string]func(*sbom.Inventory, sbom.Subject, time.Time) ([]byte, error){
+	"spdx":      sbom.SPDX,
+	"cyclonedx": sbom.CycloneDX,
+}
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The SBOM formats to write, spdx and cyclonedx. Defaults to both.
+	Formats []string `mapstructure:"formats"`
+
+	// The path of the SBOM files.
+	OutputPath string `mapstructure:"output"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+type outputPathTemplate struct {
+	BuildName   string
+	BuilderType string
+	Format      string
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"output"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+	errs := new(packer.MultiError)
+
+	if p.config.Formats == nil {
+		p.config.Formats = []string{"spdx", "cyclonedx"}
+	}
+	for i, f := range p.config.Formats {
+		p.config.Formats[i] = strings.ToLower(f)
+		if _, ok := formats[p.config.Formats[i]]; !ok {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("Unrecognized SBOM format: %s", f))
+		}
+	}
+
+	if p.config.OutputPath == "" {
+		p.config.OutputPath = "packer_{{.BuildName}}_{{.BuilderType}}.{{.Format}}.json"
+	}
+
+	if err = interpolate.Validate(p.config.OutputPath, &p.config.ctx); err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing target template: %s", err))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	outputs, err := commonhelper.RetrieveBuildOutputs(p.config.PackerBuildName)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error reading the build outputs: %s", err)
+	}
+	value, ok := outputs[sbom.InventoryOutput]
+	if !ok {
+		return nil, false, false, fmt.Errorf(
+			"No package inventory found for build %q: add the sbom provisioner to the build",
+			p.config.PackerBuildName)
+	}
+	inv := &sbom.Inventory{}
+	if err := json.Unmarshal([]byte(value), inv); err != nil {
+		return nil, false, false, fmt.Errorf("Error reading the package inventory: %s", err)
+	}
+
+	subject := sbom.Subject{
+		Name:    p.config.PackerBuildName,
+		Version: artifact.Id(),
+	}
+	if subject.Name == "" {
+		subject.Name = p.config.PackerBuilderType
+	}
+	created := time.Now()
+
+	newArtifact := &Artifact{artifact: artifact}
+	for _, format := range p.config.Formats {
+		p.config.ctx.Data = &outputPathTemplate{
+			BuildName:   p.config.PackerBuildName,
+			BuilderType: p.config.PackerBuilderType,
+			Format:      format,
+		}
+		path, err := interpolate.Render(p.config.OutputPath, &p.config.ctx)
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		doc, err := formats[format](inv, subject, created)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Error creating the %s document: %s", format, err)
+		}
+		if dir := filepath.Dir(path); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, false, false, fmt.Errorf("unable to create dir: %s", err)
+			}
+		}
+		if err := ioutil.WriteFile(path, doc, 0644); err != nil {
+			return nil, false, false, fmt.Errorf("unable to write %s: %s", path, err)
+		}
+
+		ui.Say(fmt.Sprintf("Wrote the %s SBOM of %d packages to %s", format, len(inv.Packages), path))
+		newArtifact.files = append(newArtifact.files, path)
+	}
+
+	// Let the manifest post-processor reference the files, along with
+	// those of the other sbom post-processors of the build.
+	files := newArtifact.files
+	if previous := outputs[sbom.FilesOutput]; previous != "" {
+		files = append(strings.Split(previous, ","), files...)
+	}
+	err = commonhelper.SetBuildOutputs(p.config.PackerBuildName, map[string]string{
+		sbom.FilesOutput: strings.Join(files, ","),
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error saving outputs: %s", err)
+	}
+
+	// sets keep and forceOverride to true because the SBOM describes the
+	// artifact, which is still needed.
+	return newArtifact, true, true, nil
+}
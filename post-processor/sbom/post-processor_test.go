@@ -0,0 +1,99 @@
+package sbom
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer/common/sbom"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.config.Formats, []string{"spdx", "cyclonedx"}) {
+		t.Fatalf("unexpected formats: %#v", p.config.Formats)
+	}
+
+	p = PostProcessor{}
+	if err := p.Configure(map[string]interface{}{"formats": []string{"swid"}}); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-sbom")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("sbom-test")
+
+	td, err := ioutil.TempDir("", "packer-sbom")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var p PostProcessor
+	err = p.Configure(map[string]interface{}{
+		"packer_build_name":   "sbom-test",
+		"packer_builder_type": "docker",
+		"output":              filepath.Join(td, "{{.BuildName}}.{{.Format}}.json"),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	source := &packer.MockArtifact{FilesValue: []string{"image.tar"}}
+	if _, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), source); err == nil {
+		t.Fatal("should fail without an inventory")
+	}
+
+	inv, _ := json.Marshal(&sbom.Inventory{
+		Distro:   "alpine",
+		Packages: []sbom.Package{{Type: sbom.TypeAPK, Name: "musl", Version: "1.1.22-r3"}},
+	})
+	err = commonhelper.SetBuildOutputs("sbom-test", map[string]string{sbom.InventoryOutput: string(inv)})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t), source)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep {
+		t.Fatal("should keep the input artifact")
+	}
+
+	files := []string{
+		filepath.Join(td, "sbom-test.spdx.json"),
+		filepath.Join(td, "sbom-test.cyclonedx.json"),
+	}
+	if !reflect.DeepEqual(artifact.Files(), append([]string{"image.tar"}, files...)) {
+		t.Fatalf("unexpected files: %#v", artifact.Files())
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("sbom-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs[sbom.FilesOutput] != files[0]+","+files[1] {
+		t.Fatalf("unexpected outputs: %#v", outputs)
+	}
+}
@@ -0,0 +1,59 @@
+package signature
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+const BuilderId = "packer.post-processor.signature"
+
+// The names of the artifact state set by this post-processor.
+const (
+	// StateFingerprints is the list of the fingerprints of the keys that
+	// signed the files.
+	StateFingerprints = "signer_fingerprints"
+
+	// StateSignatures is the list of the signature files.
+	StateSignatures = "signatures"
+)
+
+// Artifact is the signed artifact: the files of the input artifact along
+// with their signatures.
+type Artifact struct {
+	artifact     packer.Artifact
+	signatures   []string
+	fingerprints []string
+}
+
+func (a *Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return append(append([]string{}, a.artifact.Files()...), a.signatures...)
+}
+
+func (a *Artifact) Id() string {
+	return a.artifact.Id()
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("%s\nSigned by %s: %s",
+		a.artifact.String(), strings.Join(a.fingerprints, ", "), strings.Join(a.signatures, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case StateFingerprints:
+		return a.fingerprints
+	case StateSignatures:
+		return a.signatures
+	}
+	return a.artifact.State(name)
+}
+
+func (a *Artifact) Destroy() error {
+	return a.artifact.Destroy()
+}
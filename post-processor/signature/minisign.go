@@ -0,0 +1,83 @@
+package signature
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// minisignSigner signs with minisign and an ed25519 secret key file.
+type minisignSigner struct {
+	config *Config
+	keyID  string
+}
+
+func newMinisignSigner(config *Config) *minisignSigner {
+	return &minisignSigner{config: config}
+}
+
+func (s *minisignSigner) Sign(ctx context.Context, path string) (string, error) {
+	sig := path + ".minisig"
+
+	// minisign reads the passphrase from its standard input, and doesn't
+	// ask for one if the key is not encrypted.
+	stdin := ""
+	if s.config.Passphrase != "" {
+		stdin = s.config.Passphrase + "\n"
+	}
+	_, err := run(ctx, stdin, s.config.MinisignPath,
+		"-S", "-s", s.config.KeyFile, "-m", path, "-x", sig)
+	if err != nil {
+		return "", err
+	}
+
+	if s.keyID == "" {
+		s.keyID, err = readMinisignKeyID(sig)
+		if err != nil {
+			return "", err
+		}
+	}
+	return sig, nil
+}
+
+func (s *minisignSigner) Fingerprint() string {
+	return s.keyID
+}
+
+func (s *minisignSigner) Close() error {
+	return nil
+}
+
+// readMinisignKeyID reads the ID of the key that made a minisign signature.
+func readMinisignKeyID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// The first line is the untrusted comment, the second the signature:
+	// the algorithm, the key ID and the ed25519 signature.
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			return "", fmt.Errorf("Invalid minisign signature %s", path)
+		}
+	}
+	return parseMinisignKeyID(scanner.Text())
+}
+
+func parseMinisignKeyID(sig string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sig))
+	if err != nil {
+		return "", fmt.Errorf("Invalid minisign signature: %s", err)
+	}
+	if len(raw) != 74 {
+		return "", fmt.Errorf("Invalid minisign signature: unexpected length %d", len(raw))
+	}
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(raw[2:10])), nil
+}
@@ -0,0 +1,123 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// openpgpSigner signs with gpg, from the configured keyring or from a
+// temporary keyring the key file is imported in.
+type openpgpSigner struct {
+	config      *Config
+	home        string
+	tempHome    bool
+	fingerprint string
+}
+
+func newOpenPGPSigner(ctx context.Context, config *Config) (*openpgpSigner, error) {
+	s := &openpgpSigner{config: config, home: config.GnuPGHome}
+
+	if config.KeyFile != "" {
+		home, err := ioutil.TempDir("", "packer-gnupg")
+		if err != nil {
+			return nil, fmt.Errorf("Error creating temporary keyring: %s", err)
+		}
+		s.home = home
+		s.tempHome = true
+
+		args := append(s.args(), "--import", config.KeyFile)
+		if _, err := run(ctx, s.stdin(), config.GPGPath, args...); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("Error importing %s: %s", config.KeyFile, err)
+		}
+	}
+
+	args := append(s.args(), "--with-colons", "--list-secret-keys")
+	if config.KeyID != "" {
+		args = append(args, config.KeyID)
+	}
+	out, err := run(ctx, "", config.GPGPath, args...)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Error listing secret keys: %s", err)
+	}
+	s.fingerprint = parseFingerprint(out)
+	if s.fingerprint == "" {
+		s.Close()
+		return nil, fmt.Errorf("No secret key found for %q", config.KeyID)
+	}
+
+	return s, nil
+}
+
+func (s *openpgpSigner) Sign(ctx context.Context, path string) (string, error) {
+	sig := path + ".sig"
+	if s.config.Armor {
+		sig = path + ".asc"
+	}
+
+	args := append(s.args(), "--yes", "--local-user", s.fingerprint, "--detach-sign")
+	if s.config.Armor {
+		args = append(args, "--armor")
+	}
+	args = append(args, "--output", sig, path)
+	if _, err := run(ctx, s.stdin(), s.config.GPGPath, args...); err != nil {
+		return "", err
+	}
+	return sig, nil
+}
+
+func (s *openpgpSigner) Fingerprint() string {
+	return s.fingerprint
+}
+
+func (s *openpgpSigner) Close() error {
+	if !s.tempHome {
+		return nil
+	}
+	// Stop the agent gpg started for the temporary keyring.
+	run(context.Background(), "", "gpgconf", "--homedir", s.home, "--kill", "gpg-agent")
+	return os.RemoveAll(s.home)
+}
+
+// args returns the arguments common to all gpg commands.
+func (s *openpgpSigner) args() []string {
+	args := []string{"--batch", "--no-tty"}
+	if s.home != "" {
+		args = append(args, "--homedir", s.home)
+	}
+	if s.config.Passphrase != "" {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+	}
+	return args
+}
+
+func (s *openpgpSigner) stdin() string {
+	if s.config.Passphrase == "" {
+		return ""
+	}
+	return s.config.Passphrase + "\n"
+}
+
+// parseFingerprint returns the fingerprint of the first secret key in the
+// colon separated output of gpg --list-secret-keys.
+func parseFingerprint(out string) string {
+	inKey := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ":")
+		switch fields[0] {
+		case "sec":
+			inKey = true
+		case "ssb":
+			inKey = false
+		case "fpr":
+			if inKey && len(fields) > 9 {
+				return fields[9]
+			}
+		}
+	}
+	return ""
+}
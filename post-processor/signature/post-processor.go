@@ -0,0 +1,167 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+const (
+	FormatOpenPGP  = "openpgp"
+	FormatMinisign = "minisign"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The signature format, openpgp or minisign.
+	Format string `mapstructure:"format"`
+
+	// The OpenPGP key to sign with. Defaults to the first secret key of
+	// the keyring.
+	KeyID string `mapstructure:"key_id"`
+
+	// The GnuPG home directory holding the keyring.
+	GnuPGHome string `mapstructure:"gnupg_home"`
+
+	// A secret key file. OpenPGP keys are imported in a temporary keyring,
+	// minisign keys are used as is.
+	KeyFile string `mapstructure:"key_file"`
+
+	// The passphrase of the secret key.
+	Passphrase string `mapstructure:"passphrase"`
+
+	// Whether to write ASCII armored OpenPGP signatures.
+	Armor bool `mapstructure:"armor"`
+
+	// The paths of the gpg and minisign programs.
+	GPGPath      string `mapstructure:"gpg_path"`
+	MinisignPath string `mapstructure:"minisign_path"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+// signer signs files with a single key.
+type signer interface {
+	// Sign writes a detached signature of the file and returns its path.
+	Sign(ctx context.Context, path string) (string, error)
+
+	// Fingerprint identifies the key, once a file is signed.
+	Fingerprint() string
+
+	// Close removes any temporary state of the signer.
+	Close() error
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	if p.config.Format == "" {
+		p.config.Format = FormatOpenPGP
+	}
+	p.config.Format = strings.ToLower(p.config.Format)
+
+	if p.config.GPGPath == "" {
+		p.config.GPGPath = "gpg"
+	}
+	if p.config.MinisignPath == "" {
+		p.config.MinisignPath = "minisign"
+	}
+
+	switch p.config.Format {
+	case FormatOpenPGP:
+		if p.config.KeyFile != "" && p.config.GnuPGHome != "" {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("Only one of key_file or gnupg_home can be specified."))
+		}
+	case FormatMinisign:
+		if p.config.KeyFile == "" {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("key_file must be specified for minisign signatures."))
+		}
+		if p.config.KeyID != "" || p.config.GnuPGHome != "" || p.config.Armor {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("key_id, gnupg_home and armor only apply to openpgp signatures."))
+		}
+	default:
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("Unrecognized signature format: %s", p.config.Format))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packer.LogSecretFilter.Set(p.config.Passphrase)
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	var s signer
+	var err error
+	switch p.config.Format {
+	case FormatOpenPGP:
+		s, err = newOpenPGPSigner(ctx, &p.config)
+	case FormatMinisign:
+		s = newMinisignSigner(&p.config)
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer s.Close()
+
+	newArtifact := &Artifact{artifact: artifact}
+	for _, path := range artifact.Files() {
+		ui.Message(fmt.Sprintf("Signing %s", path))
+		sig, err := s.Sign(ctx, path)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Error signing %s: %s", path, err)
+		}
+		newArtifact.signatures = append(newArtifact.signatures, sig)
+	}
+	if fpr := s.Fingerprint(); fpr != "" {
+		newArtifact.fingerprints = []string{fpr}
+		ui.Say(fmt.Sprintf("Signed %d files with key %s", len(newArtifact.signatures), fpr))
+	}
+
+	// sets keep and forceOverride to true because the signatures are
+	// useless without the files they sign.
+	return newArtifact, true, true, nil
+}
+
+// run runs a program, feeding it stdin, and returns its standard output.
+// The error includes the standard error of the program.
+func run(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s\n%s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,161 @@
+package signature
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.Format != FormatOpenPGP {
+		t.Fatalf("unexpected format: %s", p.config.Format)
+	}
+
+	cases := []map[string]interface{}{
+		{"format": "x509"},
+		{"format": "minisign"},
+		{"format": "minisign", "key_file": "minisign.key", "armor": true},
+		{"key_file": "secret.asc", "gnupg_home": "/tmp/gnupg"},
+	}
+	for _, c := range cases {
+		p = PostProcessor{}
+		if err := p.Configure(c); err == nil {
+			t.Fatalf("should have error: %#v", c)
+		}
+	}
+}
+
+func TestParseMinisignKeyID(t *testing.T) {
+	raw := append([]byte("Ed"), 0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01)
+	raw = append(raw, make([]byte, 64)...)
+
+	id, err := parseMinisignKeyID(base64.StdEncoding.EncodeToString(raw))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if id != "0123456789ABCDEF" {
+		t.Fatalf("unexpected key ID: %s", id)
+	}
+
+	if _, err := parseMinisignKeyID("RWQ="); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	out := `sec:u:255:22:36B2D4D1E8E0E8A1:1559566321:::u:::scESC:::+:::ed25519:::0:
+fpr:::::::::5F1C3F2E9E7B0D1A6C4E36B2D4D1E8E0E8A1B2C3:
+grp:::::::::2B67E1A1C0D0F6E2A3F4B5C6D7E8F9A0B1C2D3E4:
+uid:u::::1559566321::B0C1D2E3F4A5B6C7D8E9F0A1B2C3D4E5F6A7B8C9::Packer <packer@example.com>::::::::::0:
+ssb:u:255:18:1A2B3C4D5E6F7A8B:1559566321::::::e:::+:::cv25519::
+fpr:::::::::0A1B2C3D4E5F6A7B8C9D0E1F2A3B4C5D6E7F8A9B:
+`
+	if fpr := parseFingerprint(out); fpr != "5F1C3F2E9E7B0D1A6C4E36B2D4D1E8E0E8A1B2C3" {
+		t.Fatalf("unexpected fingerprint: %s", fpr)
+	}
+}
+
+func TestPostProcessorPostProcess_OpenPGP(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	td, err := ioutil.TempDir("", "packer-signature")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	home := filepath.Join(td, "gnupg")
+	if err := os.Mkdir(home, 0700); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+
+	_, err = run(context.Background(), "", "gpg", "--batch", "--homedir", home,
+		"--pinentry-mode", "loopback", "--passphrase", "secret",
+		"--quick-gen-key", "Packer <packer@example.com>", "ed25519", "sign", "never")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	file := filepath.Join(td, "package.txt")
+	if err := ioutil.WriteFile(file, []byte("Hello world!"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var p PostProcessor
+	err = p.Configure(map[string]interface{}{
+		"gnupg_home": home,
+		"passphrase": "secret",
+		"armor":      true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	artifact, keep, _, err := p.PostProcess(context.Background(), packer.TestUi(t),
+		&packer.MockArtifact{FilesValue: []string{file}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !keep {
+		t.Fatal("should keep the input artifact")
+	}
+	if !reflect.DeepEqual(artifact.Files(), []string{file, file + ".asc"}) {
+		t.Fatalf("unexpected files: %#v", artifact.Files())
+	}
+	fingerprints := artifact.State(StateFingerprints).([]string)
+	if len(fingerprints) != 1 || len(fingerprints[0]) != 40 {
+		t.Fatalf("unexpected fingerprints: %#v", fingerprints)
+	}
+
+	_, err = run(context.Background(), "", "gpg", "--batch", "--homedir", home,
+		"--verify", file+".asc", file)
+	if err != nil {
+		t.Fatalf("signature should verify: %s", err)
+	}
+
+	// The same key, imported from a key file.
+	key := filepath.Join(td, "secret.asc")
+	_, err = run(context.Background(), "", "gpg", "--batch", "--homedir", home,
+		"--pinentry-mode", "loopback", "--passphrase", "secret",
+		"--armor", "--output", key, "--export-secret-keys")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p = PostProcessor{}
+	err = p.Configure(map[string]interface{}{
+		"key_file":   key,
+		"passphrase": "secret",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	artifact, _, _, err = p.PostProcess(context.Background(), packer.TestUi(t),
+		&packer.MockArtifact{FilesValue: []string{file}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(artifact.State(StateFingerprints), fingerprints) {
+		t.Fatalf("unexpected fingerprints: %#v", artifact.State(StateFingerprints))
+	}
+	if _, err := os.Stat(file + ".sig"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+package vagrantcatalog
+
+import (
+	"fmt"
+)
+
+const BuilderId = "packer.post-processor.vagrant-catalog"
+
+// Artifact is a box published in a catalog.
+type Artifact struct {
+	// The path of the box in the catalog directory, and of the catalog.
+	Path        string
+	CatalogPath string
+
+	BoxName  string
+	Version  string
+	Provider string
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return []string{a.Path}
+}
+
+func (a *Artifact) Id() string {
+	return a.Provider
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("'%s' provider box %s v%s in catalog: %s",
+		a.Provider, a.BoxName, a.Version, a.CatalogPath)
+}
+
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case "catalog":
+		return a.CatalogPath
+	case "version":
+		return a.Version
+	}
+	return nil
+}
+
+// Destroy leaves the box published: a later post-processor not keeping its
+// input must not unpublish it. Old versions are pruned with keep_versions.
+func (a *Artifact) Destroy() error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package vagrantcatalog
+
+import (
+	"sort"
+
+	"github.com/hashicorp/go-version"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+)
+
+// Catalog is the metadata.json of a box, which `vagrant box add` reads to
+// find the versions and providers of the box.
+type Catalog struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Versions    []*CatalogVersion `json:"versions"`
+}
+
+type CatalogVersion struct {
+	Version     string             `json:"version"`
+	Description string             `json:"description,omitempty"`
+	Providers   []*CatalogProvider `json:"providers"`
+}
+
+type CatalogProvider struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	ChecksumType string `json:"checksum_type,omitempty"`
+	Checksum     string `json:"checksum,omitempty"`
+}
+
+// updateCatalog runs update on the catalog at path and writes the result.
+// The catalog is locked meanwhile, so that builds running in parallel can
+// add their providers to the same catalog. It is replaced through a rename
+// so that Vagrant never downloads a partial file.
+func updateCatalog(path string, update func(*Catalog) error) error {
+	c := &Catalog{}
+	return commonhelper.UpdateJSONFile(path, c, 0644, func() error {
+		return update(c)
+	})
+}
+
+// readCatalog reads a catalog, or returns an empty one if it doesn't exist.
+func readCatalog(path string) (*Catalog, error) {
+	c := &Catalog{}
+	if err := commonhelper.ReadJSONFile(path, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// add adds a provider to a version of the box, replacing the provider of
+// the same name if any. It returns whether a provider was replaced.
+func (c *Catalog) add(v string, provider *CatalogProvider) bool {
+	var cv *CatalogVersion
+	for _, existing := range c.Versions {
+		if existing.Version == v {
+			cv = existing
+			break
+		}
+	}
+	if cv == nil {
+		cv = &CatalogVersion{Version: v}
+		c.Versions = append(c.Versions, cv)
+		c.sort()
+	}
+
+	for i, existing := range cv.Providers {
+		if existing.Name == provider.Name {
+			cv.Providers[i] = provider
+			return true
+		}
+	}
+	cv.Providers = append(cv.Providers, provider)
+	return false
+}
+
+// prune removes the oldest versions, keeping the keep most recent ones,
+// and returns the removed versions.
+func (c *Catalog) prune(keep int) []*CatalogVersion {
+	if keep <= 0 || len(c.Versions) <= keep {
+		return nil
+	}
+	c.sort()
+	removed := c.Versions[:len(c.Versions)-keep]
+	c.Versions = append([]*CatalogVersion{}, c.Versions[len(c.Versions)-keep:]...)
+	return removed
+}
+
+// sort sorts the versions from the oldest to the most recent one.
+func (c *Catalog) sort() {
+	sort.SliceStable(c.Versions, func(i, j int) bool {
+		vi, erri := version.NewVersion(c.Versions[i].Version)
+		vj, errj := version.NewVersion(c.Versions[j].Version)
+		if erri != nil || errj != nil {
+			return c.Versions[i].Version < c.Versions[j].Version
+		}
+		return vi.LessThan(vj)
+	})
+}
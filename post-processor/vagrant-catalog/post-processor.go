@@ -0,0 +1,313 @@
+// vagrantcatalog implements the packer.PostProcessor interface and adds a
+// post-processor that publishes boxes in a Vagrant catalog, the
+// metadata.json of a self hosted box.
+package vagrantcatalog
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+var builtins = map[string]string{
+	"mitchellh.post-processor.vagrant": "vagrant",
+	"vagrant":                          "vagrant",
+}
+
+var checksumTypes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+const catalogFile = "metadata.json"
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	BoxName            string `mapstructure:"box_name"`
+	BoxDescription     string `mapstructure:"box_description"`
+	Version            string `mapstructure:"version"`
+	VersionDescription string `mapstructure:"version_description"`
+
+	// The local directory holding the catalog and the boxes, and the URL
+	// it is served at.
+	CatalogDirectory string `mapstructure:"catalog_directory"`
+	BaseURL          string `mapstructure:"base_url"`
+
+	// The path of the box, relative to the catalog directory.
+	BoxPath string `mapstructure:"box_path"`
+
+	ChecksumType string `mapstructure:"checksum_type"`
+
+	// The number of versions kept in the catalog. 0 keeps them all.
+	KeepVersions int `mapstructure:"keep_versions"`
+
+	ctx interpolate.Context
+}
+
+type boxPathTemplate struct {
+	BoxName   string
+	Version   string
+	Provider  string
+	BuildName string
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"box_path"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packer.MultiError)
+
+	templates := map[string]*string{
+		"box_name":          &p.config.BoxName,
+		"version":           &p.config.Version,
+		"catalog_directory": &p.config.CatalogDirectory,
+		"base_url":          &p.config.BaseURL,
+	}
+	for key, ptr := range templates {
+		if *ptr == "" {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("%s must be set", key))
+		}
+	}
+
+	if p.config.Version != "" {
+		if _, err := version.NewVersion(p.config.Version); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid version %q: %s", p.config.Version, err))
+		}
+	}
+
+	p.config.BaseURL = strings.TrimSuffix(p.config.BaseURL, "/")
+
+	if p.config.BoxPath == "" {
+		p.config.BoxPath = "{{.Version}}/{{.Provider}}.box"
+	}
+	if err = interpolate.Validate(p.config.BoxPath, &p.config.ctx); err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing box_path template: %s", err))
+	}
+
+	if p.config.ChecksumType == "" {
+		p.config.ChecksumType = "sha256"
+	}
+	p.config.ChecksumType = strings.ToLower(p.config.ChecksumType)
+	if _, ok := checksumTypes[p.config.ChecksumType]; !ok {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Unsupported checksum_type: %s", p.config.ChecksumType))
+	}
+
+	if p.config.KeepVersions < 0 {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("keep_versions must be positive"))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	if _, ok := builtins[artifact.BuilderId()]; !ok {
+		return nil, false, false, fmt.Errorf(
+			"Unknown artifact type, requires box from vagrant post-processor or vagrant builder: %s", artifact.BuilderId())
+	}
+
+	// We assume that there is only one .box file to publish
+	box := artifact.Files()[0]
+	if !strings.HasSuffix(box, ".box") {
+		return nil, false, false, fmt.Errorf(
+			"Unknown files in artifact, vagrant box is required: %s", artifact.Files())
+	}
+
+	provider := providerFromBuilderName(artifact.Id())
+
+	p.config.ctx.Data = &boxPathTemplate{
+		BoxName:   p.config.BoxName,
+		Version:   p.config.Version,
+		Provider:  provider,
+		BuildName: p.config.PackerBuildName,
+	}
+	boxPath, err := interpolate.Render(p.config.BoxPath, &p.config.ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error processing box_path: %s", err)
+	}
+	boxPath = path.Clean(filepath.ToSlash(boxPath))
+	if path.IsAbs(boxPath) || boxPath == ".." || strings.HasPrefix(boxPath, "../") {
+		return nil, false, false, fmt.Errorf(
+			"box_path must be relative to the catalog directory: %s", boxPath)
+	}
+
+	target := filepath.Join(p.config.CatalogDirectory, filepath.FromSlash(boxPath))
+	ui.Say(fmt.Sprintf("Copying box to %s", target))
+	temp, checksum, err := copyBox(box, target, checksumTypes[p.config.ChecksumType]())
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error copying box: %s", err)
+	}
+	// Only published once the catalog was updated, a box already at target
+	// is kept if it fails.
+	defer os.Remove(temp)
+
+	catalogPath := filepath.Join(p.config.CatalogDirectory, catalogFile)
+	ui.Say(fmt.Sprintf("Adding version %s of the %s provider to %s",
+		p.config.Version, provider, catalogPath))
+
+	var removed []*CatalogVersion
+	err = updateCatalog(catalogPath, func(c *Catalog) error {
+		if c.Name != "" && c.Name != p.config.BoxName {
+			return fmt.Errorf("%s is the catalog of the %s box", catalogPath, c.Name)
+		}
+		c.Name = p.config.BoxName
+		if p.config.BoxDescription != "" {
+			c.Description = p.config.BoxDescription
+		}
+
+		replaced := c.add(p.config.Version, &CatalogProvider{
+			Name:         provider,
+			URL:          p.config.BaseURL + "/" + boxPath,
+			ChecksumType: p.config.ChecksumType,
+			Checksum:     checksum,
+		})
+		if replaced {
+			ui.Message(fmt.Sprintf("Replaced the existing %s provider of version %s",
+				provider, p.config.Version))
+		}
+		for _, cv := range c.Versions {
+			if cv.Version == p.config.Version && p.config.VersionDescription != "" {
+				cv.Description = p.config.VersionDescription
+			}
+		}
+
+		removed = c.prune(p.config.KeepVersions)
+		for _, cv := range removed {
+			if cv.Version == p.config.Version {
+				return fmt.Errorf("version %s is older than the %d versions kept",
+					p.config.Version, p.config.KeepVersions)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error updating %s: %s", catalogPath, err)
+	}
+	if err := os.Rename(temp, target); err != nil {
+		return nil, false, false, fmt.Errorf("Error copying box: %s", err)
+	}
+
+	for _, cv := range removed {
+		ui.Message(fmt.Sprintf("Removing version %s", cv.Version))
+		p.removeVersion(ui, cv)
+	}
+
+	return &Artifact{
+		Path:        target,
+		CatalogPath: catalogPath,
+		BoxName:     p.config.BoxName,
+		Version:     p.config.Version,
+		Provider:    provider,
+	}, false, false, nil
+}
+
+// removeVersion deletes the boxes of a version removed from the catalog,
+// when they are in the catalog directory.
+func (p *PostProcessor) removeVersion(ui packer.Ui, cv *CatalogVersion) {
+	prefix := p.config.BaseURL + "/"
+	for _, provider := range cv.Providers {
+		if !strings.HasPrefix(provider.URL, prefix) {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(provider.URL, prefix))
+		if strings.HasPrefix(rel, "../") {
+			continue
+		}
+
+		target := filepath.Join(p.config.CatalogDirectory, filepath.FromSlash(rel))
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			ui.Error(fmt.Sprintf("Error removing %s: %s", target, err))
+			continue
+		}
+
+		// Remove the directories left empty, up to the catalog directory.
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			if os.Remove(filepath.Join(p.config.CatalogDirectory, dir)) != nil {
+				break
+			}
+		}
+	}
+}
+
+// copyBox copies the box to a temporary file next to target and returns its
+// path and the checksum of the box. The caller renames it to target.
+func copyBox(src, target string, h hash.Hash) (string, string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", "", err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(target), ".box")
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	return out.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// converts a packer builder name to the corresponding vagrant
+// provider
+func providerFromBuilderName(name string) string {
+	switch name {
+	case "vmware":
+		return "vmware_desktop"
+	default:
+		return name
+	}
+}
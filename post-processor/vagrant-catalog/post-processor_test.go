@@ -0,0 +1,255 @@
+package vagrantcatalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig(dir, v string) map[string]interface{} {
+	return map[string]interface{}{
+		"box_name":          "acme/ubuntu",
+		"version":           v,
+		"catalog_directory": dir,
+		"base_url":          "https://boxes.example.com/ubuntu/",
+	}
+}
+
+func testBox(t *testing.T, dir, content string) *packer.MockArtifact {
+	path := filepath.Join(dir, "packer_virtualbox.box")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &packer.MockArtifact{
+		BuilderIdValue: "mitchellh.post-processor.vagrant",
+		IdValue:        "virtualbox",
+		FilesValue:     []string{path},
+	}
+}
+
+func testPostProcess(t *testing.T, raw map[string]interface{}, artifact packer.Artifact) (packer.Artifact, error) {
+	var p PostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result, _, _, err := p.PostProcess(context.Background(), packer.TestUi(t), artifact)
+	return result, err
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(testConfig("catalog", "1.0.0")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.ChecksumType != "sha256" {
+		t.Fatalf("bad checksum type: %s", p.config.ChecksumType)
+	}
+	if p.config.BaseURL != "https://boxes.example.com/ubuntu" {
+		t.Fatalf("bad base url: %s", p.config.BaseURL)
+	}
+
+	bad := map[string]interface{}{
+		"version":       "",
+		"checksum_type": "crc32",
+		"keep_versions": -1,
+	}
+	for key, value := range bad {
+		raw := testConfig("catalog", "1.0.0")
+		raw[key] = value
+		if err := p.Configure(raw); err == nil {
+			t.Fatalf("expected an error with %s", key)
+		}
+	}
+
+	raw := testConfig("catalog", "not a version")
+	if err := new(PostProcessor).Configure(raw); err == nil {
+		t.Fatal("expected an error with an invalid version")
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-vagrant-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	catalogDir := filepath.Join(td, "catalog")
+
+	result, err := testPostProcess(t, testConfig(catalogDir, "1.0.0"), testBox(t, td, "box"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	box := filepath.Join(catalogDir, "1.0.0", "virtualbox.box")
+	if files := result.Files(); len(files) != 1 || files[0] != box {
+		t.Fatalf("bad files: %v", files)
+	}
+	if _, err := os.Stat(box); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c, err := readCatalog(filepath.Join(catalogDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Name != "acme/ubuntu" || len(c.Versions) != 1 {
+		t.Fatalf("bad catalog: %#v", c)
+	}
+	provider := c.Versions[0].Providers[0]
+	sum := sha256.Sum256([]byte("box"))
+	if provider.Name != "virtualbox" ||
+		provider.URL != "https://boxes.example.com/ubuntu/1.0.0/virtualbox.box" ||
+		provider.ChecksumType != "sha256" ||
+		provider.Checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad provider: %#v", provider)
+	}
+
+	// Add a second provider to the same version
+	artifact := testBox(t, td, "box")
+	artifact.IdValue = "vmware"
+	if _, err := testPostProcess(t, testConfig(catalogDir, "1.0.0"), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c, err = readCatalog(filepath.Join(catalogDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Versions) != 1 || len(c.Versions[0].Providers) != 2 ||
+		c.Versions[0].Providers[1].Name != "vmware_desktop" {
+		t.Fatalf("bad catalog: %#v", c.Versions)
+	}
+
+	// Rebuilding a provider replaces it
+	if _, err := testPostProcess(t, testConfig(catalogDir, "1.0.0"), testBox(t, td, "rebuilt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c, err = readCatalog(filepath.Join(catalogDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum = sha256.Sum256([]byte("rebuilt"))
+	if len(c.Versions[0].Providers) != 2 ||
+		c.Versions[0].Providers[0].Checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad catalog: %#v", c.Versions[0].Providers)
+	}
+
+	// Destroying the artifact leaves the box published
+	if err := result.Destroy(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c, err = readCatalog(filepath.Join(catalogDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Versions[0].Providers) != 2 {
+		t.Fatalf("bad catalog: %#v", c.Versions[0].Providers)
+	}
+	if _, err := os.Stat(result.Files()[0]); err != nil {
+		t.Fatalf("the box should remain: %s", err)
+	}
+}
+
+func TestPostProcessorPostProcess_keepVersions(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-vagrant-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	catalogDir := filepath.Join(td, "catalog")
+
+	for _, v := range []string{"1.2.0", "1.10.0", "1.9.0"} {
+		raw := testConfig(catalogDir, v)
+		raw["keep_versions"] = 2
+		if _, err := testPostProcess(t, raw, testBox(t, td, v)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	c, err := readCatalog(filepath.Join(catalogDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Versions) != 2 || c.Versions[0].Version != "1.9.0" || c.Versions[1].Version != "1.10.0" {
+		t.Fatalf("bad versions: %#v", c.Versions)
+	}
+	if _, err := os.Stat(filepath.Join(catalogDir, "1.2.0")); !os.IsNotExist(err) {
+		t.Fatal("the boxes of the removed version should be deleted")
+	}
+
+	// A version older than the kept ones isn't added
+	raw := testConfig(catalogDir, "1.0.0")
+	raw["keep_versions"] = 2
+	if _, err := testPostProcess(t, raw, testBox(t, td, "old")); err == nil {
+		t.Fatal("expected an error with an old version")
+	}
+	if _, err := os.Stat(filepath.Join(catalogDir, "1.0.0", "virtualbox.box")); !os.IsNotExist(err) {
+		t.Fatal("the box should be removed")
+	}
+}
+
+func TestPostProcessorPostProcess_badArtifact(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-vagrant-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	artifact := testBox(t, td, "box")
+	artifact.BuilderIdValue = "packer.post-processor.compress"
+	if _, err := testPostProcess(t, testConfig(td, "1.0.0"), artifact); err == nil {
+		t.Fatal("expected an error with an unknown artifact")
+	}
+
+	raw := testConfig(td, "1.0.0")
+	raw["box_path"] = "../{{.Provider}}.box"
+	if _, err := testPostProcess(t, raw, testBox(t, td, "box")); err == nil {
+		t.Fatal("expected an error with a box_path out of the catalog")
+	}
+}
+
+func TestPostProcessorPostProcess_failedUpdate(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer-vagrant-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	catalogDir := filepath.Join(td, "catalog")
+
+	if _, err := testPostProcess(t, testConfig(catalogDir, "1.0.0"), testBox(t, td, "box")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The catalog is the one of another box, so it can't be updated
+	raw := testConfig(catalogDir, "1.0.0")
+	raw["box_name"] = "acme/debian"
+	if _, err := testPostProcess(t, raw, testBox(t, td, "other")); err == nil {
+		t.Fatal("expected an error with the catalog of another box")
+	}
+
+	// The published box is left as is
+	box := filepath.Join(catalogDir, "1.0.0", "virtualbox.box")
+	content, err := ioutil.ReadFile(box)
+	if err != nil {
+		t.Fatalf("the published box should remain: %s", err)
+	}
+	if string(content) != "box" {
+		t.Fatalf("the published box should be unchanged: %s", content)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(box))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("the copy should be removed: %d files", len(files))
+	}
+}
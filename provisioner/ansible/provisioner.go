@@ -29,6 +29,7 @@ import (
 	"github.com/hashicorp/packer/common"
 	"github.com/hashicorp/packer/common/adapter"
 	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/communicator"
 	"github.com/hashicorp/packer/helper/config"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/packer/tmp"
@@ -53,6 +54,7 @@ type Config struct {
 	EmptyGroups          []string `mapstructure:"empty_groups"`
 	HostAlias            string   `mapstructure:"host_alias"`
 	User                 string   `mapstructure:"user"`
+	Password             string   `mapstructure:"password"`
 	LocalPort            int      `mapstructure:"local_port"`
 	SSHHostKeyFile       string   `mapstructure:"ssh_host_key_file"`
 	SSHAuthorizedKeyFile string   `mapstructure:"ssh_authorized_key_file"`
@@ -61,6 +63,11 @@ type Config struct {
 	UseSFTP              bool     `mapstructure:"use_sftp"`
 	InventoryDirectory   string   `mapstructure:"inventory_directory"`
 	InventoryFile        string   `mapstructure:"inventory_file"`
+
+	// How Ansible connects to the machine: through the SSH adapter proxying
+	// to the Packer communicator, the default, or directly with the winrm,
+	// psrp, docker or lxd connection plugins.
+	Connection string `mapstructure:"connection"`
 }
 
 type Provisioner struct {
@@ -104,7 +111,22 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		p.config.HostAlias = "default"
 	}
 
+	if p.config.Connection == "" {
+		p.config.Connection = "adapter"
+	}
+
+	if p.config.Password == "" {
+		p.config.Password = "{{.WinRMPassword}}"
+	}
+
 	var errs *packer.MultiError
+	switch p.config.Connection {
+	case "adapter", "winrm", "psrp", "docker", "lxd":
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf(
+			"connection: %q is invalid, must be one of adapter, winrm, psrp, docker or lxd", p.config.Connection))
+	}
+
 	err = validateFileConfig(p.config.PlaybookFile, "playbook_file", true)
 	if err != nil {
 		errs = packer.MultiErrorAppend(errs, err)
@@ -151,16 +173,19 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		}
 	}
 
-	if p.config.User == "" {
-		usr, err := user.Current()
-		if err != nil {
-			errs = packer.MultiErrorAppend(errs, err)
-		} else {
-			p.config.User = usr.Username
+	// The other connections use the user of the builder unless set
+	if p.config.Connection == "adapter" {
+		if p.config.User == "" {
+			usr, err := user.Current()
+			if err != nil {
+				errs = packer.MultiErrorAppend(errs, err)
+			} else {
+				p.config.User = usr.Username
+			}
+		}
+		if p.config.User == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("user: could not determine current user from environment."))
 		}
-	}
-	if p.config.User == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("user: could not determine current user from environment."))
 	}
 
 	if errs != nil && len(errs.Errors) > 0 {
@@ -217,88 +242,99 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		}
 		p.config.ExtraArguments[i] = arg
 	}
-
-	k, err := newUserKey(p.config.SSHAuthorizedKeyFile)
+	// Interpolate the password of the winrm and psrp connections
+	password, err := interpolate.Render(p.config.Password, &p.config.ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not interpolate password: %s", err)
 	}
+	p.config.Password = password
 
-	hostSigner, err := newSigner(p.config.SSHHostKeyFile)
-	// Remove the private key file
-	if len(k.privKeyFile) > 0 {
-		defer os.Remove(k.privKeyFile)
+	ui = &packer.SafeUi{
+		Sem: make(chan int, 1),
+		Ui:  ui,
 	}
 
-	keyChecker := ssh.CertChecker{
-		UserKeyFallback: func(conn ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
-			if user := conn.User(); user != p.config.User {
-				return nil, errors.New(fmt.Sprintf("authentication failed: %s is not a valid user", user))
-			}
-
-			if !bytes.Equal(k.Marshal(), pubKey.Marshal()) {
-				return nil, errors.New("authentication failed: unauthorized key")
-			}
+	var privKeyFile string
+	if p.config.Connection == "adapter" {
+		k, err := newUserKey(p.config.SSHAuthorizedKeyFile)
+		if err != nil {
+			return err
+		}
 
-			return nil, nil
-		},
-	}
+		hostSigner, err := newSigner(p.config.SSHHostKeyFile)
+		// Remove the private key file
+		if len(k.privKeyFile) > 0 {
+			defer os.Remove(k.privKeyFile)
+		}
+		privKeyFile = k.privKeyFile
 
-	config := &ssh.ServerConfig{
-		AuthLogCallback: func(conn ssh.ConnMetadata, method string, err error) {
-			log.Printf("authentication attempt from %s to %s as %s using %s", conn.RemoteAddr(), conn.LocalAddr(), conn.User(), method)
-		},
-		PublicKeyCallback: keyChecker.Authenticate,
-		//NoClientAuth:      true,
-	}
+		keyChecker := ssh.CertChecker{
+			UserKeyFallback: func(conn ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+				if user := conn.User(); user != p.config.User {
+					return nil, errors.New(fmt.Sprintf("authentication failed: %s is not a valid user", user))
+				}
 
-	config.AddHostKey(hostSigner)
+				if !bytes.Equal(k.Marshal(), pubKey.Marshal()) {
+					return nil, errors.New("authentication failed: unauthorized key")
+				}
 
-	localListener, err := func() (net.Listener, error) {
+				return nil, nil
+			},
+		}
 
-		port := p.config.LocalPort
-		tries := 1
-		if port != 0 {
-			tries = 10
+		config := &ssh.ServerConfig{
+			AuthLogCallback: func(conn ssh.ConnMetadata, method string, err error) {
+				log.Printf("authentication attempt from %s to %s as %s using %s", conn.RemoteAddr(), conn.LocalAddr(), conn.User(), method)
+			},
+			PublicKeyCallback: keyChecker.Authenticate,
+			//NoClientAuth:      true,
 		}
-		for i := 0; i < tries; i++ {
-			l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
-			port++
-			if err != nil {
-				ui.Say(err.Error())
-				continue
-			}
-			_, portStr, err := net.SplitHostPort(l.Addr().String())
-			if err != nil {
-				ui.Say(err.Error())
-				continue
+
+		config.AddHostKey(hostSigner)
+
+		localListener, err := func() (net.Listener, error) {
+
+			port := p.config.LocalPort
+			tries := 1
+			if port != 0 {
+				tries = 10
 			}
-			p.config.LocalPort, err = strconv.Atoi(portStr)
-			if err != nil {
-				ui.Say(err.Error())
-				continue
+			for i := 0; i < tries; i++ {
+				l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				port++
+				if err != nil {
+					ui.Say(err.Error())
+					continue
+				}
+				_, portStr, err := net.SplitHostPort(l.Addr().String())
+				if err != nil {
+					ui.Say(err.Error())
+					continue
+				}
+				p.config.LocalPort, err = strconv.Atoi(portStr)
+				if err != nil {
+					ui.Say(err.Error())
+					continue
+				}
+				return l, nil
 			}
-			return l, nil
-		}
-		return nil, errors.New("Error setting up SSH proxy connection")
-	}()
+			return nil, errors.New("Error setting up SSH proxy connection")
+		}()
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
 
-	ui = &packer.SafeUi{
-		Sem: make(chan int, 1),
-		Ui:  ui,
-	}
-	p.adapter = adapter.NewAdapter(p.done, localListener, config, p.config.SFTPCmd, ui, comm)
+		p.adapter = adapter.NewAdapter(p.done, localListener, config, p.config.SFTPCmd, ui, comm)
 
-	defer func() {
-		log.Print("shutting down the SSH proxy")
-		close(p.done)
-		p.adapter.Shutdown()
-	}()
+		defer func() {
+			log.Print("shutting down the SSH proxy")
+			close(p.done)
+			p.adapter.Shutdown()
+		}()
 
-	go p.adapter.Serve()
+		go p.adapter.Serve()
+	}
 
 	if len(p.config.InventoryFile) == 0 {
 		tf, err := ioutil.TempFile(p.config.InventoryDirectory, "packer-provisioner-ansible")
@@ -307,11 +343,10 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		}
 		defer os.Remove(tf.Name())
 
-		host := fmt.Sprintf("%s ansible_host=127.0.0.1 ansible_user=%s ansible_port=%d\n",
-			p.config.HostAlias, p.config.User, p.config.LocalPort)
-		if p.ansibleMajVersion < 2 {
-			host = fmt.Sprintf("%s ansible_ssh_host=127.0.0.1 ansible_ssh_user=%s ansible_ssh_port=%d\n",
-				p.config.HostAlias, p.config.User, p.config.LocalPort)
+		host, err := p.inventoryHost()
+		if err != nil {
+			tf.Close()
+			return err
 		}
 
 		w := bufio.NewWriter(tf)
@@ -335,13 +370,109 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		}()
 	}
 
-	if err := p.executeAnsible(ui, comm, k.privKeyFile); err != nil {
+	if err := p.executeAnsible(ui, comm, privKeyFile); err != nil {
 		return fmt.Errorf("Error executing Ansible: %s", err)
 	}
 
 	return nil
 }
 
+// inventoryHost returns the line of the inventory describing the machine
+// being built, for the configured connection.
+func (p *Provisioner) inventoryHost() (string, error) {
+	var vars []string
+	switch p.config.Connection {
+	case "adapter":
+		if p.ansibleMajVersion < 2 {
+			return fmt.Sprintf("%s ansible_ssh_host=127.0.0.1 ansible_ssh_user=%s ansible_ssh_port=%d\n",
+				p.config.HostAlias, p.config.User, p.config.LocalPort), nil
+		}
+		return fmt.Sprintf("%s ansible_host=127.0.0.1 ansible_user=%s ansible_port=%d\n",
+			p.config.HostAlias, p.config.User, p.config.LocalPort), nil
+
+	case "winrm", "psrp":
+		endpoint, err := communicator.RetrieveWinRMEndpoint(p.config.PackerBuildName)
+		if err != nil {
+			return "", fmt.Errorf("The %s connection requires the WinRM communicator: %s", p.config.Connection, err)
+		}
+
+		user := endpoint.User
+		if p.config.User != "" {
+			user = p.config.User
+		}
+		vars = append(vars,
+			"ansible_connection="+p.config.Connection,
+			"ansible_host="+inventoryQuote(endpoint.Host),
+			fmt.Sprintf("ansible_port=%d", endpoint.Port),
+			"ansible_user="+inventoryQuote(user))
+		if p.config.Password != "" {
+			packer.LogSecretFilter.Set(p.config.Password)
+			vars = append(vars, "ansible_password="+inventoryQuote(p.config.Password))
+		}
+
+		auth := "basic"
+		if endpoint.UseNTLM {
+			auth = "ntlm"
+		} else if endpoint.UseKerberos {
+			auth = "kerberos"
+		}
+		scheme := "http"
+		if endpoint.UseSSL {
+			scheme = "https"
+		}
+
+		if p.config.Connection == "winrm" {
+			vars = append(vars,
+				"ansible_winrm_transport="+auth,
+				"ansible_winrm_scheme="+scheme)
+			if endpoint.Insecure {
+				vars = append(vars, "ansible_winrm_server_cert_validation=ignore")
+			}
+			if endpoint.CACertFile != "" {
+				vars = append(vars, "ansible_winrm_ca_trust_path="+inventoryQuote(endpoint.CACertFile))
+			}
+		} else {
+			vars = append(vars,
+				"ansible_psrp_auth="+auth,
+				"ansible_psrp_protocol="+scheme)
+			if endpoint.Insecure {
+				vars = append(vars, "ansible_psrp_cert_validation=ignore")
+			}
+			if endpoint.CACertFile != "" {
+				vars = append(vars, "ansible_psrp_ca_cert="+inventoryQuote(endpoint.CACertFile))
+			}
+		}
+
+	case "docker", "lxd":
+		key := "container_id"
+		if p.config.Connection == "lxd" {
+			key = "container_name"
+		}
+		container, err := commonhelper.RetrieveSharedState(key, p.config.PackerBuildName)
+		if err != nil {
+			return "", fmt.Errorf("The %s connection requires the %s builder: %s", p.config.Connection, p.config.Connection, err)
+		}
+
+		vars = append(vars,
+			"ansible_connection="+p.config.Connection,
+			"ansible_host="+inventoryQuote(container))
+		if p.config.User != "" {
+			vars = append(vars, "ansible_user="+inventoryQuote(p.config.User))
+		}
+	}
+
+	return fmt.Sprintf("%s %s\n", p.config.HostAlias, strings.Join(vars, " ")), nil
+}
+
+// inventoryQuote quotes a value of the INI inventory when it contains
+// characters Ansible would otherwise split or interpret.
+func inventoryQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\"'\\#;=") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
 func (p *Provisioner) Cancel() {
 	if p.done != nil {
 		close(p.done)
@@ -14,6 +14,8 @@ import (
 	"strings"
 	"testing"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/communicator"
 	"github.com/hashicorp/packer/packer"
 )
 
@@ -305,6 +307,118 @@ func TestProvisionerPrepare_InventoryDirectory(t *testing.T) {
 	}
 }
 
+func TestProvisionerPrepare_Connection(t *testing.T) {
+	var p Provisioner
+	config := testConfig(t)
+	defer os.Remove(config["command"].(string))
+
+	playbook_file, err := ioutil.TempFile("", "playbook")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(playbook_file.Name())
+	config["playbook_file"] = playbook_file.Name()
+
+	err = p.Prepare(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.Connection != "adapter" {
+		t.Fatalf("bad default connection: %s", p.config.Connection)
+	}
+
+	config["connection"] = "ssh"
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	config["connection"] = "winrm"
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.User != "" {
+		t.Fatalf("should use the user of the communicator: %s", p.config.User)
+	}
+}
+
+func TestProvisioner_inventoryHost(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-ansible-inventory")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+
+	err := communicator.SetWinRMEndpoint("windows", &communicator.WinRMEndpoint{
+		Host:     "10.0.0.5",
+		Port:     5986,
+		User:     "Administrator",
+		UseSSL:   true,
+		Insecure: true,
+		UseNTLM:  true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer communicator.RemoveWinRMEndpoint("windows")
+
+	if err := commonhelper.SetSharedState("container_id", "abc123", "docker"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer commonhelper.RemoveSharedStateFile("container_id", "docker")
+
+	cases := []struct {
+		Connection string
+		BuildName  string
+		User       string
+		Password   string
+		Expected   string
+	}{
+		{
+			"adapter", "linux", "packer", "",
+			"default ansible_host=127.0.0.1 ansible_user=packer ansible_port=2222\n",
+		},
+		{
+			"winrm", "windows", "", `p@ss "word"`,
+			`default ansible_connection=winrm ansible_host=10.0.0.5 ansible_port=5986 ansible_user=Administrator ansible_password="p@ss \"word\"" ansible_winrm_transport=ntlm ansible_winrm_scheme=https ansible_winrm_server_cert_validation=ignore` + "\n",
+		},
+		{
+			"psrp", "windows", "", "",
+			`default ansible_connection=psrp ansible_host=10.0.0.5 ansible_port=5986 ansible_user=Administrator ansible_psrp_auth=ntlm ansible_psrp_protocol=https ansible_psrp_cert_validation=ignore` + "\n",
+		},
+		{
+			"docker", "docker", "", "",
+			"default ansible_connection=docker ansible_host=abc123\n",
+		},
+	}
+
+	for _, tc := range cases {
+		p := &Provisioner{ansibleMajVersion: 2}
+		p.config.Connection = tc.Connection
+		p.config.HostAlias = "default"
+		p.config.PackerBuildName = tc.BuildName
+		p.config.User = tc.User
+		p.config.Password = tc.Password
+		p.config.LocalPort = 2222
+
+		host, err := p.inventoryHost()
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Connection, err)
+		}
+		if host != tc.Expected {
+			t.Fatalf("%s: bad inventory:\n%s\nexpected:\n%s", tc.Connection, host, tc.Expected)
+		}
+	}
+
+	// Without the matching builder
+	p := &Provisioner{}
+	p.config.Connection = "lxd"
+	p.config.PackerBuildName = "docker"
+	if _, err := p.inventoryHost(); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestAnsibleGetVersion(t *testing.T) {
 	if os.Getenv("PACKER_ACC") == "" {
 		t.Skip("This test is only run with PACKER_ACC=1 and it requires Ansible to be installed")
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/hashicorp/packer/common"
 	"github.com/hashicorp/packer/helper/config"
 	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
 	"github.com/hashicorp/packer/template/interpolate"
 )
 
@@ -19,6 +21,14 @@ type Config struct {
 	Note    string `mapstructure:"note"`
 	Disable bool   `mapstructure:"disable"`
 
+	// Whether to offer a shell on the guest, ad-hoc commands and file
+	// downloads while paused.
+	Interactive bool `mapstructure:"interactive"`
+
+	// The guest OS, unix or windows. Windows guests get a command loop
+	// instead of a terminal.
+	GuestOSType string `mapstructure:"guest_os_type"`
+
 	ctx interpolate.Context
 }
 
@@ -38,6 +48,15 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		return err
 	}
 
+	if p.config.GuestOSType == "" {
+		p.config.GuestOSType = provisioner.DefaultOSType
+	}
+	p.config.GuestOSType = strings.ToLower(p.config.GuestOSType)
+
+	if p.config.GuestOSType != provisioner.UnixOSType && p.config.GuestOSType != provisioner.WindowsOSType {
+		return fmt.Errorf("Invalid guest_os_type: \"%s\"", p.config.GuestOSType)
+	}
+
 	return nil
 }
 
@@ -59,6 +78,10 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		ui.Say("Pausing at breakpoint provisioner.")
 	}
 
+	if p.config.Interactive {
+		return p.interact(ctx, ui, comm)
+	}
+
 	message := fmt.Sprintf(
 		"Press enter to continue.")
 
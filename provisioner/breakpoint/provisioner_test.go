@@ -0,0 +1,125 @@
+package breakpoint
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/masterzen/winrm"
+)
+
+// testTTY returns the lines of input one by one.
+type testTTY struct {
+	lines []string
+}
+
+func (t *testTTY) ReadString() (string, error) {
+	if len(t.lines) == 0 {
+		return "", nil
+	}
+	line := t.lines[0]
+	t.lines = t.lines[1:]
+	return line + "\n", nil
+}
+
+func (t *testTTY) Close() error { return nil }
+
+func testUi(lines ...string) (*packer.BasicUi, *bytes.Buffer) {
+	var out bytes.Buffer
+	return &packer.BasicUi{
+		Writer:      &out,
+		ErrorWriter: &out,
+		TTY:         &testTTY{lines: lines},
+	}, &out
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packer.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_GuestOSType(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.GuestOSType != "unix" {
+		t.Fatalf("unexpected guest_os_type: %s", p.config.GuestOSType)
+	}
+
+	p = Provisioner{}
+	if err := p.Prepare(map[string]interface{}{"guest_os_type": "beos"}); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_Interactive(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	local := filepath.Join(td, "messages")
+
+	var p Provisioner
+	if err := p.Prepare(map[string]interface{}{"interactive": true}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, out := testUi(
+		"help",
+		"run systemctl status nginx",
+		"download /var/log/messages "+local,
+		"reboot",
+		"",
+	)
+	comm := &packer.MockCommunicator{DownloadData: "kernel: hello"}
+	if err := p.Provision(context.Background(), ui, comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if comm.StartCmd.Command != "systemctl status nginx" {
+		t.Fatalf("unexpected command: %s", comm.StartCmd.Command)
+	}
+	data, err := ioutil.ReadFile(local)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "kernel: hello" {
+		t.Fatalf("unexpected download: %s", data)
+	}
+	for _, expected := range []string{"Available commands:", `Unknown command "reboot"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("output should contain %q:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestProvisionerProvision_WindowsShell(t *testing.T) {
+	var p Provisioner
+	config := map[string]interface{}{
+		"interactive":   true,
+		"guest_os_type": "windows",
+	}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, _ := testUi("shell", "Get-Service WinRM", "exit", "")
+	comm := &packer.MockCommunicator{}
+	if err := p.Provision(context.Background(), ui, comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if comm.StartCmd.Command != winrm.Powershell("Get-Service WinRM") {
+		t.Fatalf("unexpected command: %s", comm.StartCmd.Command)
+	}
+}
@@ -0,0 +1,210 @@
+package breakpoint
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
+	"github.com/masterzen/winrm"
+)
+
+const interactiveHelp = `Available commands:
+  shell                      Open a shell on the guest, exit it to come back
+  run <command>              Run a command on the guest
+  download <remote> <local>  Download a file from the guest
+  help                       Show this help
+Press enter to continue the build.`
+
+// interact runs the commands typed by the user until an empty line is
+// entered.
+func (p *Provisioner) interact(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	for {
+		line, err := ui.Ask("Press enter to continue, or type a command (help for the list):")
+		if err != nil {
+			return fmt.Errorf("Error asking for input: %s", err)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil
+		}
+
+		switch fields[0] {
+		case "help":
+			ui.Message(interactiveHelp)
+		case "shell":
+			if err := p.shell(ctx, ui, comm); err != nil {
+				ui.Error(err.Error())
+			}
+		case "run":
+			command := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "run"))
+			if command == "" {
+				ui.Error("Usage: run <command>")
+				continue
+			}
+			p.run(ctx, ui, comm, command)
+		case "download":
+			if len(fields) != 3 {
+				ui.Error("Usage: download <remote> <local>")
+				continue
+			}
+			if err := download(comm, fields[1], fields[2]); err != nil {
+				ui.Error(err.Error())
+				continue
+			}
+			ui.Message(fmt.Sprintf("Downloaded %s to %s", fields[1], fields[2]))
+		default:
+			ui.Error(fmt.Sprintf("Unknown command %q, type help for the list", fields[0]))
+		}
+	}
+}
+
+// shell opens an interactive shell on the guest in the local terminal, or
+// falls back to a command loop when that is not possible.
+func (p *Provisioner) shell(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if p.config.GuestOSType == provisioner.WindowsOSType {
+		return p.commandLoop(ctx, ui, comm)
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		ui.Error(fmt.Sprintf("No terminal available, falling back to a command loop: %s", err))
+		return p.commandLoop(ctx, ui, comm)
+	}
+
+	err = p.terminalShell(ctx, ui, comm, term)
+	term.Close()
+	if err != nil {
+		// Not all communicators support pseudo terminals
+		ui.Error(fmt.Sprintf("Unable to open a shell on the guest, falling back to a command loop: %s", err))
+		return p.commandLoop(ctx, ui, comm)
+	}
+	return nil
+}
+
+// terminalShell runs a login shell on the guest in a pseudo terminal,
+// attached to the local terminal until the shell exits.
+func (p *Provisioner) terminalShell(ctx context.Context, ui packer.Ui, comm packer.Communicator, term *terminalFiles) error {
+	width, height, err := common.GetTerminalDimensions()
+	if err != nil {
+		log.Printf("Error getting the terminal size, using 80x24: %s", err)
+		width, height = 80, 24
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm"
+	}
+
+	ui.Say("Opening a shell on the guest, exit it to come back to the breakpoint...")
+
+	fd := int(term.ctl.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("Error setting up the terminal: %s", err)
+	}
+	defer terminal.Restore(fd, state)
+
+	cmd := &packer.RemoteCmd{
+		Command: `exec "${SHELL:-/bin/sh}" -l`,
+		Stdin:   term.in,
+		Stdout:  term.out,
+		Stderr:  term.out,
+		Pty: &packer.PtyConfig{
+			Term:   termType,
+			Width:  width,
+			Height: height,
+		},
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+	status := cmd.Wait()
+	log.Printf("Shell on the guest exited with status %d", status)
+
+	return nil
+}
+
+// commandLoop runs the commands typed by the user one by one, for
+// communicators without terminals.
+func (p *Provisioner) commandLoop(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	prompt := "$"
+	if p.config.GuestOSType == provisioner.WindowsOSType {
+		prompt = "PS>"
+	}
+
+	ui.Say("Running commands on the guest, type exit to come back to the breakpoint...")
+	for {
+		line, err := ui.Ask(prompt)
+		if err != nil {
+			return fmt.Errorf("Error asking for input: %s", err)
+		}
+
+		command := strings.TrimSpace(line)
+		switch command {
+		case "":
+			continue
+		case "exit":
+			return nil
+		}
+		p.run(ctx, ui, comm, command)
+	}
+}
+
+// run runs a command on the guest, showing its output.
+func (p *Provisioner) run(ctx context.Context, ui packer.Ui, comm packer.Communicator, command string) {
+	if p.config.GuestOSType == provisioner.WindowsOSType {
+		command = winrm.Powershell(command)
+	}
+
+	cmd := &packer.RemoteCmd{Command: command}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		ui.Error(fmt.Sprintf("Error running command: %s", err))
+		return
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		ui.Error(fmt.Sprintf("Command exited with status %d", status))
+	}
+}
+
+func download(comm packer.Communicator, src string, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("Error creating %s: %s", dst, err)
+	}
+	defer f.Close()
+
+	if err := comm.Download(src, f); err != nil {
+		return fmt.Errorf("Error downloading %s: %s", src, err)
+	}
+	return nil
+}
+
+// openTerminal opens the local terminal, the tests replace it.
+var openTerminal = openTTY
+
+// terminalFiles are the input and output of the local terminal. The mode
+// of the terminal is set through ctl, because calling Fd on in would keep
+// Close from interrupting a pending read.
+type terminalFiles struct {
+	in  *os.File
+	out *os.File
+	ctl *os.File
+}
+
+func (t *terminalFiles) Close() error {
+	// Closing the input also stops the copy of the input to the guest
+	err := t.in.Close()
+	for _, f := range []*os.File{t.out, t.ctl} {
+		if f != t.in {
+			f.Close()
+		}
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package breakpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"golang.org/x/sys/unix"
+)
+
+// testPTY opens a pseudo terminal pair, standing for the local terminal.
+func testPTY(t *testing.T) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal available: %s", err)
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		t.Skipf("unable to unlock the pseudo terminal: %s", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		t.Skipf("unable to get the pseudo terminal: %s", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("unable to open the pseudo terminal: %s", err)
+	}
+	return master, slave
+}
+
+// noPtyCommunicator rejects pseudo terminals, as the guest agent does.
+type noPtyCommunicator struct {
+	packer.MockCommunicator
+}
+
+func (c *noPtyCommunicator) Start(ctx context.Context, rc *packer.RemoteCmd) error {
+	if rc.Pty != nil {
+		return errors.New("pseudo terminals are not supported")
+	}
+	return c.MockCommunicator.Start(ctx, rc)
+}
+
+func TestProvisionerShell_noPty(t *testing.T) {
+	master, slave := testPTY(t)
+	defer master.Close()
+
+	defer func(open func() (*terminalFiles, error)) { openTerminal = open }(openTerminal)
+	openTerminal = func() (*terminalFiles, error) {
+		return &terminalFiles{in: slave, out: slave, ctl: slave}, nil
+	}
+
+	var p Provisioner
+	if err := p.Prepare(map[string]interface{}{"interactive": true}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, out := testUi("uname -r", "exit")
+	comm := &noPtyCommunicator{}
+	if err := p.shell(context.Background(), ui, comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(out.String(), "falling back to a command loop") {
+		t.Fatalf("should fall back to a command loop:\n%s", out.String())
+	}
+	if comm.StartCmd == nil || comm.StartCmd.Command != "uname -r" {
+		t.Fatalf("the command should run on the guest: %#v", comm.StartCmd)
+	}
+}
@@ -0,0 +1,20 @@
+// +build !windows
+
+package breakpoint
+
+import "os"
+
+// openTTY opens the terminal packer is running in. Plugins cannot use
+// their standard input and output, which are not attached to it.
+func openTTY() (*terminalFiles, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	ctl, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+	return &terminalFiles{in: tty, out: tty, ctl: ctl}, nil
+}
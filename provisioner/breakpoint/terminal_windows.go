@@ -0,0 +1,20 @@
+// +build windows
+
+package breakpoint
+
+import "os"
+
+// openTTY opens the console packer is running in. Plugins cannot use
+// their standard input and output, which are not attached to it.
+func openTTY() (*terminalFiles, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return &terminalFiles{in: in, out: out, ctl: in}, nil
+}
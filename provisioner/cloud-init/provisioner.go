@@ -0,0 +1,336 @@
+// This package implements a provisioner for Packer that waits for
+// cloud-init to finish configuring the machine.
+package cloudinit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+const (
+	statusCommand       = "cloud-init status --long"
+	bootFinishedCommand = "test -f /var/lib/cloud/instance/boot-finished"
+	installedCommand    = "test -d /var/lib/cloud"
+	resultCommand       = "cat /var/lib/cloud/data/result.json"
+	cleanCommand        = "cloud-init clean --logs"
+	outputLogPath       = "/var/log/cloud-init-output.log"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// How long to wait for cloud-init to finish. Defaults to 15 minutes.
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"`
+
+	// How long to wait between two checks. Defaults to 5 seconds.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+
+	// Whether to reset cloud-init once it finished, so that it runs again
+	// on the machines created from the image.
+	Clean bool `mapstructure:"clean"`
+
+	// The number of lines of the cloud-init output log shown on failure.
+	LogLines int `mapstructure:"log_lines"`
+
+	// Whether to run the privileged commands without sudo.
+	DisableSudo bool `mapstructure:"disable_sudo"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+var errNotInstalled = errors.New("cloud-init does not seem to be installed")
+
+// status is the state of cloud-init on the machine.
+type status struct {
+	// State is one of "not run", "running", "done", "error" or "disabled".
+	State string
+
+	// Errors lists the errors cloud-init reported, if any.
+	Errors []string
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.WaitTimeout == 0 {
+		p.config.WaitTimeout = 15 * time.Minute
+	}
+
+	if p.config.PollInterval == 0 {
+		p.config.PollInterval = 5 * time.Second
+	}
+
+	if p.config.LogLines == 0 {
+		p.config.LogLines = 50
+	}
+
+	var errs *packer.MultiError
+	if p.config.WaitTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("wait_timeout must be positive"))
+	}
+	if p.config.PollInterval < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("poll_interval must be positive"))
+	}
+	if p.config.LogLines < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("log_lines must be positive"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Waiting up to %s for cloud-init to finish...", p.config.WaitTimeout))
+
+	s, err := p.wait(ctx, comm)
+	if err != nil {
+		return err
+	}
+
+	switch s.State {
+	case "disabled":
+		ui.Say("cloud-init is disabled, nothing to wait for")
+		return nil
+	case "error":
+		ui.Error("cloud-init failed:")
+		for _, e := range s.Errors {
+			ui.Error(fmt.Sprintf("  %s", e))
+		}
+		if p.config.LogLines > 0 {
+			logs, err := p.output(ctx, comm, p.sudo(fmt.Sprintf("tail -n %d %s", p.config.LogLines, outputLogPath)))
+			if err != nil {
+				log.Printf("Error reading %s: %s", outputLogPath, err)
+			} else if logs != "" {
+				ui.Error(fmt.Sprintf("Last lines of %s:\n%s", outputLogPath, logs))
+			}
+		}
+		return errors.New("cloud-init finished with errors")
+	}
+
+	ui.Say("cloud-init finished")
+
+	if p.config.Clean {
+		ui.Say("Cleaning the cloud-init state...")
+		if err := p.clean(ctx, comm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Cancel() {}
+
+// wait polls the status of cloud-init until it is no longer running.
+func (p *Provisioner) wait(ctx context.Context, comm packer.Communicator) (*status, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.WaitTimeout)
+	defer cancel()
+
+	last := "unknown"
+	for {
+		s, err := p.status(ctx, comm)
+		if err == errNotInstalled {
+			return nil, err
+		}
+		if err != nil {
+			// The machine may be rebooting, as asked by the cloud-config
+			log.Printf("Error checking the cloud-init status: %s", err)
+		} else {
+			log.Printf("cloud-init status: %s", s.State)
+			switch s.State {
+			case "done", "error", "disabled":
+				return s, nil
+			}
+			last = s.State
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("Timeout waiting for cloud-init, last status: %s", last)
+			}
+			return nil, ctx.Err()
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+}
+
+// status asks cloud-init for its status, or falls back to its marker files
+// on versions without the status command.
+func (p *Provisioner) status(ctx context.Context, comm packer.Communicator) (*status, error) {
+	exitStatus, stdout, err := p.run(ctx, comm, statusCommand)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := parseStatus(stdout); ok {
+		// Older versions only tell about the errors in result.json
+		if s.State == "error" && len(s.Errors) == 0 {
+			_, result, err := p.run(ctx, comm, resultCommand)
+			if err != nil {
+				return nil, err
+			}
+			s.Errors = parseResult(result)
+		}
+		return s, nil
+	}
+	log.Printf("cloud-init status exited with %d, checking the marker files", exitStatus)
+
+	exitStatus, _, err = p.run(ctx, comm, bootFinishedCommand)
+	if err != nil {
+		return nil, err
+	}
+	if exitStatus == 0 {
+		s := &status{State: "done"}
+		_, result, err := p.run(ctx, comm, resultCommand)
+		if err != nil {
+			return nil, err
+		}
+		if errs := parseResult(result); len(errs) > 0 {
+			s.State = "error"
+			s.Errors = errs
+		}
+		return s, nil
+	}
+
+	exitStatus, _, err = p.run(ctx, comm, installedCommand)
+	if err != nil {
+		return nil, err
+	}
+	if exitStatus != 0 {
+		return nil, errNotInstalled
+	}
+	return &status{State: "running"}, nil
+}
+
+// parseStatus reads the output of `cloud-init status --long`.
+func parseStatus(output string) (*status, bool) {
+	var s *status
+	inErrors := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "status:") {
+			s = &status{State: strings.TrimSpace(strings.TrimPrefix(line, "status:"))}
+			continue
+		}
+		if strings.HasPrefix(line, "errors:") {
+			inErrors = true
+			continue
+		}
+		if strings.HasPrefix(line, "detail:") {
+			inErrors = false
+			continue
+		}
+		if inErrors && strings.HasPrefix(trimmed, "- ") {
+			if s != nil {
+				s.Errors = append(s.Errors, strings.TrimPrefix(trimmed, "- "))
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inErrors = false
+		}
+	}
+
+	if s == nil {
+		return nil, false
+	}
+	if s.State == "not started" {
+		s.State = "not run"
+	}
+	return s, true
+}
+
+// parseResult returns the errors recorded in result.json.
+func parseResult(output string) []string {
+	var result struct {
+		V1 struct {
+			Errors []string `json:"errors"`
+		} `json:"v1"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil
+	}
+	return result.V1.Errors
+}
+
+// clean resets cloud-init, with `cloud-init clean` when available.
+func (p *Provisioner) clean(ctx context.Context, comm packer.Communicator) error {
+	exitStatus, _, err := p.run(ctx, comm, p.sudo(cleanCommand))
+	if err != nil {
+		return err
+	}
+	if exitStatus == 0 {
+		return nil
+	}
+
+	log.Printf("cloud-init clean exited with %d, removing the state manually", exitStatus)
+	exitStatus, _, err = p.run(ctx, comm, p.sudo("rm -rf /var/lib/cloud/instance /var/lib/cloud/instances /var/lib/cloud/data /var/log/cloud-init.log "+outputLogPath))
+	if err != nil {
+		return err
+	}
+	if exitStatus != 0 {
+		return fmt.Errorf("Error cleaning the cloud-init state, exit status %d", exitStatus)
+	}
+	return nil
+}
+
+func (p *Provisioner) sudo(command string) string {
+	if p.config.DisableSudo {
+		return command
+	}
+	return "sudo " + command
+}
+
+func (p *Provisioner) output(ctx context.Context, comm packer.Communicator, command string) (string, error) {
+	exitStatus, stdout, err := p.run(ctx, comm, command)
+	if err != nil {
+		return "", err
+	}
+	if exitStatus != 0 {
+		return "", fmt.Errorf("'%s' exited with status %d", command, exitStatus)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+func (p *Provisioner) run(ctx context.Context, comm packer.Communicator, command string) (int, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, "", err
+	}
+	exitStatus := cmd.Wait()
+	if exitStatus == packer.CmdDisconnect {
+		return 0, "", fmt.Errorf("disconnected while running '%s'", command)
+	}
+	return exitStatus, stdout.String(), nil
+}
@@ -0,0 +1,249 @@
+package cloudinit
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// testCommunicator answers commands from a fixed table.
+type testCommunicator struct {
+	packer.MockCommunicator
+	results map[string]testResult
+	ran     []string
+}
+
+type testResult struct {
+	status int
+	stdout string
+}
+
+func (c *testCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	c.ran = append(c.ran, cmd.Command)
+	r, ok := c.results[cmd.Command]
+	if !ok {
+		r = testResult{status: 1}
+	}
+	cmd.Stdout.Write([]byte(r.stdout))
+	cmd.SetExited(r.status)
+	return nil
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packer.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.WaitTimeout != 15*time.Minute {
+		t.Errorf("unexpected wait_timeout: %s", p.config.WaitTimeout)
+	}
+	if p.config.PollInterval != 5*time.Second {
+		t.Errorf("unexpected poll_interval: %s", p.config.PollInterval)
+	}
+	if p.config.LogLines != 50 {
+		t.Errorf("unexpected log_lines: %d", p.config.LogLines)
+	}
+}
+
+func TestProvisionerPrepare_Invalid(t *testing.T) {
+	for _, key := range []string{"wait_timeout", "poll_interval"} {
+		config := testConfig()
+		config[key] = "-1s"
+
+		var p Provisioner
+		if err := p.Prepare(config); err == nil {
+			t.Fatalf("%s: should have error", key)
+		}
+	}
+
+	config := testConfig()
+	config["log_lines"] = -1
+	var p Provisioner
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("log_lines: should have error")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	cases := []struct {
+		Output   string
+		Expected *status
+	}{
+		{
+			"status: done\ntime: Mon, 19 Oct 2026 10:00:00 +0000\ndetail:\nDataSourceEc2Local\n",
+			&status{State: "done"},
+		},
+		{
+			"status: running\n",
+			&status{State: "running"},
+		},
+		{
+			"status: not started\n",
+			&status{State: "not run"},
+		},
+		{
+			"status: error\nextended_status: error - done\ndetail:\nDataSourceNoCloud\nerrors:\n\t- ('scripts_user', RuntimeError('Runparts: 1 failures'))\nrecoverable_errors: {}\n",
+			&status{State: "error", Errors: []string{"('scripts_user', RuntimeError('Runparts: 1 failures'))"}},
+		},
+	}
+
+	for _, tc := range cases {
+		s, ok := parseStatus(tc.Output)
+		if !ok {
+			t.Fatalf("%q: should parse", tc.Output)
+		}
+		if !reflect.DeepEqual(s, tc.Expected) {
+			t.Fatalf("%q: unexpected status: %#v", tc.Output, s)
+		}
+	}
+
+	if _, ok := parseStatus("usage: cloud-init [-h] [--version]\n"); ok {
+		t.Fatal("usage should not parse")
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	errs := parseResult(`{"v1": {"datasource": "DataSourceNoCloud", "errors": ["failed to run scripts"]}}`)
+	if !reflect.DeepEqual(errs, []string{"failed to run scripts"}) {
+		t.Fatalf("unexpected errors: %#v", errs)
+	}
+
+	if errs := parseResult(`{"v1": {"errors": []}}`); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %#v", errs)
+	}
+	if errs := parseResult(""); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %#v", errs)
+	}
+}
+
+func TestProvisionerProvision_Done(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string]testResult{
+			statusCommand: {0, "status: done\n"},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(comm.ran, []string{statusCommand}) {
+		t.Fatalf("unexpected commands: %#v", comm.ran)
+	}
+}
+
+func TestProvisionerProvision_Error(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tail := "sudo tail -n 50 " + outputLogPath
+	comm := &testCommunicator{
+		results: map[string]testResult{
+			statusCommand: {1, "status: error\n"},
+			resultCommand: {0, `{"v1": {"errors": ["failed to run scripts"]}}`},
+			tail:          {0, "Failed to run module scripts-user\n"},
+		},
+	}
+	err := p.Provision(context.Background(), packer.TestUi(t), comm)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if !reflect.DeepEqual(comm.ran, []string{statusCommand, resultCommand, tail}) {
+		t.Fatalf("unexpected commands: %#v", comm.ran)
+	}
+}
+
+func TestProvisionerProvision_BootFinished(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string]testResult{
+			bootFinishedCommand: {0, ""},
+			resultCommand:       {0, `{"v1": {"errors": []}}`},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestProvisionerProvision_NotInstalled(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != errNotInstalled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProvisionerProvision_Timeout(t *testing.T) {
+	config := testConfig()
+	config["wait_timeout"] = "50ms"
+	config["poll_interval"] = "10ms"
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string]testResult{
+			statusCommand: {0, "status: running\n"},
+		},
+	}
+	err := p.Provision(context.Background(), packer.TestUi(t), comm)
+	if err == nil || !strings.Contains(err.Error(), "last status: running") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProvisionerProvision_Clean(t *testing.T) {
+	config := testConfig()
+	config["clean"] = true
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string]testResult{
+			statusCommand:          {0, "status: done\n"},
+			"sudo " + cleanCommand: {0, ""},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(comm.ran, []string{statusCommand, "sudo " + cleanCommand}) {
+		t.Fatalf("unexpected commands: %#v", comm.ran)
+	}
+}
@@ -5,16 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/transfer"
 	"github.com/hashicorp/packer/helper/config"
 	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
 	"github.com/hashicorp/packer/template/interpolate"
 )
 
+// modeRe matches the octal and symbolic modes accepted by chmod.
+var modeRe = regexp.MustCompile(`^([0-7]{1,4}|[ugoa]*([-+=]([rwxXst]*|[ugo]))+(,[ugoa]*([-+=]([rwxXst]*|[ugo]))+)*)$`)
+
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
@@ -31,6 +38,26 @@ type Config struct {
 	// False if the sources have to exist.
 	Generated bool
 
+	// How directories are uploaded: file by file, as a single archive or
+	// as an archive of the files that changed on the guest.
+	TransferMode string `mapstructure:"transfer_mode"`
+
+	// The guest OS, used to pick the archive format for directory uploads.
+	GuestOSType string `mapstructure:"guest_os_type"`
+
+	// Whether to render the sources as templates before uploading them.
+	Template bool `mapstructure:"template"`
+
+	// Extra variables available to the templates.
+	TemplateVars map[string]string `mapstructure:"template_vars"`
+
+	// The owner and permissions set on the uploaded files.
+	Owner string `mapstructure:"owner"`
+	Mode  string `mapstructure:"mode"`
+
+	// Whether to change the owner and permissions without sudo.
+	DisableSudo bool `mapstructure:"disable_sudo"`
+
 	ctx interpolate.Context
 }
 
@@ -54,12 +81,48 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		p.config.Direction = "upload"
 	}
 
+	if p.config.TransferMode == "" {
+		p.config.TransferMode = transfer.ModeFile
+	}
+
+	if p.config.GuestOSType == "" {
+		p.config.GuestOSType = provisioner.DefaultOSType
+	}
+	p.config.GuestOSType = strings.ToLower(p.config.GuestOSType)
+
 	var errs *packer.MultiError
 
 	if p.config.Direction != "download" && p.config.Direction != "upload" {
 		errs = packer.MultiErrorAppend(errs,
 			errors.New("Direction must be one of: download, upload."))
 	}
+	if err := transfer.ValidMode(p.config.TransferMode); err != nil {
+		errs = packer.MultiErrorAppend(errs, err)
+	}
+	if p.config.GuestOSType != provisioner.UnixOSType && p.config.GuestOSType != provisioner.WindowsOSType {
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("Invalid guest_os_type: \"%s\"", p.config.GuestOSType))
+	}
+	if p.config.Template && p.config.Direction != "upload" {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("template can only be used to upload files."))
+	}
+	if p.config.Owner != "" || p.config.Mode != "" {
+		if p.config.Direction != "upload" {
+			errs = packer.MultiErrorAppend(errs,
+				errors.New("owner and mode can only be used to upload files."))
+		}
+		if p.config.GuestOSType == provisioner.WindowsOSType {
+			errs = packer.MultiErrorAppend(errs,
+				errors.New("owner and mode are not supported on Windows."))
+		}
+	}
+	if p.config.Mode != "" {
+		if !modeRe.MatchString(p.config.Mode) {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("Invalid mode \"%s\", must be an octal number or a symbolic mode", p.config.Mode))
+		}
+	}
 	if p.config.Source != "" {
 		p.config.Sources = append(p.config.Sources, p.config.Source)
 	}
@@ -94,7 +157,7 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 	if p.config.Direction == "download" {
 		return p.ProvisionDownload(ui, comm)
 	} else {
-		return p.ProvisionUpload(ui, comm)
+		return p.ProvisionUpload(ctx, ui, comm)
 	}
 }
 
@@ -139,12 +202,26 @@ func (p *Provisioner) ProvisionDownload(ui packer.Ui, comm packer.Communicator)
 	return nil
 }
 
-func (p *Provisioner) ProvisionUpload(ui packer.Ui, comm packer.Communicator) error {
+func (p *Provisioner) ProvisionUpload(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
 	for _, src := range p.config.Sources {
 		dst := p.config.Destination
 
 		ui.Say(fmt.Sprintf("Uploading %s => %s", src, dst))
 
+		if p.config.Template {
+			tempDir, err := ioutil.TempDir("", "packer-file")
+			if err != nil {
+				return fmt.Errorf("Error creating temporary directory: %s", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			ictx := p.config.ctx
+			ictx.Data = p.config.TemplateVars
+			if src, err = renderSource(src, tempDir, &ictx); err != nil {
+				return err
+			}
+		}
+
 		info, err := os.Stat(src)
 		if err != nil {
 			return err
@@ -152,7 +229,19 @@ func (p *Provisioner) ProvisionUpload(ui packer.Ui, comm packer.Communicator) er
 
 		// If we're uploading a directory, short circuit and do that
 		if info.IsDir() {
-			return comm.UploadDir(p.config.Destination, src, nil)
+			err := transfer.UploadDir(ctx, ui, comm, p.config.Destination, src, nil, &transfer.Config{
+				Mode:        p.config.TransferMode,
+				GuestOSType: p.config.GuestOSType,
+			})
+			if err != nil {
+				return err
+			}
+
+			target := dst
+			if !strings.HasSuffix(src, "/") && !strings.HasSuffix(src, string(filepath.Separator)) {
+				target = strings.TrimRight(dst, "/") + "/" + filepath.Base(src)
+			}
+			return p.setPermissions(ctx, comm, target, true)
 		}
 
 		// We're uploading a file...
@@ -184,6 +273,43 @@ func (p *Provisioner) ProvisionUpload(ui packer.Ui, comm packer.Communicator) er
 			ui.Error(fmt.Sprintf("Upload failed: %s", err))
 			return err
 		}
+
+		if err := p.setPermissions(ctx, comm, dst, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPermissions applies owner and mode to an uploaded file or directory.
+// The mode of a directory is applied to the files in it.
+func (p *Provisioner) setPermissions(ctx context.Context, comm packer.Communicator, target string, dir bool) error {
+	var commands []string
+	if p.config.Owner != "" {
+		commands = append(commands, fmt.Sprintf("chown -R %s %s",
+			transfer.ShellQuote(p.config.Owner), transfer.ShellQuote(target)))
+	}
+	if p.config.Mode != "" {
+		if dir {
+			commands = append(commands, fmt.Sprintf("find %s -type f -exec chmod %s {} +",
+				transfer.ShellQuote(target), transfer.ShellQuote(p.config.Mode)))
+		} else {
+			commands = append(commands, fmt.Sprintf("chmod %s %s",
+				transfer.ShellQuote(p.config.Mode), transfer.ShellQuote(target)))
+		}
+	}
+
+	for _, command := range commands {
+		if !p.config.DisableSudo {
+			command = "sudo " + command
+		}
+		cmd := &packer.RemoteCmd{Command: command}
+		if err := comm.Start(ctx, cmd); err != nil {
+			return err
+		}
+		if status := cmd.Wait(); status != 0 {
+			return fmt.Errorf("'%s' exited with status %d", command, status)
+		}
 	}
 	return nil
 }
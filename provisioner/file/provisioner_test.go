@@ -101,6 +101,78 @@ func TestProvisionerPrepare_EmptyDestination(t *testing.T) {
 	}
 }
 
+func TestProvisionerPrepare_TransferMode(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["source"] = "."
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.TransferMode != "file" {
+		t.Fatalf("bad default transfer mode: %s", p.config.TransferMode)
+	}
+
+	config["transfer_mode"] = "delta"
+	p = Provisioner{}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config["transfer_mode"] = "rsync"
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	config["transfer_mode"] = "archive"
+	config["guest_os_type"] = "plan9"
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_ArchiveDir(t *testing.T) {
+	var p Provisioner
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	if err := ioutil.WriteFile(filepath.Join(td, "hello"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	config := map[string]interface{}{
+		"source":        td,
+		"destination":   "/tmp",
+		"transfer_mode": "archive",
+	}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &packer.BasicUi{
+		Writer: new(bytes.Buffer),
+	}
+	comm := &packer.MockCommunicator{}
+	if err := p.Provision(context.Background(), ui, comm); err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.UploadDirSrc != "" {
+		t.Fatal("should not upload the directory file by file")
+	}
+	if !strings.HasSuffix(comm.UploadPath, ".tar.gz") {
+		t.Fatalf("should upload an archive: %s", comm.UploadPath)
+	}
+	if !strings.Contains(comm.StartCmd.Command, "/tmp/"+filepath.Base(td)) {
+		t.Fatalf("should extract into the destination: %s", comm.StartCmd.Command)
+	}
+}
+
 func TestProvisionerProvision_SendsFile(t *testing.T) {
 	var p Provisioner
 	tf, err := ioutil.TempFile("", "packer")
@@ -208,3 +280,126 @@ func TestProvisionDownloadMkdirAll(t *testing.T) {
 		}
 	}
 }
+
+func TestProvisionerPrepare_Permissions(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	cases := []struct {
+		Config map[string]interface{}
+		Valid  bool
+	}{
+		{map[string]interface{}{"owner": "root:root", "mode": "0640"}, true},
+		{map[string]interface{}{"mode": "u=rw,go=r"}, true},
+		{map[string]interface{}{"mode": "a+X"}, true},
+		{map[string]interface{}{"mode": "rw-r--r--"}, false},
+		{map[string]interface{}{"mode": "0640; reboot"}, false},
+		{map[string]interface{}{"mode": "08"}, false},
+		{map[string]interface{}{"owner": "root", "guest_os_type": "windows"}, false},
+		{map[string]interface{}{"mode": "0640", "direction": "download"}, false},
+		{map[string]interface{}{"template": true, "direction": "download"}, false},
+	}
+
+	for _, tc := range cases {
+		config := testConfig()
+		config["source"] = tf.Name()
+		for k, v := range tc.Config {
+			config[k] = v
+		}
+
+		var p Provisioner
+		err := p.Prepare(config)
+		if tc.Valid && err != nil {
+			t.Fatalf("%#v: err: %s", tc.Config, err)
+		}
+		if !tc.Valid && err == nil {
+			t.Fatalf("%#v: should have error", tc.Config)
+		}
+	}
+}
+
+func TestProvisionerProvision_Template(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "app.conf")
+	contents := `name = "{{ .name }}"
+build = "{{ build_name }}"
+version = "{{ user "version" }}"
+`
+	if err := ioutil.WriteFile(src, []byte(contents), 0600); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	config := map[string]interface{}{
+		"source":            src,
+		"destination":       "/etc/app/",
+		"template":          true,
+		"template_vars":     map[string]string{"name": "web"},
+		"mode":              "0640",
+		"packer_build_name": "vbox",
+		"packer_user_variables": map[string]string{
+			"version": "1.2.3",
+		},
+	}
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packer.MockCommunicator{}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.UploadPath != "/etc/app/app.conf" {
+		t.Fatalf("unexpected upload path: %s", comm.UploadPath)
+	}
+	expected := `name = "web"
+build = "vbox"
+version = "1.2.3"
+`
+	if comm.UploadData != expected {
+		t.Fatalf("unexpected upload data: %s", comm.UploadData)
+	}
+	if comm.StartCmd.Command != "sudo chmod '0640' '/etc/app/app.conf'" {
+		t.Fatalf("unexpected command: %s", comm.StartCmd.Command)
+	}
+}
+
+func TestProvisionerProvision_PermissionsQuoted(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	config := map[string]interface{}{
+		"source":       tf.Name(),
+		"destination":  "/tmp/it's here",
+		"owner":        "app'; reboot; '",
+		"disable_sudo": true,
+	}
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packer.MockCommunicator{}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	expected := `chown -R 'app'"'"'; reboot; '"'"'' '/tmp/it'"'"'s here'`
+	if comm.StartCmd.Command != expected {
+		t.Fatalf("unexpected command: %s", comm.StartCmd.Command)
+	}
+}
@@ -0,0 +1,70 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+// renderSource renders the file or directory src as templates into dir and
+// returns the path of the rendered copy. The copy keeps the base name,
+// the trailing slash and the file modes of src.
+func renderSource(src string, dir string, ctx *interpolate.Context) (string, error) {
+	trailingSlash := strings.HasSuffix(src, "/") || strings.HasSuffix(src, string(filepath.Separator))
+	src = filepath.Clean(src)
+	dst := filepath.Join(dir, filepath.Base(src))
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rendered, err := interpolate.Render(string(contents), ctx)
+		if err != nil {
+			return fmt.Errorf("Error rendering %s: %s", path, err)
+		}
+		if err := ioutil.WriteFile(target, []byte(rendered), info.Mode().Perm()); err != nil {
+			return err
+		}
+		// WriteFile applies the umask
+		return os.Chmod(target, info.Mode().Perm())
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if trailingSlash {
+		dst += string(filepath.Separator)
+	}
+	return dst, nil
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+func TestRenderSource_Dir(t *testing.T) {
+	src, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.Mkdir(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatalf("error creating dir: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("echo {{ .greeting }}\n"), 0755); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "secret"), []byte("{{ .greeting }}"), 0600); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := &interpolate.Context{Data: map[string]string{"greeting": "hello"}}
+	rendered, err := renderSource(src+"/", dir, ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasSuffix(rendered, "/") || filepath.Base(rendered) != filepath.Base(src) {
+		t.Fatalf("unexpected rendered path: %s", rendered)
+	}
+
+	cases := []struct {
+		Path     string
+		Contents string
+		Mode     os.FileMode
+	}{
+		{"bin/run.sh", "echo hello\n", 0755},
+		{"secret", "hello", 0600},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(rendered, tc.Path)
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(contents) != tc.Contents {
+			t.Fatalf("%s: unexpected contents: %q", tc.Path, contents)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if info.Mode().Perm() != tc.Mode {
+			t.Fatalf("%s: unexpected mode: %s", tc.Path, info.Mode())
+		}
+	}
+}
+
+func TestRenderSource_Invalid(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+	tf.WriteString("{{ .unclosed")
+	tf.Close()
+
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := renderSource(tf.Name(), dir, &interpolate.Context{}); err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -0,0 +1,347 @@
+// This package implements a provisioner for Packer that runs a test suite,
+// such as goss or Testinfra, on the machine being built and reports the
+// results.
+package imagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/transfer"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+const (
+	defaultGossCommand      = "cd {{.Folder}} && goss --gossfile {{.Spec}}{{if .Vars}} --vars {{.Vars}}{{end}} validate --no-color --format {{.Format}} > {{.Results}}"
+	defaultTestinfraCommand = "cd {{.Folder}} && py.test -p no:cacheprovider --junit-xml={{.Results}} {{.Spec}}"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The test framework, goss or testinfra.
+	Framework string `mapstructure:"framework"`
+
+	// The local spec files to run.
+	Spec  string   `mapstructure:"spec"`
+	Specs []string `mapstructure:"specs"`
+
+	// A local file with the variables of the goss specs.
+	VarsFile string `mapstructure:"vars_file"`
+
+	// The format of the results, junit or json. json is only supported by
+	// goss.
+	Format string `mapstructure:"format"`
+
+	// The command running a spec and writing its results to a file.
+	ExecuteCommand string `mapstructure:"execute_command"`
+
+	// The remote folder the specs are uploaded to.
+	RemoteFolder string `mapstructure:"remote_folder"`
+
+	// The local directory the results are saved to.
+	ResultsDir string `mapstructure:"results_dir"`
+
+	// Whether failing tests fail the build. Defaults to true.
+	FailOnError *bool `mapstructure:"fail_on_error"`
+
+	// Whether to leave the specs and results on the machine.
+	SkipClean bool `mapstructure:"skip_clean"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+type ExecuteCommandTemplate struct {
+	Folder  string
+	Spec    string
+	Vars    string
+	Format  string
+	Results string
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"execute_command",
+			},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.Framework == "" {
+		p.config.Framework = "goss"
+	}
+
+	if p.config.Format == "" {
+		p.config.Format = "junit"
+	}
+
+	if p.config.ExecuteCommand == "" {
+		p.config.ExecuteCommand = defaultGossCommand
+		if p.config.Framework == "testinfra" {
+			p.config.ExecuteCommand = defaultTestinfraCommand
+		}
+	}
+
+	if p.config.RemoteFolder == "" {
+		p.config.RemoteFolder = "/tmp/packer-image-test"
+	}
+
+	if p.config.ResultsDir == "" {
+		p.config.ResultsDir = "test-results"
+	}
+
+	if p.config.FailOnError == nil {
+		failOnError := true
+		p.config.FailOnError = &failOnError
+	}
+
+	var errs *packer.MultiError
+	switch p.config.Framework {
+	case "goss", "testinfra":
+	default:
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("framework: %q is invalid, must be goss or testinfra", p.config.Framework))
+	}
+
+	switch p.config.Format {
+	case "junit":
+	case "json":
+		if p.config.Framework != "goss" {
+			errs = packer.MultiErrorAppend(errs,
+				errors.New("format: json is only supported by goss"))
+		}
+	default:
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("format: %q is invalid, must be junit or json", p.config.Format))
+	}
+
+	if p.config.Spec != "" && len(p.config.Specs) > 0 {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("Only one of spec or specs can be specified."))
+	}
+
+	if p.config.Spec != "" {
+		p.config.Specs = []string{p.config.Spec}
+	}
+
+	if len(p.config.Specs) == 0 {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("A spec file must be specified."))
+	}
+
+	for _, path := range p.config.Specs {
+		if _, err := os.Stat(path); err != nil {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("Bad spec '%s': %s", path, err))
+		}
+	}
+
+	if p.config.VarsFile != "" {
+		if p.config.Framework != "goss" {
+			errs = packer.MultiErrorAppend(errs,
+				errors.New("vars_file is only supported by goss"))
+		} else if _, err := os.Stat(p.config.VarsFile); err != nil {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("Bad vars_file '%s': %s", p.config.VarsFile, err))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Testing the image with %s...", p.config.Framework))
+
+	if err := os.MkdirAll(p.config.ResultsDir, 0755); err != nil {
+		return fmt.Errorf("Error creating results directory: %s", err)
+	}
+
+	if err := p.runCommand(ctx, comm, "mkdir -p "+transfer.ShellQuote(p.config.RemoteFolder)); err != nil {
+		return err
+	}
+	if !p.config.SkipClean {
+		defer func() {
+			if err := p.runCommand(ctx, comm, "rm -rf "+transfer.ShellQuote(p.config.RemoteFolder)); err != nil {
+				ui.Error(fmt.Sprintf("Error removing the specs: %s", err))
+			}
+		}()
+	}
+
+	var vars string
+	if p.config.VarsFile != "" {
+		vars = fmt.Sprintf("%s/%s", p.config.RemoteFolder, filepath.Base(p.config.VarsFile))
+		if err := p.upload(comm, p.config.VarsFile, vars); err != nil {
+			return err
+		}
+	}
+
+	var resultFiles []string
+	total, failed := 0, 0
+	for _, spec := range p.config.Specs {
+		ui.Say(fmt.Sprintf("Running spec: %s", spec))
+
+		results, path, err := p.runSpec(ctx, ui, comm, spec, vars)
+		if err != nil {
+			return err
+		}
+		resultFiles = append(resultFiles, path)
+
+		for _, r := range results {
+			total++
+			switch {
+			case r.Failed:
+				failed++
+				if r.Message != "" {
+					ui.Error(fmt.Sprintf("FAIL: %s: %s", r.Name, r.Message))
+				} else {
+					ui.Error(fmt.Sprintf("FAIL: %s", r.Name))
+				}
+			case r.Skipped:
+				ui.Message(fmt.Sprintf("SKIP: %s", r.Name))
+			default:
+				ui.Message(fmt.Sprintf("PASS: %s", r.Name))
+			}
+		}
+	}
+
+	ui.Say(fmt.Sprintf("%d tests, %d failures, results saved to %s",
+		total, failed, strings.Join(resultFiles, ", ")))
+
+	err := commonhelper.SetBuildOutputs(p.config.PackerBuildName, map[string]string{
+		"test_results":  strings.Join(resultFiles, ","),
+		"test_failures": strconv.Itoa(failed),
+	})
+	if err != nil {
+		return fmt.Errorf("Error saving outputs: %s", err)
+	}
+	// The results end up in the files of the artifacts
+	if err := commonhelper.AddArtifactFiles(p.config.PackerBuildName, resultFiles...); err != nil {
+		return fmt.Errorf("Error saving outputs: %s", err)
+	}
+
+	if failed > 0 && *p.config.FailOnError {
+		return fmt.Errorf("%d of %d tests failed", failed, total)
+	}
+
+	return nil
+}
+
+// runSpec uploads and runs a spec, then saves its results locally.
+func (p *Provisioner) runSpec(ctx context.Context, ui packer.Ui, comm packer.Communicator, spec string, vars string) ([]testResult, string, error) {
+	name := filepath.Base(spec)
+	remoteSpec := fmt.Sprintf("%s/%s", p.config.RemoteFolder, name)
+	if err := p.upload(comm, spec, remoteSpec); err != nil {
+		return nil, "", err
+	}
+
+	ext := ".xml"
+	if p.config.Format == "json" {
+		ext = ".json"
+	}
+	remoteResults := fmt.Sprintf("%s/%s-results%s", p.config.RemoteFolder, name, ext)
+
+	p.config.ctx.Data = &ExecuteCommandTemplate{
+		Folder:  p.config.RemoteFolder,
+		Spec:    remoteSpec,
+		Vars:    vars,
+		Format:  p.config.Format,
+		Results: remoteResults,
+	}
+	command, err := interpolate.Render(p.config.ExecuteCommand, &p.config.ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error processing command: %s", err)
+	}
+
+	cmd := &packer.RemoteCmd{Command: command}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return nil, "", err
+	}
+	// A non-zero exit status usually means that some tests failed, which
+	// the results tell.
+	log.Printf("Spec %s exited with status %d", spec, cmd.ExitStatus())
+
+	var report bytes.Buffer
+	if err := comm.Download(remoteResults, &report); err != nil {
+		return nil, "", fmt.Errorf("Error downloading results of %s: %s", spec, err)
+	}
+	if report.Len() == 0 {
+		return nil, "", fmt.Errorf("No results for %s, the test run exited with status %d", spec, cmd.ExitStatus())
+	}
+
+	path := filepath.Join(p.config.ResultsDir,
+		fmt.Sprintf("%s-%s-results%s", p.config.PackerBuildName, strings.TrimSuffix(name, filepath.Ext(name)), ext))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error saving results: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(report.Bytes()); err != nil {
+		return nil, "", fmt.Errorf("Error saving results: %s", err)
+	}
+
+	var results []testResult
+	if p.config.Format == "json" {
+		results, err = parseGossJSON(&report)
+	} else {
+		results, err = parseJUnit(&report)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, path, nil
+}
+
+func (p *Provisioner) upload(comm packer.Communicator, src string, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := comm.Upload(dst, f, &fi); err != nil {
+		return fmt.Errorf("Error uploading %s: %s", src, err)
+	}
+	return nil
+}
+
+func (p *Provisioner) runCommand(ctx context.Context, comm packer.Communicator, command string) error {
+	cmd := &packer.RemoteCmd{Command: command}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("'%s' exited with status %d", command, status)
+	}
+	return nil
+}
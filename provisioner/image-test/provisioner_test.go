@@ -0,0 +1,181 @@
+package imagetest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig(t *testing.T) map[string]interface{} {
+	dir, err := ioutil.TempDir("", "packer-image-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return map[string]interface{}{
+		"spec":              "test-fixtures/goss.yaml",
+		"results_dir":       dir,
+		"packer_build_name": "centos",
+	}
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var _ packer.Provisioner = new(Provisioner)
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	config := testConfig(t)
+	defer os.RemoveAll(config["results_dir"].(string))
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.Framework != "goss" {
+		t.Fatalf("bad framework: %s", p.config.Framework)
+	}
+	if p.config.Format != "junit" {
+		t.Fatalf("bad format: %s", p.config.Format)
+	}
+	if p.config.ExecuteCommand != defaultGossCommand {
+		t.Fatalf("bad command: %s", p.config.ExecuteCommand)
+	}
+	if !*p.config.FailOnError {
+		t.Fatal("fail_on_error should default to true")
+	}
+}
+
+func TestProvisionerPrepare_Framework(t *testing.T) {
+	config := testConfig(t)
+	defer os.RemoveAll(config["results_dir"].(string))
+
+	config["framework"] = "testinfra"
+	config["spec"] = "test-fixtures/test_image.py"
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.ExecuteCommand != defaultTestinfraCommand {
+		t.Fatalf("bad command: %s", p.config.ExecuteCommand)
+	}
+
+	config["format"] = "json"
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("testinfra should not support json")
+	}
+
+	config["framework"] = "serverspec"
+	delete(config, "format")
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerPrepare_Spec(t *testing.T) {
+	config := testConfig(t)
+	defer os.RemoveAll(config["results_dir"].(string))
+
+	delete(config, "spec")
+	var p Provisioner
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should require a spec")
+	}
+
+	config["spec"] = "test-fixtures/nope.yaml"
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error on a missing spec")
+	}
+
+	config["spec"] = "test-fixtures/goss.yaml"
+	config["specs"] = []string{"test-fixtures/goss.yaml"}
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should not accept both spec and specs")
+	}
+}
+
+func TestProvisionerProvision(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-image-test")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("centos")
+
+	report, err := ioutil.ReadFile("test-fixtures/junit.xml")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := testConfig(t)
+	defer os.RemoveAll(config["results_dir"].(string))
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packer.MockCommunicator{DownloadData: string(report)}
+	err = p.Provision(context.Background(), packer.TestUi(t), comm)
+	if err == nil || err.Error() != "1 of 3 tests failed" {
+		t.Fatalf("should fail the build: %v", err)
+	}
+	if comm.DownloadPath != "/tmp/packer-image-test/goss.yaml-results.xml" {
+		t.Fatalf("bad download path: %s", comm.DownloadPath)
+	}
+
+	path := filepath.Join(config["results_dir"].(string), "centos-goss-results.xml")
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("results should be saved: %s", err)
+	}
+	if string(saved) != string(report) {
+		t.Fatalf("bad results: %s", saved)
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("centos")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs["test_results"] != path || outputs["test_failures"] != "1" {
+		t.Fatalf("bad outputs: %#v", outputs)
+	}
+	if outputs[commonhelper.ArtifactFilesOutput] != path {
+		t.Fatalf("the results should be in the artifact files: %#v", outputs)
+	}
+
+	if comm.StartCmd.Command != "rm -rf '/tmp/packer-image-test'" {
+		t.Fatalf("should remove the specs: %s", comm.StartCmd.Command)
+	}
+
+	// Failures can be reported without failing the build
+	config["fail_on_error"] = false
+	p = Provisioner{}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestProvisionerProvision_noResults(t *testing.T) {
+	config := testConfig(t)
+	defer os.RemoveAll(config["results_dir"].(string))
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := new(packer.MockCommunicator)
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("should have error")
+	}
+}
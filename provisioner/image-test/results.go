@@ -0,0 +1,110 @@
+package imagetest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// testResult is the outcome of a single test of a suite.
+type testResult struct {
+	Name    string
+	Failed  bool
+	Skipped bool
+	Message string
+}
+
+// parseJUnit reads the test cases of a JUnit XML report, whether they are
+// grouped in a single testsuite or in testsuites.
+func parseJUnit(r io.Reader) ([]testResult, error) {
+	var results []testResult
+
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing JUnit report: %s", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "testcase" {
+			continue
+		}
+
+		var tc struct {
+			Name      string `xml:"name,attr"`
+			Classname string `xml:"classname,attr"`
+			Failures  []struct {
+				Message string `xml:"message,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"failure"`
+			Errors []struct {
+				Message string `xml:"message,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"error"`
+			Skipped *struct{} `xml:"skipped"`
+		}
+		if err := d.DecodeElement(&tc, &start); err != nil {
+			return nil, fmt.Errorf("Error parsing JUnit report: %s", err)
+		}
+
+		result := testResult{
+			Name:    tc.Name,
+			Skipped: tc.Skipped != nil,
+		}
+		if tc.Classname != "" {
+			result.Name = tc.Classname + "." + tc.Name
+		}
+		for _, f := range append(tc.Failures, tc.Errors...) {
+			result.Failed = true
+			message := f.Message
+			if message == "" {
+				message = strings.TrimSpace(f.Text)
+			}
+			if message != "" {
+				result.Message = message
+				break
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// parseGossJSON reads the results of `goss validate --format json`.
+func parseGossJSON(r io.Reader) ([]testResult, error) {
+	var report struct {
+		Results []struct {
+			Successful   bool   `json:"successful"`
+			Skipped      bool   `json:"skipped"`
+			ResourceType string `json:"resource-type"`
+			ResourceID   string `json:"resource-id"`
+			Property     string `json:"property"`
+			SummaryLine  string `json:"summary-line"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("Error parsing goss report: %s", err)
+	}
+
+	results := make([]testResult, 0, len(report.Results))
+	for _, r := range report.Results {
+		result := testResult{
+			Name:    fmt.Sprintf("%s: %s: %s", r.ResourceType, r.ResourceID, r.Property),
+			Skipped: r.Skipped,
+		}
+		if !r.Successful && !r.Skipped {
+			result.Failed = true
+			result.Message = r.SummaryLine
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,57 @@
+package imagetest
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJUnit(t *testing.T) {
+	f, err := os.Open("test-fixtures/junit.xml")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	results, err := parseJUnit(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []testResult{
+		{Name: "goss-sshd.Service: sshd: running"},
+		{Name: "goss-nginx.Package: nginx: installed", Failed: true, Message: "Package: nginx: installed: Expected false to equal true"},
+		{Name: "goss-motd.File: /etc/motd: exists", Skipped: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	if _, err := parseJUnit(strings.NewReader("<testsuite><testcase>")); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestParseGossJSON(t *testing.T) {
+	f, err := os.Open("test-fixtures/goss.json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	results, err := parseGossJSON(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("bad: %#v", results)
+	}
+	if results[0].Failed || results[0].Name != "Service: sshd: running" {
+		t.Fatalf("bad: %#v", results[0])
+	}
+	if !results[1].Failed || !strings.HasPrefix(results[1].Message, "Package: nginx: installed:") {
+		t.Fatalf("bad: %#v", results[1])
+	}
+}
@@ -0,0 +1,2 @@
+def test_sshd_running(host):
+    assert host.service("sshd").is_running
@@ -0,0 +1,210 @@
+// This package implements a provisioner for Packer that restarts a Unix
+// machine and waits for it to come back up.
+package restart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/retry"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+var DefaultRestartCommand = "sudo shutdown -r now"
+var DefaultBootIDCommand = "cat /proc/sys/kernel/random/boot_id"
+var retryableSleep = 5 * time.Second
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The command used to restart the guest machine
+	RestartCommand string `mapstructure:"restart_command"`
+
+	// The command printing an identifier that changes on every boot, used
+	// to tell that the machine did restart
+	BootIDCommand string `mapstructure:"boot_id_command"`
+
+	// A command that must succeed before the provisioning goes on, once
+	// the machine restarted
+	RestartCheckCommand string `mapstructure:"restart_check_command"`
+
+	// The timeout for waiting for the machine to restart
+	RestartTimeout time.Duration `mapstructure:"restart_timeout"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.RestartCommand == "" {
+		p.config.RestartCommand = DefaultRestartCommand
+	}
+
+	if p.config.BootIDCommand == "" {
+		p.config.BootIDCommand = DefaultBootIDCommand
+	}
+
+	if p.config.RestartTimeout == 0 {
+		p.config.RestartTimeout = 5 * time.Minute
+	}
+
+	if p.config.RestartTimeout < 0 {
+		return errors.New("restart_timeout must be positive")
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	bootID, err := p.bootID(ctx, comm)
+	if err != nil {
+		return fmt.Errorf("Error reading the boot ID: %s", err)
+	}
+	log.Printf("Boot ID before restarting: %s", bootID)
+
+	ui.Say("Restarting Machine")
+
+	var cmd *packer.RemoteCmd
+	err = retry.Config{StartTimeout: p.config.RestartTimeout}.Run(ctx, func(context.Context) error {
+		cmd = &packer.RemoteCmd{Command: p.config.RestartCommand}
+		return cmd.RunWithUi(ctx, comm, ui)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The restart usually closes the connection before the exit status of
+	// the restart command is sent back.
+	if cmd.ExitStatus() == packer.CmdDisconnect {
+		log.Printf("Connection closed by the restart command")
+	} else if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("Restart command exited with non-zero exit status: %d", cmd.ExitStatus())
+	}
+
+	ui.Say("Waiting for machine to restart...")
+	ctx, cancel := context.WithTimeout(ctx, p.config.RestartTimeout)
+	defer cancel()
+
+	if err := p.waitForBoot(ctx, comm, bootID); err != nil {
+		return err
+	}
+
+	if p.config.RestartCheckCommand != "" {
+		ui.Say("Waiting for machine to be ready...")
+		if err := p.waitForCheck(ctx, comm); err != nil {
+			return err
+		}
+	}
+
+	ui.Say("Machine successfully restarted, moving on")
+	return nil
+}
+
+func (p *Provisioner) Cancel() {}
+
+// waitForBoot waits until the communicator reconnects and the machine
+// reports a boot ID other than previous.
+func (p *Provisioner) waitForBoot(ctx context.Context, comm packer.Communicator, previous string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return waitError(ctx, "restart")
+		case <-time.After(retryableSleep):
+		}
+
+		bootID, err := p.bootID(ctx, comm)
+		if err != nil {
+			log.Printf("Machine not available yet: %s", err)
+			continue
+		}
+		if bootID == previous {
+			log.Printf("Boot ID unchanged, machine still shutting down...")
+			continue
+		}
+
+		log.Printf("Boot ID after restarting: %s", bootID)
+		return nil
+	}
+}
+
+// waitForCheck runs the restart check command until it succeeds.
+func (p *Provisioner) waitForCheck(ctx context.Context, comm packer.Communicator) error {
+	log.Printf("Checking that the machine is ready with: '%s'", p.config.RestartCheckCommand)
+	for {
+		exitStatus, output, err := run(ctx, comm, p.config.RestartCheckCommand)
+		if err == nil && exitStatus == 0 {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Restart check failed: %s", err)
+		} else {
+			log.Printf("Restart check exited with status %d: %s", exitStatus, output)
+		}
+
+		select {
+		case <-ctx.Done():
+			return waitError(ctx, "the restart check")
+		case <-time.After(retryableSleep):
+		}
+	}
+}
+
+func (p *Provisioner) bootID(ctx context.Context, comm packer.Communicator) (string, error) {
+	exitStatus, output, err := run(ctx, comm, p.config.BootIDCommand)
+	if err != nil {
+		return "", err
+	}
+	if exitStatus != 0 {
+		return "", fmt.Errorf("'%s' exited with status %d", p.config.BootIDCommand, exitStatus)
+	}
+	if output == "" {
+		return "", fmt.Errorf("'%s' printed nothing", p.config.BootIDCommand)
+	}
+	return output, nil
+}
+
+func waitError(ctx context.Context, what string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timeout waiting for %s.", what)
+	}
+	return fmt.Errorf("Interrupt detected, quitting waiting for %s", what)
+}
+
+func run(ctx context.Context, comm packer.Communicator, command string) (int, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, "", err
+	}
+	exitStatus := cmd.Wait()
+	if exitStatus == packer.CmdDisconnect {
+		return 0, "", errors.New("connection closed")
+	}
+	if stderr.Len() > 0 {
+		log.Printf("'%s' stderr: %s", command, stderr.String())
+	}
+	return exitStatus, strings.TrimSpace(stdout.String()), nil
+}
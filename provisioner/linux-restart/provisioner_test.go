@@ -0,0 +1,168 @@
+package restart
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// testCommunicator answers each command with the next of its results, and
+// keeps answering with the last one.
+type testCommunicator struct {
+	packer.MockCommunicator
+	results map[string][]testResult
+	ran     []string
+}
+
+type testResult struct {
+	status int
+	stdout string
+}
+
+func (c *testCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	c.ran = append(c.ran, cmd.Command)
+	r := testResult{status: 1}
+	if results := c.results[cmd.Command]; len(results) > 0 {
+		r = results[0]
+		if len(results) > 1 {
+			c.results[cmd.Command] = results[1:]
+		}
+	}
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write([]byte(r.stdout))
+	}
+	cmd.SetExited(r.status)
+	return nil
+}
+
+func (c *testCommunicator) count(command string) int {
+	n := 0
+	for _, ran := range c.ran {
+		if ran == command {
+			n++
+		}
+	}
+	return n
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packer.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.RestartTimeout != 5*time.Minute {
+		t.Errorf("unexpected restart timeout: %s", p.config.RestartTimeout)
+	}
+	if p.config.RestartCommand != "sudo shutdown -r now" {
+		t.Errorf("unexpected restart command: %s", p.config.RestartCommand)
+	}
+	if p.config.BootIDCommand != "cat /proc/sys/kernel/random/boot_id" {
+		t.Errorf("unexpected boot ID command: %s", p.config.BootIDCommand)
+	}
+}
+
+func TestProvisionerPrepare_ConfigErrors(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["restart_timeout"] = "m"
+
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("Expected error parsing restart_timeout but did not receive one.")
+	}
+}
+
+func TestProvisionerProvision_Restart(t *testing.T) {
+	defer func(d time.Duration) { retryableSleep = d }(retryableSleep)
+	retryableSleep = time.Millisecond
+
+	config := testConfig()
+	config["restart_check_command"] = "systemctl is-system-running"
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string][]testResult{
+			DefaultRestartCommand: {{packer.CmdDisconnect, ""}},
+			DefaultBootIDCommand: {
+				{0, "11111111-1111-1111-1111-111111111111\n"},
+				{0, "11111111-1111-1111-1111-111111111111\n"},
+				{packer.CmdDisconnect, ""},
+				{0, "22222222-2222-2222-2222-222222222222\n"},
+			},
+			"systemctl is-system-running": {
+				{1, "starting\n"},
+				{0, "running\n"},
+			},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if n := comm.count(DefaultBootIDCommand); n != 4 {
+		t.Fatalf("expected 4 boot ID checks, got %d", n)
+	}
+	if n := comm.count("systemctl is-system-running"); n != 2 {
+		t.Fatalf("expected 2 restart checks, got %d", n)
+	}
+}
+
+func TestProvisionerProvision_RestartFailed(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string][]testResult{
+			DefaultRestartCommand: {{1, ""}},
+			DefaultBootIDCommand:  {{0, "11111111-1111-1111-1111-111111111111\n"}},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_Timeout(t *testing.T) {
+	defer func(d time.Duration) { retryableSleep = d }(retryableSleep)
+	retryableSleep = time.Millisecond
+
+	config := testConfig()
+	config["restart_timeout"] = "50ms"
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The boot ID never changes
+	comm := &testCommunicator{
+		results: map[string][]testResult{
+			DefaultRestartCommand: {{0, ""}},
+			DefaultBootIDCommand:  {{0, "11111111-1111-1111-1111-111111111111\n"}},
+		},
+	}
+	err := p.Provision(context.Background(), packer.TestUi(t), comm)
+	if err == nil || err.Error() != "Timeout waiting for restart." {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -42,6 +42,12 @@ type Config struct {
 	// pre-existing directory.
 	RemoteEnvVarPath string `mapstructure:"remote_env_var_path"`
 
+	// The shell used by the communicator to run commands on the remote host.
+	// This is "cmd" for WinRM and the default OpenSSH server for Windows,
+	// and "powershell" when OpenSSH is configured with PowerShell as its
+	// DefaultShell. It selects the default execute_command.
+	RemoteShell string `mapstructure:"remote_shell"`
+
 	// The command used to execute the elevated script. The '{{ .Path }}'
 	// variable should be used to specify where the script goes, {{ .Vars }}
 	// can be used to inject the environment_vars into the environment.
@@ -66,7 +72,12 @@ type Config struct {
 	ElevatedUser     string `mapstructure:"elevated_user"`
 	ElevatedPassword string `mapstructure:"elevated_password"`
 
-	ctx interpolate.Context
+	// Whether to capture the outputs exported by the scripts so that later
+	// provisioners and post-processors can use them.
+	CaptureOutputs bool `mapstructure:"capture_outputs"`
+
+	ctx     interpolate.Context
+	outputs *shell.OutputCapture
 }
 
 type Provisioner struct {
@@ -98,6 +109,8 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 			Exclude: []string{
 				"execute_command",
 				"elevated_execute_command",
+				"inline",
+				"environment_vars",
 			},
 		},
 	}, raws...)
@@ -114,6 +127,16 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		p.config.ElevatedEnvVarFormat = `$env:%s="%s"; `
 	}
 
+	if p.config.RemoteShell == "" {
+		p.config.RemoteShell = "cmd"
+	}
+
+	if p.config.ExecuteCommand == "" && p.config.RemoteShell == "powershell" {
+		// Already running in PowerShell, so there is no need to start
+		// another one and quote the script for it.
+		p.config.ExecuteCommand = `& { Set-ExecutionPolicy -Scope Process -ExecutionPolicy Bypass -Force -ErrorAction SilentlyContinue; if (Test-Path variable:global:ProgressPreference){set-variable -name variable:global:ProgressPreference -value 'SilentlyContinue'};. {{.Vars}}; &'{{.Path}}'; exit $LastExitCode }`
+	}
+
 	if p.config.ExecuteCommand == "" {
 		p.config.ExecuteCommand = `powershell -executionpolicy bypass "& { if (Test-Path variable:global:ProgressPreference){set-variable -name variable:global:ProgressPreference -value 'SilentlyContinue'};. {{.Vars}}; &'{{.Path}}'; exit $LastExitCode }"`
 	}
@@ -140,6 +163,13 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		p.config.RemoteEnvVarPath = fmt.Sprintf(`c:/Windows/Temp/packer-ps-env-vars-%s.ps1`, uuid)
 	}
 
+	if p.config.CaptureOutputs {
+		uuid := uuid.TimeOrderedUUID()
+		p.config.outputs = &shell.OutputCapture{
+			RemotePath: fmt.Sprintf(`c:/Windows/Temp/packer-outputs-%s.txt`, uuid),
+		}
+	}
+
 	if p.config.Scripts == nil {
 		p.config.Scripts = make([]string, 0)
 	}
@@ -154,6 +184,11 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 			errors.New("Only one of script or scripts can be specified."))
 	}
 
+	if p.config.RemoteShell != "cmd" && p.config.RemoteShell != "powershell" {
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("Invalid remote_shell: %q, must be one of: cmd, powershell", p.config.RemoteShell))
+	}
+
 	if p.config.ElevatedUser == "" && p.config.ElevatedPassword != "" {
 		errs = packer.MultiErrorAppend(errs,
 			errors.New("Must supply an 'elevated_user' if 'elevated_password' provided"))
@@ -218,6 +253,20 @@ func extractScript(p *Provisioner) (string, error) {
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	// Render the inline commands in a copy of the provisioner, so that they
+	// are rendered again if it runs again. The environment variables are
+	// rendered when they are uploaded.
+	rendered := *p
+	rendered.config.ctx.Data = nil
+	var err error
+	if rendered.config.Inline, err = shell.Render(p.config.Inline, &rendered.config.ctx); err != nil {
+		return fmt.Errorf("Error processing inline commands: %s", err)
+	}
+
+	return rendered.provision(ctx, ui, comm)
+}
+
+func (p *Provisioner) provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
 	ui.Say(fmt.Sprintf("Provisioning with Powershell..."))
 	p.communicator = comm
 
@@ -254,7 +303,7 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		// that the upload succeeded, a restart is initiated, and then the
 		// command is executed but the file doesn't exist any longer.
 		var cmd *packer.RemoteCmd
-		retry.Config{StartTimeout: p.config.StartRetryTimeout}.Run(ctx, func(ctx context.Context) error {
+		err = retry.Config{StartTimeout: p.config.StartRetryTimeout}.Run(ctx, func(ctx context.Context) error {
 			if _, err := f.Seek(0, 0); err != nil {
 				return err
 			}
@@ -263,6 +312,12 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 			}
 
 			cmd = &packer.RemoteCmd{Command: command}
+			if p.config.outputs != nil {
+				if err := p.config.outputs.Reset(comm); err != nil {
+					return err
+				}
+				cmd.Stdout = p.config.outputs.Stdout()
+			}
 			return cmd.RunWithUi(ctx, comm, ui)
 		})
 		if err != nil {
@@ -275,6 +330,16 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		if err := p.config.ValidExitCode(cmd.ExitStatus()); err != nil {
 			return err
 		}
+
+		if p.config.outputs != nil {
+			names, err := p.config.outputs.Save(comm, p.config.PackerBuildName)
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				ui.Say(fmt.Sprintf("Captured outputs: %s", strings.Join(names, ", ")))
+			}
+		}
 	}
 
 	return nil
@@ -324,6 +389,10 @@ func (p *Provisioner) createFlattenedEnvVars(elevated bool) (flattened string) {
 		envVars["PACKER_HTTP_PORT"] = httpPort
 	}
 
+	if p.config.outputs != nil {
+		envVars[shell.OutputFileEnvVar] = p.config.outputs.RemotePath
+	}
+
 	// interpolate environment variables
 	p.config.ctx.Data = &EnvVarsTemplate{
 		WinRMPassword: getWinRMPassword(p.config.PackerBuildName),
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/packer"
 )
 
@@ -90,6 +91,43 @@ func TestProvisionerPrepare_Defaults(t *testing.T) {
 	}
 }
 
+func TestProvisionerPrepare_RemoteShell(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["remote_shell"] = "powershell"
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.HasPrefix(p.config.ExecuteCommand, "powershell") {
+		t.Fatalf("should not start a nested powershell: %s", p.config.ExecuteCommand)
+	}
+	if !strings.HasSuffix(p.config.ExecuteCommand, "exit $LastExitCode }") {
+		t.Fatalf("should propagate the exit code: %s", p.config.ExecuteCommand)
+	}
+
+	// elevated commands always run through cmd in a scheduled task
+	if !strings.HasPrefix(p.config.ElevatedExecuteCommand, "powershell -executionpolicy bypass") {
+		t.Fatalf("bad elevated command: %s", p.config.ElevatedExecuteCommand)
+	}
+
+	config["execute_command"] = "custom"
+	p = Provisioner{}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.ExecuteCommand != "custom" {
+		t.Fatalf("should keep a custom command: %s", p.config.ExecuteCommand)
+	}
+
+	config["remote_shell"] = "bash"
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestProvisionerPrepare_Config(t *testing.T) {
 	config := testConfig()
 	config["elevated_user"] = "{{user `user`}}"
@@ -496,6 +534,40 @@ func TestProvisionerProvision_ScriptsWithEnvVars(t *testing.T) {
 	}
 }
 
+func TestProvisionerProvision_CaptureOutputs(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-powershell-outputs")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("windows")
+
+	config := testConfig()
+	config["capture_outputs"] = true
+	config["packer_build_name"] = "windows"
+
+	p := new(Provisioner)
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(p.createFlattenedEnvVars(false), `$env:PACKER_OUTPUT_FILE="`+p.config.outputs.RemotePath+`"`) {
+		t.Fatalf("should expose the output file: %s", p.createFlattenedEnvVars(false))
+	}
+
+	comm := &packer.MockCommunicator{
+		StartStdout:  "PACKER_OUTPUT build=17763\r\n",
+		DownloadData: "edition=Datacenter\r\n",
+	}
+	if err := p.Provision(context.Background(), testUi(), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("windows")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs["build"] != "17763" || outputs["edition"] != "Datacenter" {
+		t.Fatalf("bad: %#v", outputs)
+	}
+}
+
 func TestProvisionerProvision_UISlurp(t *testing.T) {
 	// UI should be called n times
 
@@ -0,0 +1,159 @@
+package sbom
+
+import (
+	"strings"
+
+	"github.com/hashicorp/packer/common/sbom"
+)
+
+// rpmNone is what rpm prints for the tags a package doesn't have.
+const rpmNone = "(none)"
+
+// parseDpkg reads the output of dpkg-query, keeping the packages that are
+// installed.
+func parseDpkg(out string) []sbom.Package {
+	var packages []sbom.Package
+	for _, fields := range splitLines(out, 5) {
+		if !strings.HasPrefix(fields[0], "ii") {
+			continue
+		}
+		packages = append(packages, sbom.Package{
+			Type:     sbom.TypeDeb,
+			Name:     fields[1],
+			Version:  fields[2],
+			Arch:     fields[3],
+			Supplier: fields[4],
+		})
+	}
+	return packages
+}
+
+// parseRPM reads the output of rpm -qa.
+func parseRPM(out string) []sbom.Package {
+	var packages []sbom.Package
+	for _, fields := range splitLines(out, 6) {
+		pkg := sbom.Package{
+			Type:     sbom.TypeRPM,
+			Name:     fields[0],
+			Version:  fields[2],
+			Arch:     rpmTag(fields[3]),
+			Supplier: rpmTag(fields[4]),
+			License:  rpmTag(fields[5]),
+		}
+		if epoch := rpmTag(fields[1]); epoch != "" && epoch != "0" {
+			pkg.Version = epoch + ":" + pkg.Version
+		}
+		packages = append(packages, pkg)
+	}
+	return packages
+}
+
+func rpmTag(value string) string {
+	if value == rpmNone {
+		return ""
+	}
+	return value
+}
+
+// parseAPK reads the apk database, where each package is a paragraph of
+// "letter:value" lines.
+func parseAPK(out string) []sbom.Package {
+	var packages []sbom.Package
+	var pkg sbom.Package
+	flush := func() {
+		if pkg.Name != "" {
+			pkg.Type = sbom.TypeAPK
+			packages = append(packages, pkg)
+		}
+		pkg = sbom.Package{}
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			pkg.Name = value
+		case 'V':
+			pkg.Version = value
+		case 'A':
+			pkg.Arch = value
+		case 'L':
+			pkg.License = value
+		case 'm':
+			pkg.Supplier = value
+		}
+	}
+	flush()
+
+	return packages
+}
+
+// parseWindows reads the output of the Windows script: the version of
+// Windows and the installed programs.
+func parseWindows(out string) (string, []sbom.Package) {
+	var version string
+	var packages []sbom.Package
+	for _, fields := range splitLines(out, 2) {
+		if fields[0] == "PACKER_OS" {
+			version = fields[1]
+			continue
+		}
+		pkg := sbom.Package{
+			Type:    sbom.TypeWindows,
+			Name:    fields[0],
+			Version: fields[1],
+		}
+		if len(fields) > 2 {
+			pkg.Arch = fields[2]
+		}
+		if len(fields) > 3 {
+			pkg.Supplier = fields[3]
+		}
+		packages = append(packages, pkg)
+	}
+	return version, packages
+}
+
+// parseOSRelease returns the ID and the VERSION_ID of an os-release file.
+func parseOSRelease(out string) (id string, version string) {
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			id = value
+		case "VERSION_ID":
+			version = value
+		}
+	}
+	return id, version
+}
+
+// splitLines splits the tab separated lines of out, skipping those with
+// less than min fields.
+func splitLines(out string, min int) [][]string {
+	var lines [][]string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		fields := strings.Split(line, "\t")
+		if len(fields) < min || fields[0] == "" {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
@@ -0,0 +1,247 @@
+// This package implements a provisioner for Packer that collects the
+// packages installed on the machine, for the sbom post-processor to write
+// software bills of materials.
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/masterzen/winrm"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/sbom"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+const osReleaseCommand = "cat /etc/os-release"
+
+// packageManager collects the packages of one package manager.
+type packageManager struct {
+	// detect exits 0 when the package manager is installed.
+	detect string
+
+	// list prints the installed packages, which parse reads.
+	list  string
+	parse func(string) []sbom.Package
+}
+
+var packageManagers = map[string]packageManager{
+	"dpkg": {
+		detect: "command -v dpkg-query >/dev/null 2>&1",
+		list:   `dpkg-query -W -f '${db:Status-Abbrev}\t${Package}\t${Version}\t${Architecture}\t${Maintainer}\n'`,
+		parse:  parseDpkg,
+	},
+	"rpm": {
+		detect: "command -v rpm >/dev/null 2>&1",
+		list:   `rpm -qa --qf '%{NAME}\t%{EPOCH}\t%{VERSION}-%{RELEASE}\t%{ARCH}\t%{VENDOR}\t%{LICENSE}\n'`,
+		parse:  parseRPM,
+	},
+	"apk": {
+		detect: "test -f /lib/apk/db/installed",
+		list:   "cat /lib/apk/db/installed",
+		parse:  parseAPK,
+	},
+}
+
+// windowsScript lists the programs in the Programs and Features of the
+// control panel, 32 and 64 bits.
+const windowsScript = `$ErrorActionPreference = 'SilentlyContinue'
+$keys = 'HKLM:\Software\Microsoft\Windows\CurrentVersion\Uninstall\*',
+        'HKLM:\Software\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall\*'
+Get-ItemProperty $keys | Where-Object { $_.DisplayName -and -not $_.SystemComponent } | ForEach-Object {
+  $arch = if ($_.PSPath -match 'Wow6432Node') { 'x86' } else { 'x64' }
+  "$($_.DisplayName)` + "`t" + `$($_.DisplayVersion)` + "`t" + `$arch` + "`t" + `$($_.Publisher)"
+}
+$os = Get-CimInstance Win32_OperatingSystem
+"PACKER_OS` + "`t" + `$($os.Version)"
+`
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The guest OS, unix or windows.
+	GuestOSType string `mapstructure:"guest_os_type"`
+
+	// The package managers to collect the packages of, among dpkg, rpm
+	// and apk. Defaults to all of those found on the machine.
+	PackageManagers []string `mapstructure:"package_managers"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.GuestOSType == "" {
+		p.config.GuestOSType = provisioner.DefaultOSType
+	}
+	p.config.GuestOSType = strings.ToLower(p.config.GuestOSType)
+
+	var errs *packer.MultiError
+	switch p.config.GuestOSType {
+	case provisioner.UnixOSType:
+		for _, name := range p.config.PackageManagers {
+			if _, ok := packageManagers[name]; !ok {
+				errs = packer.MultiErrorAppend(errs,
+					fmt.Errorf("Unsupported package manager: %s", name))
+			}
+		}
+	case provisioner.WindowsOSType:
+		if len(p.config.PackageManagers) > 0 {
+			errs = packer.MultiErrorAppend(errs,
+				fmt.Errorf("package_managers is not supported on Windows"))
+		}
+	default:
+		errs = packer.MultiErrorAppend(errs,
+			fmt.Errorf("Invalid guest_os_type: \"%s\"", p.config.GuestOSType))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say("Collecting the installed packages...")
+
+	var inv *sbom.Inventory
+	var err error
+	if p.config.GuestOSType == provisioner.WindowsOSType {
+		inv, err = p.collectWindows(ctx, comm)
+	} else {
+		inv, err = p.collectUnix(ctx, ui, comm)
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(inv.Packages, func(i, j int) bool {
+		a, b := inv.Packages[i], inv.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	ui.Say(fmt.Sprintf("Found %d packages", len(inv.Packages)))
+
+	value, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	err = commonhelper.SetBuildOutputs(p.config.PackerBuildName, map[string]string{
+		sbom.InventoryOutput: string(value),
+	})
+	if err != nil {
+		return fmt.Errorf("Error saving the packages: %s", err)
+	}
+
+	return nil
+}
+
+func (p *Provisioner) collectUnix(ctx context.Context, ui packer.Ui, comm packer.Communicator) (*sbom.Inventory, error) {
+	inv := &sbom.Inventory{}
+
+	exitStatus, out, err := p.run(ctx, comm, osReleaseCommand)
+	if err != nil {
+		return nil, err
+	}
+	if exitStatus == 0 {
+		inv.Distro, inv.DistroVersion = parseOSRelease(out)
+	}
+
+	names := p.config.PackageManagers
+	explicit := len(names) > 0
+	if !explicit {
+		for name := range packageManagers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	found := false
+	for _, name := range names {
+		pm := packageManagers[name]
+
+		exitStatus, _, err := p.run(ctx, comm, pm.detect)
+		if err != nil {
+			return nil, err
+		}
+		if exitStatus != 0 {
+			if explicit {
+				return nil, fmt.Errorf("%s is not installed on the machine", name)
+			}
+			continue
+		}
+		found = true
+
+		exitStatus, out, err := p.run(ctx, comm, pm.list)
+		if err != nil {
+			return nil, err
+		}
+		if exitStatus != 0 {
+			return nil, fmt.Errorf("Error listing the %s packages: exit status %d", name, exitStatus)
+		}
+		packages := pm.parse(out)
+		ui.Message(fmt.Sprintf("%s: %d packages", name, len(packages)))
+		inv.Packages = append(inv.Packages, packages...)
+	}
+	if !found {
+		return nil, fmt.Errorf("None of the supported package managers (dpkg, rpm, apk) is installed on the machine")
+	}
+
+	return inv, nil
+}
+
+func (p *Provisioner) collectWindows(ctx context.Context, comm packer.Communicator) (*sbom.Inventory, error) {
+	exitStatus, out, err := p.run(ctx, comm, winrm.Powershell(windowsScript))
+	if err != nil {
+		return nil, err
+	}
+	if exitStatus != 0 {
+		return nil, fmt.Errorf("Error listing the installed programs: exit status %d", exitStatus)
+	}
+
+	inv := &sbom.Inventory{Distro: "windows"}
+	inv.DistroVersion, inv.Packages = parseWindows(out)
+	return inv, nil
+}
+
+func (p *Provisioner) run(ctx context.Context, comm packer.Communicator, command string) (int, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, "", err
+	}
+	exitStatus := cmd.Wait()
+	if exitStatus == packer.CmdDisconnect {
+		return 0, "", fmt.Errorf("disconnected while running '%s'", command)
+	}
+	return exitStatus, stdout.String(), nil
+}
+
+func (p *Provisioner) Cancel() {}
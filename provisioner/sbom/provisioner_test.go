@@ -0,0 +1,179 @@
+package sbom
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/common/sbom"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"packer_build_name": "sbom-test",
+	}
+}
+
+// testCommunicator answers the commands starting with the keys of
+// results, and fails the others.
+type testCommunicator struct {
+	packer.MockCommunicator
+	results map[string]string
+}
+
+func (c *testCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	for prefix, stdout := range c.results {
+		if strings.HasPrefix(cmd.Command, prefix) {
+			cmd.Stdout.Write([]byte(stdout))
+			cmd.SetExited(0)
+			return nil
+		}
+	}
+	cmd.SetExited(1)
+	return nil
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packer.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []map[string]interface{}{
+		{"package_managers": []string{"dpkg", "pacman"}},
+		{"guest_os_type": "windows", "package_managers": []string{"dpkg"}},
+		{"guest_os_type": "beos"},
+	}
+	for _, c := range cases {
+		p = Provisioner{}
+		if err := p.Prepare(testConfig(), c); err == nil {
+			t.Fatalf("should have error: %#v", c)
+		}
+	}
+}
+
+func TestParseDpkg(t *testing.T) {
+	out := "ii \tbash\t5.0-4\tamd64\tMatthias Klose <doko@debian.org>\n" +
+		"rc \told-kernel\t4.9.0\tamd64\tDebian Kernel Team <debian-kernel@lists.debian.org>\n"
+	expected := []sbom.Package{
+		{Type: sbom.TypeDeb, Name: "bash", Version: "5.0-4", Arch: "amd64", Supplier: "Matthias Klose <doko@debian.org>"},
+	}
+	if packages := parseDpkg(out); !reflect.DeepEqual(packages, expected) {
+		t.Fatalf("unexpected packages: %#v", packages)
+	}
+}
+
+func TestParseRPM(t *testing.T) {
+	out := "bash\t(none)\t4.4.19-7.el8\tx86_64\tCentOS\tGPLv3+\n" +
+		"openssl\t1\t1.1.1c-2.el8\tx86_64\tCentOS\tOpenSSL\n" +
+		"gpg-pubkey\t(none)\t8483c65d-5ccc5b19\t(none)\t(none)\tpubkey\n"
+	expected := []sbom.Package{
+		{Type: sbom.TypeRPM, Name: "bash", Version: "4.4.19-7.el8", Arch: "x86_64", Supplier: "CentOS", License: "GPLv3+"},
+		{Type: sbom.TypeRPM, Name: "openssl", Version: "1:1.1.1c-2.el8", Arch: "x86_64", Supplier: "CentOS", License: "OpenSSL"},
+		{Type: sbom.TypeRPM, Name: "gpg-pubkey", Version: "8483c65d-5ccc5b19", License: "pubkey"},
+	}
+	if packages := parseRPM(out); !reflect.DeepEqual(packages, expected) {
+		t.Fatalf("unexpected packages: %#v", packages)
+	}
+}
+
+func TestParseAPK(t *testing.T) {
+	out := `C:Q1S6Aq+CFKyyWBsjjkjQTSbJvHOkc=
+P:musl
+V:1.1.22-r3
+A:x86_64
+L:MIT
+m:Timo Teräs <timo.teras@iki.fi>
+
+P:busybox
+V:1.30.1-r2
+A:x86_64
+L:GPL-2.0
+`
+	expected := []sbom.Package{
+		{Type: sbom.TypeAPK, Name: "musl", Version: "1.1.22-r3", Arch: "x86_64", License: "MIT", Supplier: "Timo Teräs <timo.teras@iki.fi>"},
+		{Type: sbom.TypeAPK, Name: "busybox", Version: "1.30.1-r2", Arch: "x86_64", License: "GPL-2.0"},
+	}
+	if packages := parseAPK(out); !reflect.DeepEqual(packages, expected) {
+		t.Fatalf("unexpected packages: %#v", packages)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	out := "7-Zip 19.00 (x64)\t19.00\tx64\tIgor Pavlov\r\n" +
+		"Google Chrome\t75.0.3770.100\tx86\tGoogle LLC\r\n" +
+		"PACKER_OS\t10.0.17763\r\n"
+	version, packages := parseWindows(out)
+	if version != "10.0.17763" {
+		t.Fatalf("unexpected version: %s", version)
+	}
+	expected := []sbom.Package{
+		{Type: sbom.TypeWindows, Name: "7-Zip 19.00 (x64)", Version: "19.00", Arch: "x64", Supplier: "Igor Pavlov"},
+		{Type: sbom.TypeWindows, Name: "Google Chrome", Version: "75.0.3770.100", Arch: "x86", Supplier: "Google LLC"},
+	}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Fatalf("unexpected packages: %#v", packages)
+	}
+}
+
+func TestProvisionerProvision(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-sbom")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("sbom-test")
+
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: map[string]string{
+			osReleaseCommand:               "PRETTY_NAME=\"Debian GNU/Linux 10 (buster)\"\nID=debian\nVERSION_ID=\"10\"\n",
+			packageManagers["dpkg"].detect: "",
+			"dpkg-query":                   "ii \tzlib1g\t1:1.2.11.dfsg-1\tamd64\t\nii \tbash\t5.0-4\tamd64\t\n",
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("sbom-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var inv sbom.Inventory
+	if err := json.Unmarshal([]byte(outputs[sbom.InventoryOutput]), &inv); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if inv.Distro != "debian" || inv.DistroVersion != "10" {
+		t.Fatalf("unexpected distro: %#v", inv)
+	}
+	if len(inv.Packages) != 2 || inv.Packages[0].Name != "bash" {
+		t.Fatalf("unexpected packages: %#v", inv.Packages)
+	}
+}
+
+func TestProvisionerProvision_Missing(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig(), map[string]interface{}{"package_managers": []string{"rpm"}}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{results: map[string]string{}}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("should have error")
+	}
+}
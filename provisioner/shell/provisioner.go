@@ -57,10 +57,16 @@ type Config struct {
 
 	ExpectDisconnect bool `mapstructure:"expect_disconnect"`
 
+	// Whether to capture the outputs exported by the scripts so that later
+	// provisioners and post-processors can use them.
+	CaptureOutputs bool `mapstructure:"capture_outputs"`
+
 	startRetryTimeout time.Duration
 	ctx               interpolate.Context
 	// name of the tmp environment variable file, if UseEnvVarFile is true
 	envVarFile string
+	// captures the outputs of the scripts, if CaptureOutputs is true
+	outputs *shell.OutputCapture
 }
 
 type Provisioner struct {
@@ -80,6 +86,8 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		InterpolateFilter: &interpolate.RenderFilter{
 			Exclude: []string{
 				"execute_command",
+				"inline",
+				"environment_vars",
 			},
 		},
 	}, raws...)
@@ -119,6 +127,12 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 			"%s/%s", p.config.RemoteFolder, p.config.RemoteFile)
 	}
 
+	if p.config.CaptureOutputs {
+		p.config.outputs = &shell.OutputCapture{
+			RemotePath: fmt.Sprintf("%s/packer-outputs-%d", p.config.RemoteFolder, rand.Intn(9999)),
+		}
+	}
+
 	if p.config.Scripts == nil {
 		p.config.Scripts = make([]string, 0)
 	}
@@ -185,6 +199,22 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	// Render the inline commands and the environment variables in a copy of
+	// the provisioner, so that they are rendered again if it runs again.
+	rendered := *p
+	rendered.config.ctx.Data = nil
+	var err error
+	if rendered.config.Inline, err = shell.Render(p.config.Inline, &rendered.config.ctx); err != nil {
+		return fmt.Errorf("Error processing inline commands: %s", err)
+	}
+	if rendered.config.Vars, err = shell.Render(p.config.Vars, &rendered.config.ctx); err != nil {
+		return fmt.Errorf("Error processing environment variables: %s", err)
+	}
+
+	return rendered.provision(ctx, ui, comm)
+}
+
+func (p *Provisioner) provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
 	scripts := make([]string, len(p.config.Scripts))
 	copy(scripts, p.config.Scripts)
 
@@ -323,6 +353,12 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 			cmd.Wait()
 
 			cmd = &packer.RemoteCmd{Command: command}
+			if p.config.outputs != nil {
+				if err := p.config.outputs.Reset(comm); err != nil {
+					return err
+				}
+				cmd.Stdout = p.config.outputs.Stdout()
+			}
 			return cmd.RunWithUi(ctx, comm, ui)
 		})
 
@@ -342,6 +378,14 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 			}
 		} else if err := p.config.ValidExitCode(cmd.ExitStatus()); err != nil {
 			return err
+		} else if p.config.outputs != nil {
+			names, err := p.config.outputs.Save(comm, p.config.PackerBuildName)
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				ui.Say(fmt.Sprintf("Captured outputs: %s", strings.Join(names, ", ")))
+			}
 		}
 
 		if !p.config.SkipClean {
@@ -360,6 +404,12 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		}
 	}
 
+	if p.config.outputs != nil && !p.config.SkipClean {
+		if err := p.cleanupRemoteFile(p.config.outputs.RemotePath, comm); err != nil {
+			return err
+		}
+	}
+
 	if p.config.RawPauseAfter != "" {
 		ui.Say(fmt.Sprintf("Pausing %s after this provisioner...", p.config.PauseAfter))
 		select {
@@ -423,6 +473,10 @@ func (p *Provisioner) escapeEnvVars() ([]string, map[string]string) {
 		envVars["PACKER_HTTP_PORT"] = httpPort
 	}
 
+	if p.config.outputs != nil {
+		envVars[shell.OutputFileEnvVar] = p.config.outputs.RemotePath
+	}
+
 	// Split vars into key/value components
 	for _, envVar := range p.config.Vars {
 		keyValue := strings.SplitN(envVar, "=", 2)
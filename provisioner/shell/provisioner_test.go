@@ -1,12 +1,14 @@
 package shell
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"regexp"
 	"strings"
 	"testing"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/packer"
 )
 
@@ -468,3 +470,90 @@ func TestProvisionerRemotePathDefaultsSuccessfully(t *testing.T) {
 		t.Fatalf("remote path does not match the expected default regex")
 	}
 }
+
+func TestProvisionerProvision_CaptureOutputs(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-shell-outputs")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("ubuntu")
+
+	config := testConfig()
+	config["capture_outputs"] = true
+	config["packer_build_name"] = "ubuntu"
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packer.MockCommunicator{
+		StartStdout:  "installing...\nPACKER_OUTPUT kernel=4.15.0\n",
+		DownloadData: "version=1.2.3\n",
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if comm.DownloadPath != p.config.outputs.RemotePath {
+		t.Fatalf("should download the output file: %s", comm.DownloadPath)
+	}
+	if !strings.Contains(comm.StartCmd.Command, "rm -f "+p.config.outputs.RemotePath) {
+		t.Fatalf("should remove the output file: %s", comm.StartCmd.Command)
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("ubuntu")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs["kernel"] != "4.15.0" || outputs["version"] != "1.2.3" {
+		t.Fatalf("bad: %#v", outputs)
+	}
+
+	// A later provisioner can use the outputs
+	config = testConfig()
+	config["inline"] = []interface{}{`echo {{ output "version" }}`}
+	config["environment_vars"] = []interface{}{`KERNEL={{ output "kernel" }}`}
+	config["packer_build_name"] = "ubuntu"
+	config["skip_clean"] = true
+
+	p = Provisioner{}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm = new(packer.MockCommunicator)
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(comm.UploadData, "echo 1.2.3") {
+		t.Fatalf("bad script: %s", comm.UploadData)
+	}
+	if !strings.Contains(comm.StartCmd.Command, "KERNEL='4.15.0'") {
+		t.Fatalf("bad command: %s", comm.StartCmd.Command)
+	}
+
+	// The configuration keeps the templates, so that the outputs are
+	// rendered again if the provisioner runs again.
+	if err := commonhelper.SetBuildOutputs("ubuntu", map[string]string{"version": "1.2.4"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	comm = new(packer.MockCommunicator)
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(comm.UploadData, "echo 1.2.4") {
+		t.Fatalf("bad script: %s", comm.UploadData)
+	}
+}
+
+func TestProvisionerPrepare_OutputOutsideInline(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-shell-outputs-prepare")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+
+	config := testConfig()
+	config["remote_folder"] = `{{ output "folder" }}`
+	config["packer_build_name"] = "ubuntu"
+
+	var p Provisioner
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should error on an output that is never rendered")
+	}
+}
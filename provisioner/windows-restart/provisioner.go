@@ -114,7 +114,11 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		return err
 	}
 
-	if cmd.ExitStatus() != 0 && cmd.ExitStatus() != 1115 && cmd.ExitStatus() != 1190 {
+	// Over SSH the restart may close the connection before the exit status
+	// of the restart command is sent back.
+	if cmd.ExitStatus() == packer.CmdDisconnect {
+		log.Printf("Connection closed by the restart command")
+	} else if cmd.ExitStatus() != 0 && cmd.ExitStatus() != 1115 && cmd.ExitStatus() != 1190 {
 		return fmt.Errorf("Restart script exited with non-zero exit status: %d", cmd.ExitStatus())
 	}
 
@@ -147,7 +151,7 @@ var waitForRestart = func(ctx context.Context, p *Provisioner, comm packer.Commu
 			// Couldn't execute, we assume machine is rebooting already
 			break
 		}
-		if cmd.ExitStatus() == 1 {
+		if cmd.ExitStatus() == 1 || cmd.ExitStatus() == packer.CmdDisconnect {
 			// SSH provisioner, and we're already rebooting. SSH can reconnect
 			// without our help; exit this wait loop.
 			break
@@ -154,6 +154,27 @@ func TestProvisionerProvision_CustomCommand(t *testing.T) {
 	waitForRestart = waitForRestartOld
 }
 
+func TestProvisionerProvision_RestartCommandDisconnect(t *testing.T) {
+	config := testConfig()
+	ui := testUi()
+	p := new(Provisioner)
+
+	// SSH drops the connection without an exit status
+	comm := new(packer.MockCommunicator)
+	comm.StartExitStatus = packer.CmdDisconnect
+
+	p.Prepare(config)
+	waitForRestartOld := waitForRestart
+	waitForRestart = func(context.Context, *Provisioner, packer.Communicator) error {
+		return nil
+	}
+	defer func() { waitForRestart = waitForRestartOld }()
+
+	if err := p.Provision(context.Background(), ui, comm); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+}
+
 func TestProvisionerProvision_RestartCommandFail(t *testing.T) {
 	config := testConfig()
 	ui := testUi()
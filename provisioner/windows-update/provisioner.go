@@ -0,0 +1,325 @@
+// This package implements a provisioner for Packer that installs Windows
+// updates, restarting the machine as many times as needed.
+package update
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/common/retry"
+	"github.com/hashicorp/packer/common/uuid"
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner"
+	restart "github.com/hashicorp/packer/provisioner/windows-restart"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+var DefaultSearchCriteria = "BrowseOnly=0 and IsInstalled=0"
+
+var kbRegexp = regexp.MustCompile(`^(?i:KB)?(\d+)$`)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The Windows Update Agent query selecting the updates to install.
+	SearchCriteria string `mapstructure:"search_criteria"`
+
+	// Only install the updates of these KB articles.
+	IncludeKBs []string `mapstructure:"include_kbs"`
+
+	// Never install the updates of these KB articles.
+	ExcludeKBs []string `mapstructure:"exclude_kbs"`
+
+	// The timeout for waiting for the machine to restart between two
+	// update cycles.
+	RestartTimeout time.Duration `mapstructure:"restart_timeout"`
+
+	// The timeout for starting the update script, which is retried until
+	// then.
+	StartRetryTimeout time.Duration `mapstructure:"start_retry_timeout"`
+
+	// The user and password of the scheduled task installing the updates.
+	// The Windows Update API cannot be used from a remote session.
+	ElevatedUser     string `mapstructure:"elevated_user"`
+	ElevatedPassword string `mapstructure:"elevated_password"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config       Config
+	communicator packer.Communicator
+}
+
+type EnvVarsTemplate struct {
+	WinRMPassword string
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	// Create passthrough for winrm password so we can fill it in once we know
+	// it
+	p.config.ctx.Data = &EnvVarsTemplate{
+		WinRMPassword: `{{.WinRMPassword}}`,
+	}
+
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.SearchCriteria == "" {
+		p.config.SearchCriteria = DefaultSearchCriteria
+	}
+
+	if p.config.RestartTimeout == 0 {
+		p.config.RestartTimeout = 30 * time.Minute
+	}
+
+	if p.config.StartRetryTimeout == 0 {
+		p.config.StartRetryTimeout = 5 * time.Minute
+	}
+
+	if p.config.ElevatedUser == "" {
+		p.config.ElevatedUser = "SYSTEM"
+	}
+
+	var errs *packer.MultiError
+	for _, kbs := range []*[]string{&p.config.IncludeKBs, &p.config.ExcludeKBs} {
+		for i, kb := range *kbs {
+			m := kbRegexp.FindStringSubmatch(strings.TrimSpace(kb))
+			if m == nil {
+				errs = packer.MultiErrorAppend(errs,
+					fmt.Errorf("Invalid KB article %q, must look like KB1234567", kb))
+				continue
+			}
+			// The Windows Update API lists the bare numbers
+			(*kbs)[i] = m[1]
+		}
+	}
+
+	if p.config.RestartTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("restart_timeout must be positive"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	p.communicator = comm
+
+	installed := map[string]bool{}
+	var kbs []string
+	for cycle := 1; ; cycle++ {
+		ui.Say(fmt.Sprintf("Running Windows update cycle %d...", cycle))
+
+		report := &updateReport{ui: ui}
+		exitStatus, err := p.runUpdate(ctx, ui, comm, report)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range report.installed {
+			if installed[u.title] {
+				return fmt.Errorf("Update %q is still offered after being installed", u.title)
+			}
+			installed[u.title] = true
+			if u.kbs != "-" {
+				kbs = append(kbs, u.kbs)
+			}
+		}
+
+		switch exitStatus {
+		case 0:
+			ui.Say(fmt.Sprintf("Installed %d Windows updates", len(installed)))
+			err := commonhelper.SetBuildOutputs(p.config.PackerBuildName, map[string]string{
+				"windows_updates": strings.Join(kbs, ","),
+			})
+			if err != nil {
+				return fmt.Errorf("Error saving outputs: %s", err)
+			}
+			return nil
+		case exitMoreUpdates:
+			log.Printf("No restart required, searching for more updates")
+		case exitRestartRequired:
+			if err := p.restart(ctx, ui, comm); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Windows update failed with exit status %d", exitStatus)
+		}
+	}
+}
+
+func (p *Provisioner) Cancel() {}
+
+// runUpdate runs one cycle of the update script as a scheduled task.
+func (p *Provisioner) runUpdate(ctx context.Context, ui packer.Ui, comm packer.Communicator, report *updateReport) (int, error) {
+	var script bytes.Buffer
+	err := updateScript.Execute(&script, &scriptOptions{
+		SearchCriteria: psQuote(p.config.SearchCriteria),
+		Include:        psList(p.config.IncludeKBs),
+		Exclude:        psList(p.config.ExcludeKBs),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error generating the update script: %s", err)
+	}
+
+	path := fmt.Sprintf("C:/Windows/Temp/packer-windows-update-%s.ps1", uuid.TimeOrderedUUID())
+	command := fmt.Sprintf(`powershell -NoProfile -ExecutionPolicy Bypass -File "%s"`, path)
+
+	var cmd *packer.RemoteCmd
+	err = retry.Config{StartTimeout: p.config.StartRetryTimeout}.Run(ctx, func(ctx context.Context) error {
+		if err := comm.Upload(path, bytes.NewReader(script.Bytes()), nil); err != nil {
+			return fmt.Errorf("Error uploading the update script: %s", err)
+		}
+
+		elevated, err := provisioner.GenerateElevatedRunner(command, p)
+		if err != nil {
+			return fmt.Errorf("Error generating elevated runner: %s", err)
+		}
+
+		cmd = &packer.RemoteCmd{
+			Command: elevated,
+			Stdout:  &lineWriter{fn: report.line},
+			Stderr:  &lineWriter{fn: ui.Error},
+		}
+		if err := comm.Start(ctx, cmd); err != nil {
+			return err
+		}
+		cmd.Wait()
+		cmd.Stdout.(*lineWriter).Flush()
+		cmd.Stderr.(*lineWriter).Flush()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return cmd.ExitStatus(), nil
+}
+
+// restart restarts the machine with the windows-restart provisioner,
+// waiting for the pending updates to be configured.
+func (p *Provisioner) restart(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var r restart.Provisioner
+	err := r.Prepare(map[string]interface{}{
+		"restart_timeout": p.config.RestartTimeout.String(),
+		"check_registry":  true,
+	})
+	if err != nil {
+		return err
+	}
+	return r.Provision(ctx, ui, comm)
+}
+
+func (p *Provisioner) Communicator() packer.Communicator {
+	return p.communicator
+}
+
+func (p *Provisioner) ElevatedUser() string {
+	return p.config.ElevatedUser
+}
+
+func (p *Provisioner) ElevatedPassword() string {
+	// Replace ElevatedPassword for winrm users who used this feature
+	winRMPass, _ := commonhelper.RetrieveSharedState("winrm_password", p.config.PackerBuildName)
+	packer.LogSecretFilter.Set(winRMPass)
+	p.config.ctx.Data = &EnvVarsTemplate{
+		WinRMPassword: winRMPass,
+	}
+
+	elevatedPassword, _ := interpolate.Render(p.config.ElevatedPassword, &p.config.ctx)
+
+	return elevatedPassword
+}
+
+// update is an update reported by the update script.
+type update struct {
+	status string
+	kbs    string
+	title  string
+}
+
+// updateReport shows the output of the update script, reporting the status
+// of each update.
+type updateReport struct {
+	ui        packer.Ui
+	installed []update
+}
+
+func (r *updateReport) line(line string) {
+	fields := strings.SplitN(line, "\t", 4)
+	if len(fields) != 4 || fields[0] != updateMarker {
+		r.ui.Message(line)
+		return
+	}
+
+	u := update{status: fields[1], kbs: fields[2], title: fields[3]}
+	switch u.status {
+	case "installed":
+		r.installed = append(r.installed, u)
+		r.ui.Message(fmt.Sprintf("Installed: %s (%s)", u.title, u.kbs))
+	case "failed":
+		r.ui.Error(fmt.Sprintf("Failed: %s (%s)", u.title, u.kbs))
+	case "skipped":
+		r.ui.Message(fmt.Sprintf("Skipped: %s (%s)", u.title, u.kbs))
+	default:
+		r.ui.Message(fmt.Sprintf("Found: %s (%s)", u.title, u.kbs))
+	}
+}
+
+// lineWriter calls fn with every line written to it.
+type lineWriter struct {
+	fn func(string)
+
+	l   sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush sends the last line if it has no newline.
+func (w *lineWriter) Flush() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	w.emit(w.buf)
+	w.buf = nil
+}
+
+func (w *lineWriter) emit(line []byte) {
+	if s := strings.TrimRight(string(line), "\r"); s != "" {
+		w.fn(s)
+	}
+}
@@ -0,0 +1,210 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	commonhelper "github.com/hashicorp/packer/helper/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"packer_build_name": "windows-update-test",
+	}
+}
+
+// testCommunicator answers each command with the next of its results.
+type testCommunicator struct {
+	packer.MockCommunicator
+	results []testResult
+	ran     int
+}
+
+type testResult struct {
+	status int
+	stdout string
+}
+
+func (c *testCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	r := c.results[c.ran]
+	c.ran++
+	cmd.Stdout.Write([]byte(r.stdout))
+	cmd.SetExited(r.status)
+	return nil
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packer.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.SearchCriteria != DefaultSearchCriteria {
+		t.Errorf("unexpected search criteria: %s", p.config.SearchCriteria)
+	}
+	if p.config.RestartTimeout != 30*time.Minute {
+		t.Errorf("unexpected restart timeout: %s", p.config.RestartTimeout)
+	}
+	if p.config.ElevatedUser != "SYSTEM" {
+		t.Errorf("unexpected elevated user: %s", p.config.ElevatedUser)
+	}
+}
+
+func TestProvisionerPrepare_KBs(t *testing.T) {
+	config := testConfig()
+	config["include_kbs"] = []string{"KB4012212", "4012215"}
+	config["exclude_kbs"] = []string{"kb890830"}
+
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.config.IncludeKBs, []string{"4012212", "4012215"}) {
+		t.Fatalf("unexpected include_kbs: %#v", p.config.IncludeKBs)
+	}
+	if !reflect.DeepEqual(p.config.ExcludeKBs, []string{"890830"}) {
+		t.Fatalf("unexpected exclude_kbs: %#v", p.config.ExcludeKBs)
+	}
+
+	config["exclude_kbs"] = []string{"Defender"}
+	p = Provisioner{}
+	if err := p.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestUpdateScript(t *testing.T) {
+	var script bytes.Buffer
+	err := updateScript.Execute(&script, &scriptOptions{
+		SearchCriteria: psQuote("IsInstalled=0 and Type='Software'"),
+		Include:        psList([]string{"4012212", "4012215"}),
+		Exclude:        psList(nil),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, expected := range []string{
+		`$searchCriteria = 'IsInstalled=0 and Type=''Software'''`,
+		`$include = @('4012212','4012215')`,
+		`$exclude = @()`,
+		"Write-Output \"PACKER_UPDATE`t$status`t$kbs`t$($update.Title)\"",
+	} {
+		if !strings.Contains(script.String(), expected) {
+			t.Fatalf("script should contain %s:\n%s", expected, script.String())
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\n\nthird"))
+	w.Flush()
+
+	if !reflect.DeepEqual(lines, []string{"first", "second", "third"}) {
+		t.Fatalf("unexpected lines: %#v", lines)
+	}
+}
+
+func TestProvisionerProvision_Cycles(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-windows-update")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("windows-update-test")
+
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: []testResult{
+			{exitMoreUpdates, strings.Join([]string{
+				"Searching for Windows updates matching: BrowseOnly=0 and IsInstalled=0",
+				"PACKER_UPDATE\tselected\tKB4023057\tUpdate for Windows 10",
+				"PACKER_UPDATE\tskipped\tKB890830\tWindows Malicious Software Removal Tool",
+				"PACKER_UPDATE\tinstalled\tKB4023057\tUpdate for Windows 10",
+			}, "\r\n")},
+			{exitMoreUpdates, "PACKER_UPDATE\tinstalled\tKB4489899\t2019-03 Cumulative Update\r\n"},
+			{0, "No updates to install.\r\n"},
+		},
+	}
+
+	var out bytes.Buffer
+	ui := &packer.BasicUi{Writer: &out, ErrorWriter: &out}
+	if err := p.Provision(context.Background(), ui, comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if comm.ran != 3 {
+		t.Fatalf("expected 3 cycles, got %d", comm.ran)
+	}
+
+	output := out.String()
+	for _, expected := range []string{
+		"Installed: Update for Windows 10 (KB4023057)",
+		"Skipped: Windows Malicious Software Removal Tool (KB890830)",
+		"Installed 2 Windows updates",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("output should contain %q:\n%s", expected, output)
+		}
+	}
+
+	outputs, err := commonhelper.RetrieveBuildOutputs("windows-update-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if outputs["windows_updates"] != "KB4023057,KB4489899" {
+		t.Fatalf("unexpected outputs: %#v", outputs)
+	}
+}
+
+func TestProvisionerProvision_Failed(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &testCommunicator{
+		results: []testResult{
+			{1, "PACKER_UPDATE\tfailed\tKB4489899\t2019-03 Cumulative Update\r\n"},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_OfferedAgain(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	installed := "PACKER_UPDATE\tinstalled\tKB4489899\t2019-03 Cumulative Update\r\n"
+	comm := &testCommunicator{
+		results: []testResult{
+			{exitMoreUpdates, installed},
+			{exitMoreUpdates, installed},
+		},
+	}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("should have error")
+	}
+}
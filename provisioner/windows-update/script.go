@@ -0,0 +1,124 @@
+package update
+
+import (
+	"strings"
+	"text/template"
+)
+
+// The exit codes of the update script, besides 0 when no update is left to
+// install. They must match the script below.
+const (
+	exitRestartRequired = 101
+	exitMoreUpdates     = 102
+)
+
+// updateMarker prefixes the lines of the script reporting the status of an
+// update, as "PACKER_UPDATE <status> <KBs> <title>" separated by tabs.
+const updateMarker = "PACKER_UPDATE"
+
+type scriptOptions struct {
+	SearchCriteria string
+	Include        string
+	Exclude        string
+}
+
+var updateScript = template.Must(template.New("WindowsUpdate").Parse(`
+$ErrorActionPreference = 'Stop'
+$ProgressPreference = 'SilentlyContinue'
+
+$searchCriteria = '{{.SearchCriteria}}'
+$include = @({{.Include}})
+$exclude = @({{.Exclude}})
+
+function Write-Update($status, $update) {
+  $kbs = ($update.KBArticleIDs | ForEach-Object { "KB$_" }) -join ','
+  if (!$kbs) {
+    $kbs = '-'
+  }
+  Write-Output "PACKER_UPDATE` + "`t$status`t$kbs`t$($update.Title)" + `"
+}
+
+function Test-Selected($update) {
+  $ids = @($update.KBArticleIDs)
+  if ($exclude | Where-Object { $ids -contains $_ }) {
+    return $false
+  }
+  if ($include.Count -eq 0) {
+    return $true
+  }
+  return [bool]($include | Where-Object { $ids -contains $_ })
+}
+
+try {
+  $session = New-Object -ComObject 'Microsoft.Update.Session'
+  $session.ClientApplicationID = 'packer'
+
+  Write-Output "Searching for Windows updates matching: $searchCriteria"
+  $result = $session.CreateUpdateSearcher().Search($searchCriteria)
+
+  $updates = New-Object -ComObject 'Microsoft.Update.UpdateColl'
+  foreach ($update in $result.Updates) {
+    if (!(Test-Selected $update) -or $update.InstallationBehavior.CanRequestUserInput) {
+      Write-Update 'skipped' $update
+      continue
+    }
+    if (!$update.EulaAccepted) {
+      $update.AcceptEula() | Out-Null
+    }
+    Write-Update 'selected' $update
+    $updates.Add($update) | Out-Null
+  }
+
+  if ($updates.Count -eq 0) {
+    Write-Output 'No updates to install.'
+    exit 0
+  }
+
+  Write-Output "Downloading $($updates.Count) updates..."
+  $downloader = $session.CreateUpdateDownloader()
+  $downloader.Updates = $updates
+  $downloader.Download() | Out-Null
+
+  Write-Output "Installing $($updates.Count) updates..."
+  $installer = $session.CreateUpdateInstaller()
+  $installer.Updates = $updates
+  $installResult = $installer.Install()
+
+  $failed = $false
+  for ($i = 0; $i -lt $updates.Count; $i++) {
+    # 2 is succeeded and 3 succeeded with errors
+    $code = $installResult.GetUpdateResult($i).ResultCode
+    if ($code -eq 2 -or $code -eq 3) {
+      Write-Update 'installed' $updates.Item($i)
+    } else {
+      Write-Update 'failed' $updates.Item($i)
+      $failed = $true
+    }
+  }
+
+  if ($failed) {
+    exit 1
+  }
+  if ($installResult.RebootRequired) {
+    exit 101
+  }
+  exit 102
+} catch {
+  Write-Output "Error: $_"
+  exit 1
+}
+`))
+
+// psQuote escapes s for a single quoted PowerShell string.
+func psQuote(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+// psList renders KB numbers as the items of a PowerShell array.
+func psList(kbs []string) string {
+	items := make([]string, 0, len(kbs))
+	for _, kb := range kbs {
+		items = append(items, "'"+psQuote(kb)+"'")
+	}
+	return strings.Join(items, ",")
+}
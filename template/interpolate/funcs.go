@@ -12,6 +12,7 @@ import (
 
 	consulapi "github.com/hashicorp/consul/api"
 	"github.com/hashicorp/packer/common/uuid"
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/version"
 	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/rwtodd/Go.Sed/sed"
@@ -42,6 +43,7 @@ var FuncGens = map[string]FuncGenerator{
 	"consul_key":     funcGenConsul,
 	"vault":          funcGenVault,
 	"sed":            funcGenSed,
+	"output":         funcGenOutput,
 
 	"upper": funcGenPrimitive(strings.ToUpper),
 	"lower": funcGenPrimitive(strings.ToLower),
@@ -124,6 +126,27 @@ func funcGenIsotime(ctx *Context) interface{} {
 	}
 }
 
+func funcGenOutput(ctx *Context) interface{} {
+	return func(k string) (string, error) {
+		if ctx == nil || ctx.BuildName == "" {
+			return "", errors.New("output can only be used within a build")
+		}
+
+		outputs, err := commonhelper.RetrieveBuildOutputs(ctx.BuildName)
+		if err != nil {
+			return "", fmt.Errorf("error reading build outputs: %s", err)
+		}
+		if v, ok := outputs[k]; ok {
+			return v, nil
+		}
+
+		// Outputs only exist once the provisioner that captures them ran.
+		// Most fields are rendered before the build starts, so this is
+		// where using output in one of them fails.
+		return "", fmt.Errorf("output %q is not set", k)
+	}
+}
+
 func funcGenPrimitive(value interface{}) FuncGenerator {
 	return func(ctx *Context) interface{} {
 		return value
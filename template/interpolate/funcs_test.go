@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	commonhelper "github.com/hashicorp/packer/helper/common"
 	"github.com/hashicorp/packer/version"
 )
 
@@ -354,3 +355,39 @@ func TestFuncSed(t *testing.T) {
 		}
 	}
 }
+
+func TestFuncOutput(t *testing.T) {
+	os.Setenv("PACKER_RUN_UUID", "test-func-output")
+	defer os.Unsetenv("PACKER_RUN_UUID")
+	defer commonhelper.RemoveBuildOutputs("foo")
+
+	ctx := &Context{BuildName: "foo"}
+
+	// Outputs that aren't set yet are an error
+	if _, err := Render(`kernel-{{ output "kernel" }}`, ctx); err == nil {
+		t.Fatal("should error on a missing output")
+	}
+	if _, err := Render(`{{ output "kernel" }}`, &Context{}); err == nil {
+		t.Fatal("should error outside of a build")
+	}
+
+	if err := commonhelper.SetBuildOutputs("foo", map[string]string{"kernel": "4.15"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := Render(`kernel-{{ output "kernel" }}`, ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "kernel-4.15" {
+		t.Fatalf("bad: %s", result)
+	}
+
+	result, err = Render(`{{ output "kernel" | upper }}{{ "{{" }}`, ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "4.15{{" {
+		t.Fatalf("bad: %s", result)
+	}
+}
@@ -234,6 +234,10 @@ func (r *rawTemplate) Template() (*Template, error) {
 		delete(p.Config, "pause_before")
 		delete(p.Config, "type")
 		delete(p.Config, "timeout")
+		delete(p.Config, "max_retries")
+		delete(p.Config, "retry_backoff")
+		delete(p.Config, "retry_on")
+		delete(p.Config, "when")
 
 		if len(p.Config) == 0 {
 			p.Config = nil
@@ -119,6 +119,34 @@ func TestParse(t *testing.T) {
 			false,
 		},
 
+		{
+			"parse-provisioner-retry.json",
+			&Template{
+				Provisioners: []*Provisioner{
+					{
+						Type:         "something",
+						MaxRetries:   3,
+						RetryBackoff: 10 * time.Second,
+						RetryOn:      []string{"connection reset", "exit status 100"},
+					},
+				},
+			},
+			false,
+		},
+
+		{
+			"parse-provisioner-when.json",
+			&Template{
+				Provisioners: []*Provisioner{
+					{
+						Type: "something",
+						When: `{{ eq (user "env") "prod" }}`,
+					},
+				},
+			},
+			false,
+		},
+
 		{
 			"parse-provisioner-only.json",
 			&Template{
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
@@ -149,6 +150,18 @@ type Provisioner struct {
 	Override    map[string]interface{} `json:"override,omitempty"`
 	PauseBefore time.Duration          `mapstructure:"pause_before" json:"pause_before,omitempty"`
 	Timeout     time.Duration          `mapstructure:"timeout" json:"timeout,omitempty"`
+
+	// MaxRetries is how many times a failed provisioner is run again,
+	// waiting RetryBackoff before the first retry and twice as long before
+	// each following one. If RetryOn is set, only errors matching one of
+	// these regular expressions are retried.
+	MaxRetries   int           `mapstructure:"max_retries" json:"max_retries,omitempty"`
+	RetryBackoff time.Duration `mapstructure:"retry_backoff" json:"retry_backoff,omitempty"`
+	RetryOn      []string      `mapstructure:"retry_on" json:"retry_on,omitempty"`
+
+	// When is an interpolation that must render to true for the
+	// provisioner to run.
+	When string `mapstructure:"when" json:"when,omitempty"`
 }
 
 // MarshalJSON conducts the necessary flattening of the Provisioner struct
@@ -234,6 +247,19 @@ func (t *Template) Validate() error {
 			}
 		}
 
+		// Validate retries
+		if p.MaxRetries < 0 {
+			err = multierror.Append(err, fmt.Errorf(
+				"provisioner %d: max_retries can't be negative", i+1))
+		}
+		for _, expr := range p.RetryOn {
+			if _, rerr := regexp.Compile(expr); rerr != nil {
+				err = multierror.Append(err, fmt.Errorf(
+					"provisioner %d: invalid retry_on expression '%s': %s",
+					i+1, expr, rerr))
+			}
+		}
+
 		// Validate overrides
 		for name := range p.Override {
 			if _, ok := t.Builders[name]; !ok {
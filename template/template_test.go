@@ -23,6 +23,16 @@ func TestTemplateValidate(t *testing.T) {
 			false,
 		},
 
+		{
+			"validate-good-prov-retry.json",
+			false,
+		},
+
+		{
+			"validate-bad-prov-retry.json",
+			true,
+		},
+
 		{
 			"validate-no-builders.json",
 			true,